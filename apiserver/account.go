@@ -0,0 +1,126 @@
+package apiserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/google/uuid"
+
+	"asyncapi/reports"
+)
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+func (r ChangePasswordRequest) Validate() error {
+	var errs ValidationErrors
+	if r.CurrentPassword == "" {
+		errs.Add("current_password", "current_password is required")
+	}
+	if r.NewPassword == "" {
+		errs.Add("new_password", "new_password is required")
+	}
+	return errs.Err()
+}
+
+func (r ChangePasswordRequest) PasswordField() (string, string) {
+	return "new_password", r.NewPassword
+}
+
+// changePasswordHandler replaces the password of the signed in user after
+// checking their current password, and revokes all of their refresh tokens.
+func (s *ApiServer) changePasswordHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		req, err := decodePassword[ChangePasswordRequest](r, s.passwords)
+		if err != nil {
+			return err
+		}
+		user, err := sessionUserFromContext(r)
+		if err != nil {
+			return err
+		}
+
+		if err := user.ComparePassword(req.CurrentPassword); err != nil {
+			return NewErrWithStatus(http.StatusForbidden, errors.New("current password is incorrect")).Public()
+		}
+		if err := s.store.Users.UpdatePassword(r.Context(), user.Id, req.NewPassword); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		if _, err := s.store.RefreshTokenStore.DeleteUserTokens(r.Context(), user.Id); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		if err := encode(ApiResponse[struct{}]{
+			Message: "password changed",
+		}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		return nil
+	})
+}
+
+// deleteAccountHandler deletes the signed in user. Their report files are
+// removed from S3 first, so a failure leaves the account in place and the
+// request can be retried; refresh tokens and reports rows are removed by the
+// database cascade.
+func (s *ApiServer) deleteAccountHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, err := sessionUserFromContext(r)
+		if err != nil {
+			return err
+		}
+
+		if err := s.deleteUserObjects(r.Context(), user.Id); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		if err := s.store.Users.DeleteUser(r.Context(), user.Id); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		if err := encode(ApiResponse[struct{}]{
+			Message: "account deleted",
+		}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		return nil
+	})
+}
+
+// deleteUserObjects deletes every S3 object stored under the user's prefix.
+func (s *ApiServer) deleteUserObjects(ctx context.Context, userId uuid.UUID) error {
+	paginator := s3.NewListObjectsV2Paginator(s.s3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.config.S3Bucket),
+		Prefix: aws.String(reports.UserPrefix(userId)),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list objects of user %s: %w", userId, err)
+		}
+		if len(page.Contents) == 0 {
+			continue
+		}
+		objects := make([]types.ObjectIdentifier, 0, len(page.Contents))
+		for _, object := range page.Contents {
+			objects = append(objects, types.ObjectIdentifier{Key: object.Key})
+		}
+		output, err := s.s3Client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(s.config.S3Bucket),
+			Delete: &types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete objects of user %s: %w", userId, err)
+		}
+		if len(output.Errors) > 0 {
+			return fmt.Errorf("failed to delete %d objects of user %s: %s", len(output.Errors), userId, aws.ToString(output.Errors[0].Message))
+		}
+	}
+	return nil
+}
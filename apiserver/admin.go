@@ -0,0 +1,304 @@
+package apiserver
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"asyncapi/store"
+)
+
+const (
+	defaultAdminPageSize = 50
+	maxAdminPageSize     = 200
+)
+
+// AdminUserResponse is a user as seen by admins.
+type AdminUserResponse struct {
+	Id                uuid.UUID  `json:"id"`
+	Email             string     `json:"email"`
+	Role              string     `json:"role"`
+	CreatedAt         time.Time  `json:"created_at"`
+	VerifiedAt        *time.Time `json:"verified_at,omitempty"`
+	MfaEnabled        bool       `json:"mfa_enabled"`
+	DisabledAt        *time.Time `json:"disabled_at,omitempty"`
+	SessionsRevokedAt *time.Time `json:"sessions_revoked_at,omitempty"`
+}
+
+func newAdminUserResponse(user *store.User) AdminUserResponse {
+	return AdminUserResponse{
+		Id:                user.Id,
+		Email:             user.Email,
+		Role:              user.Role,
+		CreatedAt:         user.CreatedAt,
+		VerifiedAt:        user.VerifiedAt,
+		MfaEnabled:        user.MfaEnabled(),
+		DisabledAt:        user.DisabledAt,
+		SessionsRevokedAt: user.SessionsRevokedAt,
+	}
+}
+
+// pagination reads the limit and offset query parameters.
+func pagination(r *http.Request) (limit int, offset int, err error) {
+	limit = defaultAdminPageSize
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxAdminPageSize {
+			return 0, 0, NewErrWithStatus(http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d", maxAdminPageSize))
+		}
+	}
+	if v := r.URL.Query().Get("offset"); v != "" {
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return 0, 0, NewErrWithStatus(http.StatusBadRequest, errors.New("offset must be a positive number"))
+		}
+	}
+	return limit, offset, nil
+}
+
+// userFromPath loads the user whose ID is in the path.
+func (s *ApiServer) userFromPath(r *http.Request) (*store.User, error) {
+	userId, err := uuid.Parse(r.PathValue("userId"))
+	if err != nil {
+		return nil, NewErrWithStatus(http.StatusBadRequest, err)
+	}
+	user, err := s.store.Users.GetUserByID(r.Context(), userId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, NewErrWithStatus(http.StatusNotFound, errors.New("user not found")).WithCode(CodeUserNotFound)
+		}
+		return nil, NewErrWithStatus(http.StatusInternalServerError, err)
+	}
+	return user, nil
+}
+
+// adminListUsersHandler lists users, newest first, optionally those whose
+// email contains ?q=.
+func (s *ApiServer) adminListUsersHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		limit, offset, err := pagination(r)
+		if err != nil {
+			return err
+		}
+		users, err := s.store.Users.ListUsers(r.Context(), store.UserFilter{
+			Query:  r.URL.Query().Get("q"),
+			Limit:  limit,
+			Offset: offset,
+		})
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		response := make([]AdminUserResponse, 0, len(users))
+		for i := range users {
+			response = append(response, newAdminUserResponse(&users[i]))
+		}
+
+		if err := encode(ApiResponse[[]AdminUserResponse]{Data: &response}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		return nil
+	})
+}
+
+func (s *ApiServer) adminGetUserHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, err := s.userFromPath(r)
+		if err != nil {
+			return err
+		}
+		response := newAdminUserResponse(user)
+		if err := encode(ApiResponse[AdminUserResponse]{Data: &response}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		return nil
+	})
+}
+
+// adminSetDisabledHandler disables or re-enables an account. A disabled user
+// can't sign in and every request they make is refused, and their refresh
+// tokens are deleted.
+func (s *ApiServer) adminSetDisabledHandler(disabled bool) http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, err := s.userFromPath(r)
+		if err != nil {
+			return err
+		}
+		if admin, ok := UserFromContext(r.Context()); ok && admin.Id == user.Id && disabled {
+			return NewErrWithStatus(http.StatusBadRequest, errors.New("admins can't disable their own account"))
+		}
+
+		user, err = s.store.Users.SetDisabled(r.Context(), user.Id, disabled)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		if disabled {
+			if _, err := s.store.RefreshTokenStore.DeleteUserTokens(r.Context(), user.Id); err != nil {
+				return NewErrWithStatus(http.StatusInternalServerError, err)
+			}
+		}
+
+		response := newAdminUserResponse(user)
+		if err := encode(ApiResponse[AdminUserResponse]{Data: &response}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		return nil
+	})
+}
+
+// adminLogoutUserHandler signs the user out everywhere: their refresh tokens
+// are deleted and the access tokens issued so far stop being accepted. API
+// keys are not affected and have to be revoked separately.
+func (s *ApiServer) adminLogoutUserHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, err := s.userFromPath(r)
+		if err != nil {
+			return err
+		}
+		if err := s.store.Users.RevokeSessions(r.Context(), user.Id); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		if _, err := s.store.RefreshTokenStore.DeleteUserTokens(r.Context(), user.Id); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		if err := encode(ApiResponse[struct{}]{
+			Message: "user signed out",
+		}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		return nil
+	})
+}
+
+// adminUnlockUserHandler clears the signin lockout of the account.
+func (s *ApiServer) adminUnlockUserHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, err := s.userFromPath(r)
+		if err != nil {
+			return err
+		}
+		if err := s.store.SigninFailures.Reset(r.Context(), store.AccountKey(user.Email)); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		if err := encode(ApiResponse[struct{}]{
+			Message: "user unlocked",
+		}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		return nil
+	})
+}
+
+// adminListReportsHandler lists the reports of every user, newest first,
+// filtered by the user_id, report_type, status, created_after and
+// created_before (RFC 3339) query parameters.
+func (s *ApiServer) adminListReportsHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		limit, offset, err := pagination(r)
+		if err != nil {
+			return err
+		}
+		query := r.URL.Query()
+		filter := store.ReportFilter{
+			ReportType: query.Get("report_type"),
+			Status:     query.Get("status"),
+			Limit:      limit,
+			Offset:     offset,
+		}
+		if v := query.Get("user_id"); v != "" {
+			userId, err := uuid.Parse(v)
+			if err != nil {
+				return NewErrWithStatus(http.StatusBadRequest, fmt.Errorf("invalid user_id: %w", err))
+			}
+			filter.UserId = &userId
+		}
+		if filter.Status != "" && !store.ValidReportStatus(filter.Status) {
+			return NewErrWithStatus(http.StatusBadRequest, fmt.Errorf("unknown status %q", filter.Status))
+		}
+		for name, dst := range map[string]**time.Time{"created_after": &filter.CreatedAfter, "created_before": &filter.CreatedBefore} {
+			if v := query.Get(name); v != "" {
+				t, err := time.Parse(time.RFC3339, v)
+				if err != nil {
+					return NewErrWithStatus(http.StatusBadRequest, fmt.Errorf("invalid %s: %w", name, err))
+				}
+				*dst = &t
+			}
+		}
+
+		reports, err := s.store.ReportStore.ListReports(r.Context(), filter)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		response := make([]ApiReport, 0, len(reports))
+		for i := range reports {
+			response = append(response, *newApiReport(&reports[i]))
+		}
+
+		if err := encode(ApiResponse[[]ApiReport]{Data: &response}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		return nil
+	})
+}
+
+// adminGetReportHandler returns any report, including its error message.
+func (s *ApiServer) adminGetReportHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		reportId, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+		report, err := s.store.ReportStore.GetById(r.Context(), reportId)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		return s.writeReport(w, r, report)
+	})
+}
+
+// adminRequeueReportHandler resets a failed or stuck report and sends it to
+// the worker again. Completed reports can't be requeued.
+func (s *ApiServer) adminRequeueReportHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		reportId, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+		report, err := s.store.ReportStore.GetById(r.Context(), reportId)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		if report == nil {
+			return NewErrWithStatus(http.StatusNotFound, errors.New("report not found")).WithCode(CodeReportNotFound)
+		}
+		if report.CompletedAt != nil {
+			return NewErrWithStatus(http.StatusConflict, errors.New("report already completed"))
+		}
+
+		report, err = s.store.ReportStore.ResetForRetry(r.Context(), reportId)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, sql.ErrNoRows) {
+				//completed in the meantime
+				status = http.StatusConflict
+			}
+			return NewErrWithStatus(status, err)
+		}
+		if err := s.enqueueReport(r.Context(), report); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		if err := encode(ApiResponse[ApiReport]{
+			Data: newApiReport(report),
+		}, http.StatusAccepted, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,181 @@
+package apiserver
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"asyncapi/store"
+)
+
+type CreateApiKeyRequest struct {
+	Name string `json:"name"`
+	// Scopes default to reports:read, see ApiKeyScopes.
+	Scopes    []string   `json:"scopes,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+func (r CreateApiKeyRequest) Validate() error {
+	var errs ValidationErrors
+	if r.Name == "" {
+		errs.Add("name", "name is required")
+	} else if len(r.Name) > 100 {
+		errs.Add("name", "name must be at most 100 characters long")
+	}
+	if slices.Contains(r.Scopes, "") {
+		errs.Add("scopes", "scopes must not be empty strings")
+	}
+	if r.ExpiresAt != nil && r.ExpiresAt.Before(time.Now()) {
+		errs.Add("expires_at", "expires_at must be in the future")
+	}
+	return errs.Err()
+}
+
+type ApiKeyResponse struct {
+	Id         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	// Key is the secret key, only returned once when the key is created.
+	Key string `json:"key,omitempty"`
+}
+
+func newApiKeyResponse(key *store.ApiKey) ApiKeyResponse {
+	return ApiKeyResponse{
+		Id:         key.Id,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     key.Scopes,
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		RevokedAt:  key.RevokedAt,
+		CreatedAt:  key.CreatedAt,
+	}
+}
+
+// sessionUserFromContext returns the signed in user, refusing requests made
+// with an API key or by an OAuth client so that leaked machine credentials
+// can't be used to take over the account.
+func sessionUserFromContext(r *http.Request) (*store.User, error) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		return nil, NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+	}
+	if _, ok := ApiKeyFromContext(r.Context()); ok {
+		return nil, NewErrWithStatus(http.StatusForbidden, errors.New("this operation requires signing in, api keys are not accepted")).WithCode(CodeSignInRequired).Public()
+	}
+	if principal, ok := PrincipalFromContext(r.Context()); ok && principal.IsClient() {
+		return nil, NewErrWithStatus(http.StatusForbidden, errors.New("this operation requires signing in, oauth clients are not accepted")).WithCode(CodeSignInRequired).Public()
+	}
+	return user, nil
+}
+
+// requireSession wraps the handler of a session route, see route.session, so
+// it is only reached by signed in users.
+func requireSession(next http.Handler) http.Handler {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		if _, err := sessionUserFromContext(r); err != nil {
+			return err
+		}
+		next.ServeHTTP(w, r)
+		return nil
+	})
+}
+
+// createApiKeyHandler issues a new API key for the signed in user. The secret
+// key is only part of this response.
+func (s *ApiServer) createApiKeyHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		req, err := decode[CreateApiKeyRequest](r)
+		if err != nil {
+			return err
+		}
+		user, err := sessionUserFromContext(r)
+		if err != nil {
+			return err
+		}
+
+		//a key can't be granted more than the role of its owner allows
+		req.Scopes = ApiKeyScopes(req.Scopes)
+		allowed := ScopesForRole(user.Role)
+		for _, scope := range req.Scopes {
+			if !slices.Contains(allowed, scope) {
+				return NewErrWithStatus(http.StatusBadRequest, fmt.Errorf("scope %q is unknown or not allowed", scope))
+			}
+		}
+
+		raw, key, err := s.store.ApiKeys.Create(r.Context(), user.Id, req.Name, req.Scopes, req.ExpiresAt)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		response := newApiKeyResponse(key)
+		response.Key = raw
+
+		if err := encode(ApiResponse[ApiKeyResponse]{Data: &response}, http.StatusCreated, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		return nil
+	})
+}
+
+// listApiKeysHandler lists the API keys of the signed in user.
+func (s *ApiServer) listApiKeysHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, err := sessionUserFromContext(r)
+		if err != nil {
+			return err
+		}
+
+		keys, err := s.store.ApiKeys.ListByUser(r.Context(), user.Id)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		response := make([]ApiKeyResponse, 0, len(keys))
+		for i := range keys {
+			response = append(response, newApiKeyResponse(&keys[i]))
+		}
+
+		if err := encode(ApiResponse[[]ApiKeyResponse]{Data: &response}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		return nil
+	})
+}
+
+// revokeApiKeyHandler revokes one of the API keys of the signed in user.
+func (s *ApiServer) revokeApiKeyHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		keyId, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+		user, err := sessionUserFromContext(r)
+		if err != nil {
+			return err
+		}
+
+		key, err := s.store.ApiKeys.Revoke(r.Context(), user.Id, keyId)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, sql.ErrNoRows) {
+				status = http.StatusNotFound
+			}
+			return NewErrWithStatus(status, err)
+		}
+		response := newApiKeyResponse(key)
+
+		if err := encode(ApiResponse[ApiKeyResponse]{Data: &response}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		return nil
+	})
+}
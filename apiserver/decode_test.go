@@ -0,0 +1,145 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"asyncapi/passwords"
+)
+
+func TestDecode(t *testing.T) {
+	h := NewBodyLimitMiddleware(64)(handler(func(w http.ResponseWriter, r *http.Request) error {
+		req, err := decode[SigninRequest](r)
+		if err != nil {
+			return err
+		}
+		return encode(ApiResponse[SigninRequest]{Data: &req}, http.StatusOK, w)
+	}))
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		code        string
+		field       string
+	}{
+		{name: "valid", contentType: "application/json; charset=utf-8", body: `{"email":"test@test.com","password":"secret"}`, status: http.StatusOK},
+		{name: "no content type", body: `{"email":"test@test.com","password":"secret"}`, status: http.StatusUnsupportedMediaType, code: CodeUnsupportedMediaType},
+		{name: "form", contentType: "application/x-www-form-urlencoded", body: `email=test`, status: http.StatusUnsupportedMediaType, code: CodeUnsupportedMediaType},
+		{name: "too large", contentType: "application/json", body: `{"email":"` + strings.Repeat("a", 100) + `"}`, status: http.StatusRequestEntityTooLarge, code: CodeBodyTooLarge},
+		{name: "empty", contentType: "application/json", status: http.StatusBadRequest, code: CodeInvalidJson},
+		{name: "malformed", contentType: "application/json", body: `{"email":`, status: http.StatusBadRequest, code: CodeInvalidJson},
+		{name: "unknown field", contentType: "application/json", body: `{"email":"test@test.com","password":"secret","admin":true}`, status: http.StatusBadRequest, code: CodeInvalidJson, field: "admin"},
+		{name: "wrong type", contentType: "application/json", body: `{"email":"test@test.com","password":1}`, status: http.StatusBadRequest, code: CodeInvalidJson, field: "password"},
+		{name: "trailing data", contentType: "application/json", body: `{"email":"test@test.com","password":"secret"}{}`, status: http.StatusBadRequest, code: CodeInvalidJson},
+		{name: "invalid", contentType: "application/json", body: `{"email":"test@test.com"}`, status: http.StatusBadRequest, code: CodeValidationFailed, field: "password"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/auth/signin", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			//the limit must also hold when the length is not declared
+			r.ContentLength = -1
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			require.Equal(t, tt.status, w.Code)
+			if tt.status == http.StatusOK {
+				return
+			}
+			require.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+			var problem Problem
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&problem))
+			require.Equal(t, tt.code, problem.Code)
+			if tt.field != "" {
+				require.Len(t, problem.Errors, 1)
+				require.Equal(t, tt.field, problem.Errors[0].Field)
+			}
+		})
+	}
+}
+
+func TestDecodePassword(t *testing.T) {
+	policy, err := passwords.NewPolicy(12, passwords.MaxBcryptLength, bcrypt.MinCost, []string{"breached password"})
+	require.NoError(t, err)
+	do := func(body string, decode func(r *http.Request) error) *Problem {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler(func(w http.ResponseWriter, r *http.Request) error {
+			if err := decode(r); err != nil {
+				return err
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return nil
+		}).ServeHTTP(w, r)
+		if w.Code == http.StatusNoContent {
+			return nil
+		}
+		var problem Problem
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&problem))
+		require.Equal(t, CodeValidationFailed, problem.Code)
+		return &problem
+	}
+	signup := func(r *http.Request) error {
+		_, err := decodePassword[SignupRequest](r, policy)
+		return err
+	}
+	change := func(r *http.Request) error {
+		_, err := decodePassword[ChangePasswordRequest](r, policy)
+		return err
+	}
+
+	require.Nil(t, do(`{"email":"test@test.com","password":"long enough password"}`, signup))
+	//the policy given to the server applies, not a default one
+	problem := do(`{"email":"test@test.com","password":"password"}`, signup)
+	require.NotNil(t, problem)
+	require.Equal(t, []FieldError{{Field: "password", Message: "password must be at least 12 characters long"}}, problem.Errors)
+	//policy errors are reported along with the other invalid fields
+	problem = do(`{"email":"test","password":"Breached Password"}`, signup)
+	require.NotNil(t, problem)
+	require.Len(t, problem.Errors, 2)
+	require.Equal(t, "email", problem.Errors[0].Field)
+	require.Equal(t, "password", problem.Errors[1].Field)
+	//a missing password is only reported once
+	problem = do(`{"email":"test@test.com"}`, signup)
+	require.NotNil(t, problem)
+	require.Len(t, problem.Errors, 1)
+
+	problem = do(`{"current_password":"x","new_password":"short"}`, change)
+	require.NotNil(t, problem)
+	require.Len(t, problem.Errors, 1)
+	require.Equal(t, "new_password", problem.Errors[0].Field)
+}
+
+func TestProblemFromError_Detail(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/auth/oidc/callback", nil)
+	tests := []struct {
+		name   string
+		err    error
+		detail string
+	}{
+		{name: "client error", err: NewErrWithStatus(http.StatusConflict, errors.New("user already exists")), detail: "user already exists"},
+		{name: "wrapped 401", err: NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("token endpoint: %w", errors.New(`{"error":"invalid_client","secret":"s3cr3t"}`)))},
+		{name: "wrapped 403", err: NewErrWithStatus(http.StatusForbidden, errors.New("pq: relation users does not exist"))},
+		{name: "public 403", err: NewErrWithStatus(http.StatusForbidden, errors.New("account disabled")).Public(), detail: "account disabled"},
+		{name: "server error", err: NewErrWithStatus(http.StatusInternalServerError, errors.New("pq: connection refused")).Public()},
+		{name: "plain error", err: errors.New("pq: connection refused")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.detail, problemFromError(r, tt.err).Detail)
+		})
+	}
+}
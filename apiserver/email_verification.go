@@ -0,0 +1,127 @@
+package apiserver
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+
+	"asyncapi/mailer"
+	"asyncapi/store"
+)
+
+// validateEmail checks that email is a bare address such as user@example.com,
+// rejecting display names ("Name <user@example.com>") and domains without a dot.
+func validateEmail(email string) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return fmt.Errorf("email %q is not a valid email address", email)
+	}
+	at := strings.LastIndex(email, "@")
+	if domain := email[at+1:]; !strings.Contains(domain, ".") || strings.HasSuffix(domain, ".") {
+		return fmt.Errorf("email %q is not a valid email address", email)
+	}
+	return nil
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+func (r VerifyEmailRequest) Validate() error {
+	var errs ValidationErrors
+	if r.Token == "" {
+		errs.Add("token", "token is required")
+	}
+	return errs.Err()
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email"`
+}
+
+func (r ResendVerificationRequest) Validate() error {
+	var errs ValidationErrors
+	if r.Email == "" {
+		errs.Add("email", "email is required")
+	}
+	return errs.Err()
+}
+
+// sendVerificationEmail issues a new verification token for the user and
+// emails it to them.
+func (s *ApiServer) sendVerificationEmail(ctx context.Context, user *store.User) error {
+	token, _, err := s.store.Verifications.Create(ctx, user.Id, s.config.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Use the following token to verify your email address. It expires in %s.\n\n%s\n",
+			s.config.EmailVerificationTTL, token),
+	})
+}
+
+// verifyEmailHandler consumes an email verification token and marks the
+// owning user as verified.
+func (s *ApiServer) verifyEmailHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		req, err := decode[VerifyEmailRequest](r)
+		if err != nil {
+			return err
+		}
+
+		token, err := s.store.Verifications.Consume(r.Context(), req.Token)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return NewErrWithStatus(http.StatusBadRequest, errors.New("invalid or expired verification token"))
+			}
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		if _, err := s.store.Users.MarkVerified(r.Context(), token.UserId); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		if err := encode(ApiResponse[struct{}]{
+			Message: "email address verified",
+		}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		return nil
+	})
+}
+
+// resendVerificationHandler emails a new verification token, replacing the
+// previous one, to an account whose email is not verified yet. Like
+// forgotPasswordHandler it responds with 202 whether or not such an account
+// exists, and it is rate limited with the other /auth routes.
+func (s *ApiServer) resendVerificationHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		req, err := decode[ResendVerificationRequest](r)
+		if err != nil {
+			return err
+		}
+
+		user, err := s.store.Users.GetUserByEmail(r.Context(), req.Email)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		if user != nil && user.VerifiedAt == nil {
+			if err := s.sendVerificationEmail(r.Context(), user); err != nil {
+				s.logger.ErrorContext(r.Context(), "failed to resend verification email", "user_id", user.Id, "error", err)
+			}
+		}
+
+		if err := encode(ApiResponse[struct{}]{
+			Message: "if the account exists and is not verified, a verification email has been sent",
+		}, http.StatusAccepted, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,53 @@
+package apiserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResendVerification(t *testing.T) {
+	s, mails := newStoreTestServer(t)
+	s.config.RateLimitAuthPerMinute = 1
+	s.config.RateLimitAuthBurst = 3
+	h, _ := s.handler()
+	ctx := context.Background()
+	user, err := s.store.Users.CreateUser(ctx, "test@test.com", "testpassword")
+	require.NoError(t, err)
+	verified, err := s.store.Users.CreateUser(ctx, "verified@test.com", "testpassword")
+	require.NoError(t, err)
+	_, err = s.store.Users.MarkVerified(ctx, verified.Id)
+	require.NoError(t, err)
+
+	resend := func(email string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/auth/verify-email/resend", strings.NewReader(`{"email":"`+email+`"}`))
+		r.Header.Set("Content-Type", "application/json")
+		r.RemoteAddr = "10.0.0.1:1234"
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	//the response doesn't tell whether the account exists
+	sent := resend("test@test.com")
+	require.Equal(t, http.StatusAccepted, sent.Code)
+	unknown := resend("unknown@test.com")
+	require.Equal(t, http.StatusAccepted, unknown.Code)
+	require.Equal(t, sent.Body.String(), unknown.Body.String())
+	require.Equal(t, http.StatusAccepted, resend("verified@test.com").Code)
+
+	messages := mails.sent()
+	require.Len(t, messages, 1)
+	require.Equal(t, "test@test.com", messages[0].To)
+	token := strings.TrimSpace(messages[0].Body[strings.LastIndex(messages[0].Body, "\n\n"):])
+	verification, err := s.store.Verifications.Consume(ctx, token)
+	require.NoError(t, err)
+	require.Equal(t, user.Id, verification.UserId)
+
+	require.Equal(t, http.StatusTooManyRequests, resend("test@test.com").Code)
+	require.Len(t, mails.sent(), 1)
+}
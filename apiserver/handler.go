@@ -1,6 +1,7 @@
 package apiserver
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -11,9 +12,15 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 
-	"asyncapi/reports"
+	"asyncapi/messages"
+	"asyncapi/store"
+	"asyncapi/tracing"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type SigninRequest struct {
@@ -22,8 +29,12 @@ type SigninRequest struct {
 }
 
 type SigninResponse struct {
-	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
+	AccessToken  string `json:"access_token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	// MfaRequired is set instead of the tokens when the user has two-factor
+	// authentication enabled; MfaToken must then be sent to /auth/mfa/verify.
+	MfaRequired bool   `json:"mfa_required,omitempty"`
+	MfaToken    string `json:"mfa_token,omitempty"`
 }
 type SignupRequest struct {
 	Email    string `json:"email"`
@@ -37,16 +48,25 @@ type ApiResponse[T any] struct {
 
 // Validate checks the SignupRequest fields for required values.
 // It returns an error if the Email or Password fields are empty,
-// indicating that both fields are mandatory for a valid signup request.
+// indicating that both fields are mandatory for a valid signup request,
+// or if the Email is not a syntactically valid address. The password policy
+// is checked by decodePassword.
 
 func (r SignupRequest) Validate() error {
+	var errs ValidationErrors
 	if r.Email == "" {
-		return errors.New("email is required")
+		errs.Add("email", "email is required")
+	} else if err := validateEmail(r.Email); err != nil {
+		errs.Add("email", err.Error())
 	}
 	if r.Password == "" {
-		return errors.New("password is required")
+		errs.Add("password", "password is required")
 	}
-	return nil
+	return errs.Err()
+}
+
+func (r SignupRequest) PasswordField() (string, string) {
+	return "password", r.Password
 }
 
 // signupHandler handles user signup requests. It decodes the incoming request
@@ -61,22 +81,27 @@ func (s *ApiServer) signupHandler() http.HandlerFunc {
 
 	return handler(func(w http.ResponseWriter, r *http.Request) error {
 
-		req, err := decode[SignupRequest](r)
+		req, err := decodePassword[SignupRequest](r, s.passwords)
 		if err != nil {
-			return NewErrWithStatus(http.StatusBadRequest, fmt.Errorf("failed to decode signup request: %w", err))
+			return err
 		}
 		existingUser, err := s.store.Users.GetUserByEmail(r.Context(), req.Email)
 		if err != nil && !errors.Is(err, sql.ErrNoRows) {
 			return NewErrWithStatus(http.StatusInternalServerError, err)
 		}
 		if existingUser != nil {
-			return NewErrWithStatus(http.StatusConflict, fmt.Errorf("user exists: %v", existingUser))
+			return NewErrWithStatus(http.StatusConflict, errors.New("email is already registered")).WithCode(CodeEmailTaken)
 		}
 
-		_, err = s.store.Users.CreateUser(r.Context(), req.Email, req.Password)
+		user, err := s.store.Users.CreateUser(r.Context(), req.Email, req.Password)
 		if err != nil {
 			return NewErrWithStatus(http.StatusInternalServerError, fmt.Errorf("failed to create the user: %w", err))
 		}
+		//the account is usable right away, a failed email can be resent with
+		//POST /auth/verify-email/resend
+		if err := s.sendVerificationEmail(r.Context(), user); err != nil {
+			s.logger.ErrorContext(r.Context(), "failed to send verification email", "user_id", user.Id, "error", err)
+		}
 
 		if err := encode[ApiResponse[struct{}]](ApiResponse[struct{}]{
 			Message: "successfully signed up user",
@@ -88,13 +113,14 @@ func (s *ApiServer) signupHandler() http.HandlerFunc {
 
 }
 func (r SigninRequest) Validate() error {
+	var errs ValidationErrors
 	if r.Email == "" {
-		return errors.New("email is required")
+		errs.Add("email", "email is required")
 	}
 	if r.Password == "" {
-		return errors.New("password is required")
+		errs.Add("password", "password is required")
 	}
-	return nil
+	return errs.Err()
 }
 
 // function signin handler
@@ -102,49 +128,100 @@ func (s *ApiServer) signinHandler() http.HandlerFunc {
 	return handler(func(w http.ResponseWriter, r *http.Request) error {
 		req, err := decode[SigninRequest](r)
 		if err != nil {
-			return NewErrWithStatus(http.StatusBadRequest, err)
+			return err
+		}
+
+		ip := clientIP(r)
+		if err := s.checkSigninLockout(r.Context(), w, req.Email, ip); err != nil {
+			return err
 		}
 
 		user, err := s.store.Users.GetUserByEmail(r.Context(), req.Email)
 		if err != nil && !errors.Is(err, sql.ErrNoRows) {
 			return NewErrWithStatus(http.StatusInternalServerError, err)
 		}
-		//copare password
-		if err := user.ComparePassword(req.Password); err != nil {
-			return NewErrWithStatus(http.StatusUnauthorized, err)
+		//copare password, spending the same time on unknown emails
+		if user != nil {
+			err = user.ComparePassword(req.Password)
+		} else {
+			s.store.Users.CompareDummyPassword(req.Password)
 		}
-
-		//issue a token
-		tokenPair, err := s.jwtManager.GenerateTokenPair(user.Id)
 		if err != nil {
-			return NewErrWithStatus(http.StatusInternalServerError, err)
+			if err := s.recordSigninFailure(r.Context(), req.Email, ip); err != nil {
+				return NewErrWithStatus(http.StatusInternalServerError, err)
+			}
+			return NewErrWithStatus(http.StatusUnauthorized, errors.New("invalid email or password")).WithCode(CodeInvalidCredentials).Public()
 		}
-		//delete before creation of user token
-		_, err = s.store.RefreshTokenStore.DeleteUserTokens(r.Context(), user.Id)
-		if err != nil {
+		//only the account is reset, so one valid account can't clear an IP lockout
+		if err := s.store.SigninFailures.Reset(r.Context(), store.AccountKey(req.Email)); err != nil {
 			return NewErrWithStatus(http.StatusInternalServerError, err)
 		}
+		//upgrade hashes generated with a lower bcrypt cost while we know the password
+		if s.store.Users.NeedsRehash(user) {
+			if err := s.store.Users.UpdatePassword(r.Context(), user.Id, req.Password); err != nil {
+				s.logger.ErrorContext(r.Context(), "failed to rehash password", "user_id", user.Id, "error", err)
+			}
+		}
 
-		//create user tokens
-		_, err = s.store.RefreshTokenStore.Create(r.Context(), user.Id, tokenPair.RefreshToken)
+		return s.completeSignin(w, r, user)
+	})
+}
+
+// completeSignin ends a sign in whose first factor passed: users with MFA get
+// a challenge to answer on /auth/mfa/verify, others a TokenPair.
+func (s *ApiServer) completeSignin(w http.ResponseWriter, r *http.Request, user *store.User) error {
+	//a second factor is needed before any token is issued
+	if user.MfaEnabled() {
+		challenge, err := s.jwtManager.GenerateMfaChallengeToken(user.Id)
 		if err != nil {
 			return NewErrWithStatus(http.StatusInternalServerError, err)
 		}
-
 		if err := encode(ApiResponse[SigninResponse]{
 			Data: &SigninResponse{
-				AccessToken:  tokenPair.AccessToken.Raw,
-				RefreshToken: tokenPair.RefreshToken.Raw,
+				MfaRequired: true,
+				MfaToken:    challenge.Raw,
 			},
 		}, http.StatusOK, w); err != nil {
 			return NewErrWithStatus(http.StatusInternalServerError, err)
 		}
+		return nil
+	}
+	return s.issueTokenPair(w, r, user)
+}
 
-		//persists token
+// issueTokenPair generates a new token pair for the user, replaces their
+// persisted refresh tokens with the new one and writes it as a SigninResponse.
+func (s *ApiServer) issueTokenPair(w http.ResponseWriter, r *http.Request, user *store.User) error {
+	if user.Disabled() {
+		return NewErrWithStatus(http.StatusForbidden, errors.New("account disabled")).WithCode(CodeAccountDisabled).Public()
+	}
+	userId := user.Id
+	//issue a token carrying every scope of the user's role
+	tokenPair, err := s.jwtManager.GenerateTokenPair(userId, ScopesForRole(user.Role)...)
+	if err != nil {
+		return NewErrWithStatus(http.StatusInternalServerError, err)
+	}
+	//delete before creation of user token
+	_, err = s.store.RefreshTokenStore.DeleteUserTokens(r.Context(), userId)
+	if err != nil {
+		return NewErrWithStatus(http.StatusInternalServerError, err)
+	}
 
-		return nil
+	//create user tokens
+	_, err = s.store.RefreshTokenStore.Create(r.Context(), userId, tokenPair.RefreshToken)
+	if err != nil {
+		return NewErrWithStatus(http.StatusInternalServerError, err)
+	}
 
-	})
+	if err := encode(ApiResponse[SigninResponse]{
+		Data: &SigninResponse{
+			AccessToken:  tokenPair.AccessToken.Raw,
+			RefreshToken: tokenPair.RefreshToken.Raw,
+		},
+	}, http.StatusOK, w); err != nil {
+		return NewErrWithStatus(http.StatusInternalServerError, err)
+	}
+	return nil
 }
 
 type TokenRefreshRequest struct {
@@ -157,10 +234,11 @@ type TokenRefreshResponse struct {
 }
 
 func (r TokenRefreshRequest) Validate() error {
+	var errs ValidationErrors
 	if r.RefreshToken == "" {
-		return errors.New("refresh token is required")
+		errs.Add("refresh_token", "refresh token is required")
 	}
-	return nil
+	return errs.Err()
 }
 
 // Validate checks the CreateReportRequest fields for required values.
@@ -168,10 +246,11 @@ func (r TokenRefreshRequest) Validate() error {
 // that this field is mandatory for a valid report creation request.
 
 func (r CreateReportRequest) Validate() error {
+	var errs ValidationErrors
 	if r.ReportType == "" {
-		return errors.New("report_type is required")
+		errs.Add("report_type", "report_type is required")
 	}
-	return nil
+	return errs.Err()
 }
 
 func (s *ApiServer) tokenRefreshHandler() http.HandlerFunc {
@@ -179,23 +258,26 @@ func (s *ApiServer) tokenRefreshHandler() http.HandlerFunc {
 
 		req, err := decode[TokenRefreshRequest](r)
 		if err != nil {
-			return NewErrWithStatus(http.StatusBadRequest, fmt.Errorf("error decoding request body: %w", err))
+			return err
 		}
 
 		// Parse the token
 		currentRefreshToken, err := s.jwtManager.Parse(req.RefreshToken)
 		if err != nil {
-			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("invalid refresh token: %w", err))
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("invalid refresh token: %w", err)).WithCode(tokenErrorCode(err))
+		}
+		if !s.jwtManager.IsRefreshToken(currentRefreshToken) {
+			return NewErrWithStatus(http.StatusUnauthorized, errors.New("not a refresh token")).WithCode(CodeInvalidToken).Public()
 		}
 
 		userIdStr, err := currentRefreshToken.Claims.GetSubject()
 		if err != nil {
-			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("failed to get subject from token: %w", err))
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("failed to get subject from token: %w", err)).WithCode(CodeInvalidToken)
 		}
 
 		userId, err := uuid.Parse(userIdStr)
 		if err != nil {
-			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("invalid user ID in token: %w", err))
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("invalid user ID in token: %w", err)).WithCode(CodeInvalidToken)
 		}
 
 		currentRefreshTokenRecord, err := s.store.RefreshTokenStore.ByPrimaryKey(r.Context(), userId, currentRefreshToken)
@@ -209,11 +291,24 @@ func (s *ApiServer) tokenRefreshHandler() http.HandlerFunc {
 
 		// Verify the current refresh token is not expired
 		if currentRefreshTokenRecord.ExpiresAt.Before(time.Now()) {
-			return NewErrWithStatus(http.StatusUnauthorized, errors.New("refresh token expired"))
+			return NewErrWithStatus(http.StatusUnauthorized, errors.New("refresh token expired")).WithCode(CodeTokenExpired).Public()
+		}
+
+		//the role may have changed since the previous token was issued
+		user, err := s.store.Users.GetUserByID(r.Context(), userId)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, sql.ErrNoRows) {
+				status = http.StatusUnauthorized
+			}
+			return NewErrWithStatus(status, fmt.Errorf("failed to fetch user: %w", err))
+		}
+		if user.Disabled() {
+			return NewErrWithStatus(http.StatusForbidden, errors.New("account disabled")).WithCode(CodeAccountDisabled).Public()
 		}
 
 		// Generate a new token pair, delete old tokens, and persist the new ones
-		tokenPair, err := s.jwtManager.GenerateTokenPair(userId)
+		tokenPair, err := s.jwtManager.GenerateTokenPair(userId, ScopesForRole(user.Role)...)
 		if err != nil {
 			return NewErrWithStatus(http.StatusInternalServerError, fmt.Errorf("failed to generate token pair: %w", err))
 		}
@@ -241,10 +336,13 @@ func (s *ApiServer) tokenRefreshHandler() http.HandlerFunc {
 
 type CreateReportRequest struct {
 	ReportType string `json:"report_type"`
+	// OrgId shares the report with the members of the organization.
+	OrgId *uuid.UUID `json:"org_id,omitempty"`
 }
 type ApiReport struct {
-	// The ID of the user who owns the report.
 	Id                   uuid.UUID  `json:"id"`                                // The unique ID of the report.
+	UserId               uuid.UUID  `json:"user_id"`                           // The ID of the user who created the report.
+	OrgId                *uuid.UUID `json:"org_id,omitempty"`                  // The organization the report is shared with.
 	ReportType           string     `json:"report_type,omitempty"`             // The type of the report (e.g., "summary", "detailed").
 	OutputFilePath       *string    `json:"output_file_path,omitempty"`        // The file path where the report is stored.
 	DownloadUrl          *string    `json:"download_url,omitempty"`            // The URL to download the report.
@@ -257,6 +355,24 @@ type ApiReport struct {
 	Status               string     `json:"status,omitempty"`
 }
 
+func newApiReport(report *store.Report) *ApiReport {
+	return &ApiReport{
+		Id:                   report.Id,
+		UserId:               report.UserId,
+		OrgId:                report.OrgId,
+		ReportType:           report.ReportType,
+		OutputFilePath:       report.OutputFilePath,
+		DownloadUrl:          report.DownloadUrl,
+		DownloadUrlExpiresAt: report.DownloadUrlExpiresAt,
+		ErrorMessage:         report.ErrorMessage,
+		CreatedAt:            report.CreatedAt,
+		StartedAt:            report.StartedAt,
+		CompletedAt:          report.CompletedAt,
+		FailedAt:             report.FailedAt,
+		Status:               report.Status(),
+	}
+}
+
 // createReportHandler is the HTTP handler to create a new report.
 //
 // Parameters:
@@ -275,50 +391,33 @@ func (s *ApiServer) createReportHandler() http.HandlerFunc {
 	return handler(func(w http.ResponseWriter, r *http.Request) error {
 		req, err := decode[CreateReportRequest](r)
 		if err != nil {
-			return NewErrWithStatus(http.StatusBadRequest, err)
+			return err
 		}
 		user, ok := UserFromContext(r.Context())
 		if !ok {
 			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
 		}
-		report, err := s.store.ReportStore.Create(r.Context(), user.Id, req.ReportType)
-		if err != nil {
-			return NewErrWithStatus(http.StatusInternalServerError, err)
+		if s.config.RequireVerifiedEmail && user.VerifiedAt == nil {
+			return NewErrWithStatus(http.StatusForbidden, errors.New("email address must be verified before creating reports")).WithCode(CodeEmailNotVerified).Public()
 		}
-		//send sqs message for report generation
-		//send as json
-		sqsMessage := reports.SqsMessage{
-			UserId:   report.UserId,
-			ReportId: report.Id,
+		if req.OrgId != nil {
+			if _, err := s.orgMembership(r, *req.OrgId, user.Id); err != nil {
+				return err
+			}
 		}
-		//get sqs queue url
-		queueUrlOutput, err := s.sqsClient.GetQueueUrl(r.Context(), &sqs.GetQueueUrlInput{
-			QueueName: aws.String(s.config.SqsQueue),
-		})
+		report, err := s.store.ReportStore.CreateWithinQuota(r.Context(), user.Id, req.OrgId, req.ReportType, s.reportQuota())
 		if err != nil {
+			var quotaErr *store.QuotaExceededError
+			if errors.As(err, &quotaErr) {
+				return NewErrWithStatus(http.StatusTooManyRequests, quotaErr).WithCode(CodeQuotaExceeded)
+			}
 			return NewErrWithStatus(http.StatusInternalServerError, err)
 		}
-		_, err = s.sqsClient.SendMessage(r.Context(), &sqs.SendMessageInput{
-			QueueUrl:    queueUrlOutput.QueueUrl, // Replace with your SQS queue URL
-			MessageBody: aws.String(fmt.Sprintf(`{"user_id":"%s","report_id":"%s"}`, sqsMessage.UserId, sqsMessage.ReportId)),
-		})
-		if err != nil {
-			return NewErrWithStatus(http.StatusInternalServerError, fmt.Errorf("failed to send SQS message: %w", err))
+		if err := s.enqueueReport(r.Context(), report); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
 		}
 		if err := encode(ApiResponse[ApiReport]{
-			Data: &ApiReport{
-				Id:                   report.Id,
-				ReportType:           report.ReportType,
-				OutputFilePath:       report.OutputFilePath,
-				DownloadUrl:          report.DownloadUrl,
-				DownloadUrlExpiresAt: report.DownloadUrlExpiresAt,
-				ErrorMessage:         report.ErrorMessage,
-				CreatedAt:            report.CreatedAt,
-				StartedAt:            report.StartedAt,
-				CompletedAt:          report.CompletedAt,
-				FailedAt:             report.FailedAt,
-				Status:               report.Status(),
-			},
+			Data: newApiReport(report),
 		}, int(http.StatusCreated), w); err != nil {
 			return NewErrWithStatus(http.StatusInternalServerError, err)
 		}
@@ -327,6 +426,70 @@ func (s *ApiServer) createReportHandler() http.HandlerFunc {
 	})
 }
 
+// reportMessageBody is the body of the SQS message asking the worker to build
+// the report, see reports.NewAsyncApiDocument.
+func reportMessageBody(ctx context.Context, report *store.Report) ([]byte, error) {
+	return messages.Marshal(ctx, messages.TypeGenerateReport, messages.GenerateReport{
+		UserId:   report.UserId,
+		ReportId: report.Id,
+	})
+}
+
+// enqueueReport sends the SQS message asking the worker to build the report.
+// A report that can't be enqueued is marked failed, otherwise it would count
+// against the in-flight quota of its user forever.
+func (s *ApiServer) enqueueReport(ctx context.Context, report *store.Report) error {
+	err := s.sendReportMessage(ctx, report)
+	if err == nil {
+		return nil
+	}
+	//the request may be cancelled already, the report must be failed anyway
+	if _, failErr := s.store.ReportStore.MarkFailed(context.WithoutCancel(ctx), report.Id, "failed to enqueue the report"); failErr != nil {
+		s.logger.ErrorContext(ctx, "failed to mark unqueued report failed", "report_id", report.Id, "error", failErr)
+	}
+	return err
+}
+
+func (s *ApiServer) sendReportMessage(ctx context.Context, report *store.Report) (err error) {
+	ctx, span := tracing.Tracer("apiserver").Start(ctx, "reports.enqueue",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemAWSSqs,
+			semconv.MessagingDestinationName(s.config.SqsQueue),
+			attribute.String("report.id", report.Id.String()),
+		),
+	)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	body, err := reportMessageBody(ctx, report)
+	if err != nil {
+		return err
+	}
+	//get sqs queue url
+	queueUrlOutput, err := s.sqsClient.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{
+		QueueName: aws.String(s.config.SqsQueue),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get SQS queue url: %w", err)
+	}
+	_, err = s.sqsClient.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    queueUrlOutput.QueueUrl,
+		MessageBody: aws.String(string(body)),
+		//the worker continues the trace of the request
+		MessageAttributes: tracing.InjectSqs(ctx),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send SQS message: %w", err)
+	}
+	return nil
+}
+
 // getReportHandler is the HTTP handler to retrieve a report.
 //
 // Parameters:
@@ -354,57 +517,98 @@ func (s *ApiServer) getReportHandler() http.HandlerFunc {
 			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
 		}
 
-		report, err := s.store.ReportStore.GetByPrimaryKey(r.Context(), user.Id, reportId)
+		report, err := s.store.ReportStore.GetById(r.Context(), reportId)
 		if err != nil {
-			status := http.StatusInternalServerError
-			if errors.Is(err, sql.ErrNoRows) {
-				status = http.StatusNotFound
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		if report != nil {
+			canRead, err := s.canReadReport(r, user, report)
+			if err != nil {
+				return err
 			}
-			return NewErrWithStatus(status, err)
-		}
-		//hasExpiration := report.DownloadUrlExpiresAt != nil && report.DownloadUrlExpiresAt.Before(time.Now())
-		if report.CompletedAt != nil {
-			needsRefesh := report.DownloadUrlExpiresAt != nil && report.DownloadUrlExpiresAt.Before(time.Now())
-			if report.DownloadUrl == nil || needsRefesh {
-				expiresAt := time.Now().Add(time.Second * 40)
-				signedUrl, err := s.presignClient.PresignGetObject(r.Context(), &s3.GetObjectInput{
-					Bucket: aws.String(s.config.S3Bucket),
-					Key:    report.OutputFilePath,
-				}, func(options *s3.PresignOptions) {
-					options.Expires = time.Second * 40
-				})
-				if err != nil {
-					return NewErrWithStatus(http.StatusInternalServerError, err)
-				}
-				//update the report
-				report.DownloadUrl = aws.String(signedUrl.URL)
-				report.DownloadUrlExpiresAt = &expiresAt
-				//update the report in db
-
-				report, err = s.store.ReportStore.Update(r.Context(), report)
-				if err != nil {
-					return NewErrWithStatus(http.StatusInternalServerError, err)
-				}
+			if !canRead {
+				//hide the report exists at all
+				report = nil
 			}
 		}
-		if err := encode(ApiResponse[ApiReport]{
-			Data: &ApiReport{
-				Id:                   report.Id,
-				ReportType:           report.ReportType,
-				OutputFilePath:       report.OutputFilePath,
-				DownloadUrl:          report.DownloadUrl,
-				DownloadUrlExpiresAt: report.DownloadUrlExpiresAt,
-				ErrorMessage:         report.ErrorMessage,
-				CreatedAt:            report.CreatedAt,
-				StartedAt:            report.StartedAt,
-				CompletedAt:          report.CompletedAt,
-				FailedAt:             report.FailedAt,
-				Status:               report.Status(),
-			},
-		}, http.StatusOK, w); err != nil {
+		return s.writeReport(w, r, report)
+	})
+}
+
+// canReadReport reports whether the user created the report, is a member of
+// the organization it is shared with or is an admin.
+func (s *ApiServer) canReadReport(r *http.Request, user *store.User, report *store.Report) (bool, error) {
+	if report.UserId == user.Id || HasScope(r.Context(), ScopeAdmin) {
+		return true, nil
+	}
+	if report.OrgId == nil {
+		return false, nil
+	}
+	_, err := s.store.Orgs.GetMembership(r.Context(), *report.OrgId, user.Id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, NewErrWithStatus(http.StatusInternalServerError, err)
+	}
+	return true, nil
+}
+
+// getUserReportHandler lets admins read the report of any user.
+func (s *ApiServer) getUserReportHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		userId, err := uuid.Parse(r.PathValue("userId"))
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+		reportId, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+		report, err := s.store.ReportStore.GetByPrimaryKey(r.Context(), userId, reportId)
+		if err != nil {
 			return NewErrWithStatus(http.StatusInternalServerError, err)
 		}
-
-		return nil
+		return s.writeReport(w, r, report)
 	})
 }
+
+// writeReport writes the report as an ApiReport, refreshing its download URL
+// first when the report is completed and the URL is missing or expired.
+// A nil report is written as a 404.
+func (s *ApiServer) writeReport(w http.ResponseWriter, r *http.Request, report *store.Report) error {
+	if report == nil {
+		return NewErrWithStatus(http.StatusNotFound, errors.New("report not found")).WithCode(CodeReportNotFound)
+	}
+	//hasExpiration := report.DownloadUrlExpiresAt != nil && report.DownloadUrlExpiresAt.Before(time.Now())
+	if report.CompletedAt != nil {
+		needsRefesh := report.DownloadUrlExpiresAt != nil && report.DownloadUrlExpiresAt.Before(time.Now())
+		if report.DownloadUrl == nil || needsRefesh {
+			expiresAt := time.Now().Add(time.Second * 40)
+			signedUrl, err := s.presignClient.PresignGetObject(r.Context(), &s3.GetObjectInput{
+				Bucket: aws.String(s.config.S3Bucket),
+				Key:    report.OutputFilePath,
+			}, func(options *s3.PresignOptions) {
+				options.Expires = time.Second * 40
+			})
+			if err != nil {
+				return NewErrWithStatus(http.StatusInternalServerError, err)
+			}
+			//update the report
+			report.DownloadUrl = aws.String(signedUrl.URL)
+			report.DownloadUrlExpiresAt = &expiresAt
+			//update the report in db
+
+			report, err = s.store.ReportStore.Update(r.Context(), report)
+			if err != nil {
+				return NewErrWithStatus(http.StatusInternalServerError, err)
+			}
+		}
+	}
+	if err := encode(ApiResponse[ApiReport]{
+		Data: newApiReport(report),
+	}, http.StatusOK, w); err != nil {
+		return NewErrWithStatus(http.StatusInternalServerError, err)
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package apiserver_test
+
+import (
+	"testing"
+
+	"asyncapi/apiserver"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignupRequest_Validate(t *testing.T) {
+	valid := []string{"test@test.com", "first.last+tag@sub.example.org"}
+	for _, email := range valid {
+		require.NoError(t, apiserver.SignupRequest{Email: email, Password: "password"}.Validate(), email)
+	}
+
+	invalid := []string{"", "test", "test@", "@test.com", "test@test", "Test <test@test.com>", "test@test.com.", "a b@test.com"}
+	for _, email := range invalid {
+		require.Error(t, apiserver.SignupRequest{Email: email, Password: "password"}.Validate(), email)
+	}
+
+	require.Error(t, apiserver.SignupRequest{Email: "test@test.com"}.Validate())
+}
+
+func TestAddMemberRequest_Validate(t *testing.T) {
+	require.NoError(t, apiserver.AddMemberRequest{Email: "test@test.com", Role: "member"}.Validate())
+	require.NoError(t, apiserver.AddMemberRequest{Email: "test@test.com", Role: "admin"}.Validate())
+	require.Error(t, apiserver.AddMemberRequest{Email: "test@test.com", Role: "owner"}.Validate())
+	require.Error(t, apiserver.AddMemberRequest{Role: "member"}.Validate())
+}
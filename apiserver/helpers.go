@@ -2,14 +2,23 @@ package apiserver
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"mime"
 	"net/http"
+	"strings"
+
+	"asyncapi/passwords"
 )
 
 type ErrWithStatus struct {
 	status int
+	code   string
 	err    error
+	//public exposes the message of err whatever the status
+	public bool
 }
 
 // Error implements the error interface for *ErrWithStatus. It returns the
@@ -18,6 +27,11 @@ func (e *ErrWithStatus) Error() string {
 	return e.err.Error()
 }
 
+// Unwrap returns the embedded error.
+func (e *ErrWithStatus) Unwrap() error {
+	return e.err
+}
+
 // NewErrWithStatus creates a new *ErrWithStatus. The status code and error
 // message are used to construct a new *ErrWithStatus.
 //
@@ -27,33 +41,34 @@ func NewErrWithStatus(status int, err error) *ErrWithStatus {
 	return &ErrWithStatus{status: status, err: err}
 }
 
+// WithCode sets the error code of the response, replacing the generic code
+// of the status.
+func (e *ErrWithStatus) WithCode(code string) *ErrWithStatus {
+	e.code = code
+	return e
+}
+
+// Public exposes the message of the error as the detail of the problem, for
+// statuses whose messages are otherwise kept from the client (see
+// problemFromError). Only errors with a fixed message may be public, never
+// ones wrapping the errors of a dependency.
+func (e *ErrWithStatus) Public() *ErrWithStatus {
+	e.public = true
+	return e
+}
+
 // handler takes a function that returns an error and returns an http.HandlerFunc.
 // If the function returns an error, it is logged and the http.ResponseWriter is
-// written with the status code and an error message. If the error is an
-// *ErrWithStatus the status code and error message are taken from it. If the
-// error is not an *ErrWithStatus, the status code is set to
-// http.StatusInternalServerError.
+// written with a problem (see Problem). If the error is an *ErrWithStatus the
+// status code and error code are taken from it. If the error is not an
+// *ErrWithStatus, the status code is set to http.StatusInternalServerError.
 func handler(f func(w http.ResponseWriter, r *http.Request) error) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if err := f(w, r); err != nil {
-			status := http.StatusInternalServerError
-			msg := http.StatusText(status)
-			if e, ok := err.(*ErrWithStatus); ok {
-				status = e.status
-				msg = http.StatusText(e.status)
-				if status == http.StatusBadRequest || status == http.StatusNotFound || status == http.StatusConflict {
-					msg = e.err.Error()
-				}
-			}
+			problem := problemFromError(r, err)
 			//log the error slog message
-			slog.Error("HTTP handler error", "status", status, "error", err, "message", msg)
-			w.WriteHeader(status)
-			if err := json.NewEncoder(w).Encode(ApiResponse[struct{}]{
-				Message: msg,
-			}); err != nil {
-				slog.Error("HTTP handler encoding response error", "status", status, "error", err, "message", msg)
-			}
-
+			slog.ErrorContext(r.Context(), "HTTP handler error", "status", problem.Status, "code", problem.Code, "error", err)
+			writeProblem(w, problem)
 		}
 	}
 }
@@ -73,16 +88,117 @@ type Validator interface {
 	Validate() error
 }
 
-// decode decodes the given http.Request.Body into the given value of type T
-// and validates it using the Validate method on T. If decoding or validation
-// fail, an error is returned.
+// decode decodes the JSON body of the request into a value of type T and
+// validates it using the Validate method on T. The body must be a single JSON
+// object of type T: unknown fields and trailing data are rejected. The
+// returned error is an *ErrWithStatus ready to be returned by the handler,
+// 415 for a non JSON content type, 413 for a body over the limit set by
+// NewBodyLimitMiddleware and 400 otherwise.
 func decode[T Validator](r *http.Request) (T, error) {
-	var v T
-	if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
-		return v, fmt.Errorf("error decoding request body: %w", err)
+	v, err := decodeBody[T](r)
+	if err != nil {
+		return v, err
 	}
 	if err := v.Validate(); err != nil {
-		return v, fmt.Errorf("validation error: %w", err)
+		return v, validationError(err)
+	}
+	return v, nil
+}
+
+// PasswordRequest is a request setting a new password. Its Validate method
+// only checks that the password is there, decodePassword checks it against
+// the password policy.
+type PasswordRequest interface {
+	Validator
+	// PasswordField returns the name of the field with the new password and
+	// its value.
+	PasswordField() (field, password string)
+}
+
+// decodePassword decodes and validates the request like decode, and reports
+// a new password the policy rejects as an error of its field.
+func decodePassword[T PasswordRequest](r *http.Request, policy *passwords.Policy) (T, error) {
+	v, err := decodeBody[T](r)
+	if err != nil {
+		return v, err
+	}
+	var errs ValidationErrors
+	if err := v.Validate(); err != nil && !errors.As(err, &errs) {
+		return v, validationError(err)
+	}
+	if field, password := v.PasswordField(); password != "" {
+		if err := policy.Validate(password); err != nil {
+			errs.Add(field, err.Error())
+		}
+	}
+	if err := errs.Err(); err != nil {
+		return v, validationError(err)
+	}
+	return v, nil
+}
+
+// decodeBody decodes the JSON body of the request into a value of type T
+// without validating it, see decode.
+func decodeBody[T any](r *http.Request) (T, error) {
+	var v T
+	if err := requireJson(r); err != nil {
+		return v, err
+	}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&v); err != nil {
+		return v, decodeError(err)
+	}
+	//anything after the object, even another object, is a malformed body
+	if err := decoder.Decode(&struct{}{}); err != io.EOF {
+		if err == nil {
+			err = errors.New("request body must contain a single JSON object")
+		}
+		return v, decodeError(err)
 	}
 	return v, nil
 }
+
+// validationError is the 400 returned for a request failing validation.
+func validationError(err error) error {
+	return NewErrWithStatus(http.StatusBadRequest, fmt.Errorf("validation error: %w", err)).WithCode(CodeValidationFailed)
+}
+
+// requireJson rejects requests whose body is not declared as JSON.
+func requireJson(r *http.Request) error {
+	contentType := r.Header.Get("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "application/json" {
+		return NewErrWithStatus(http.StatusUnsupportedMediaType, fmt.Errorf("content type must be application/json, got %q", contentType)).WithCode(CodeUnsupportedMediaType)
+	}
+	return nil
+}
+
+// decodeError describes why the body could not be decoded without echoing
+// the internals of encoding/json.
+func decodeError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return NewErrWithStatus(http.StatusRequestEntityTooLarge, fmt.Errorf("request body must be at most %d bytes", maxBytesErr.Limit)).WithCode(CodeBodyTooLarge)
+	case errors.Is(err, io.EOF):
+		return NewErrWithStatus(http.StatusBadRequest, errors.New("request body must not be empty")).WithCode(CodeInvalidJson)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return NewErrWithStatus(http.StatusBadRequest, errors.New("request body contains malformed JSON")).WithCode(CodeInvalidJson)
+	case errors.As(err, &syntaxErr):
+		return NewErrWithStatus(http.StatusBadRequest, fmt.Errorf("request body contains malformed JSON at offset %d", syntaxErr.Offset)).WithCode(CodeInvalidJson)
+	case errors.As(err, &typeErr):
+		var fieldErrs ValidationErrors
+		fieldErrs.Add(typeErr.Field, fmt.Sprintf("%s must be a %s", typeErr.Field, typeErr.Type))
+		return NewErrWithStatus(http.StatusBadRequest, fieldErrs).WithCode(CodeInvalidJson)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		//encoding/json has no error type for unknown fields
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		var fieldErrs ValidationErrors
+		fieldErrs.Add(field, fmt.Sprintf("unknown field %q", field))
+		return NewErrWithStatus(http.StatusBadRequest, fieldErrs).WithCode(CodeInvalidJson)
+	}
+	return NewErrWithStatus(http.StatusBadRequest, fmt.Errorf("request body is invalid: %w", err)).WithCode(CodeInvalidJson)
+}
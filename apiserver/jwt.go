@@ -16,6 +16,14 @@ type JwtManager struct {
 
 var signingMethod = jwt.SigningMethodHS256
 
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+	// TokenTypeMfaChallenge is issued after a correct password when the user
+	// still has to provide a second factor.
+	TokenTypeMfaChallenge = "mfa_challenge"
+)
+
 type TokenPair struct {
 	AccessToken  *jwt.Token
 	RefreshToken *jwt.Token
@@ -23,6 +31,11 @@ type TokenPair struct {
 
 type CustomClaims struct {
 	TokenType string `json:"token_type"`
+	// Scopes lists what an access token may be used for, see ScopesForRole.
+	Scopes []string `json:"scopes,omitempty"`
+	// ClientId is set on access tokens issued to OAuth clients, whose subject
+	// is the client rather than a user.
+	ClientId string `json:"client_id,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -30,9 +43,21 @@ func NewJwtManager(config *config.Config) *JwtManager {
 	return &JwtManager{config}
 }
 
+// Parse verifies the signature of the given token and validates its
+// registered claims (expiry, issuer and audience, with the configured leeway).
+// The claims of the returned token are always of type *CustomClaims.
 func (j *JwtManager) Parse(token string) (*jwt.Token, error) {
-	parser := jwt.NewParser()
-	jwtToken, err := parser.Parse(token, func(t *jwt.Token) (interface{}, error) {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{signingMethod.Alg()}),
+		jwt.WithIssuer(j.config.Issuer()),
+		jwt.WithLeeway(j.config.JwtLeeway),
+		jwt.WithExpirationRequired(),
+	}
+	if j.config.JwtAudience != "" {
+		opts = append(opts, jwt.WithAudience(j.config.JwtAudience))
+	}
+	parser := jwt.NewParser(opts...)
+	jwtToken, err := parser.ParseWithClaims(token, &CustomClaims{}, func(t *jwt.Token) (interface{}, error) {
 		if t.Method != signingMethod {
 			return nil, fmt.Errorf("unexpected siging method: %v", t.Header["alg"])
 		}
@@ -40,66 +65,92 @@ func (j *JwtManager) Parse(token string) (*jwt.Token, error) {
 	})
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse token %v", err)
+		return nil, fmt.Errorf("failed to parse token: %w", err)
 	}
 	return jwtToken, nil
 }
 
+// ParseClaims parses the token like Parse and returns its typed claims.
+func (j *JwtManager) ParseClaims(token string) (*CustomClaims, error) {
+	jwtToken, err := j.Parse(token)
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := jwtToken.Claims.(*CustomClaims)
+	if !ok {
+		return nil, fmt.Errorf("unexpected claims type %T", jwtToken.Claims)
+	}
+	return claims, nil
+}
+
 func (j *JwtManager) IsAccessToken(token *jwt.Token) bool {
-	jwtClaims, ok := token.Claims.(jwt.MapClaims)
+	return hasTokenType(token, TokenTypeAccess)
+}
+
+func (j *JwtManager) IsRefreshToken(token *jwt.Token) bool {
+	return hasTokenType(token, TokenTypeRefresh)
+}
+
+func (j *JwtManager) IsMfaChallengeToken(token *jwt.Token) bool {
+	return hasTokenType(token, TokenTypeMfaChallenge)
+}
+
+func hasTokenType(token *jwt.Token, tokenType string) bool {
+	if token == nil {
+		return false
+	}
+	claims, ok := token.Claims.(*CustomClaims)
 	if !ok {
 		return false
 	}
-	if tokenType, ok := jwtClaims["token_type"]; ok {
-		return tokenType == "access"
+	return claims.TokenType == tokenType
+}
+
+func (j *JwtManager) newClaims(tokenType string, subject string, now time.Time, ttl time.Duration) CustomClaims {
+	claims := CustomClaims{
+		TokenType: tokenType,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   subject,
+			Issuer:    j.config.Issuer(),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+	if j.config.JwtAudience != "" {
+		claims.Audience = jwt.ClaimStrings{j.config.JwtAudience}
 	}
-	return false
+	return claims
 }
 
-func (j *JwtManager) GenerateTokenPair(userId uuid.UUID) (*TokenPair, error) {
-	now := time.Now()
-	issuer := "http://" + j.config.ApiServerHost + ":" + j.config.ApiServerPort
-	jwtAccessToken := jwt.NewWithClaims(signingMethod,
-		CustomClaims{
-			TokenType: "access",
-			RegisteredClaims: jwt.RegisteredClaims{
-				Subject:   userId.String(),
-				Issuer:    issuer,
-				ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute * 15)),
-				IssuedAt:  jwt.NewNumericDate(now),
-			},
-		})
-	key := []byte(j.config.JwtSecret)
-	jwtAccessTokenRaw, err := jwtAccessToken.SignedString(key)
+// sign signs the given claims and parses the result back, so the returned
+// token carries Raw and typed claims exactly as a client-submitted token would.
+func (j *JwtManager) sign(claims CustomClaims) (*jwt.Token, error) {
+	raw, err := jwt.NewWithClaims(signingMethod, claims).SignedString([]byte(j.config.JwtSecret))
 	if err != nil {
-		return nil, fmt.Errorf("failed to sign access token: %w", err)
+		return nil, fmt.Errorf("failed to sign %s token: %w", claims.TokenType, err)
 	}
-	jwtAccessToken.Raw = jwtAccessTokenRaw
-
-	accessToken, err := j.Parse(jwtAccessTokenRaw)
+	token, err := j.Parse(raw)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse access token %w", err)
+		return nil, fmt.Errorf("failed to parse %s token %w", claims.TokenType, err)
 	}
+	return token, nil
+}
 
-	jwtRefreshToken := jwt.NewWithClaims(signingMethod,
-		CustomClaims{
-			TokenType: "refresh",
-			RegisteredClaims: jwt.RegisteredClaims{
-				Subject:   userId.String(),
-				Issuer:    issuer,
-				ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour * 24 * 30)),
-				IssuedAt:  jwt.NewNumericDate(now),
-			},
-		})
-	var jwtRefreshTokenRaw string
-	jwtRefreshTokenRaw, err = jwtRefreshToken.SignedString(key)
+// GenerateTokenPair issues an access token carrying the given scopes and a
+// refresh token for the user.
+func (j *JwtManager) GenerateTokenPair(userId uuid.UUID, scopes ...string) (*TokenPair, error) {
+	now := time.Now()
+
+	accessClaims := j.newClaims(TokenTypeAccess, userId.String(), now, time.Minute*15)
+	accessClaims.Scopes = scopes
+	accessToken, err := j.sign(accessClaims)
 	if err != nil {
-		return nil, fmt.Errorf("failed to sign refresh token: %w", err)
+		return nil, err
 	}
-	jwtRefreshToken.Raw = jwtRefreshTokenRaw
-	refreshToken, err := j.Parse(jwtRefreshTokenRaw)
+
+	refreshToken, err := j.sign(j.newClaims(TokenTypeRefresh, userId.String(), now, time.Hour*24*30))
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse refresh token %w", err)
+		return nil, err
 	}
 
 	return &TokenPair{
@@ -107,3 +158,23 @@ func (j *JwtManager) GenerateTokenPair(userId uuid.UUID) (*TokenPair, error) {
 		RefreshToken: refreshToken,
 	}, nil
 }
+
+// GenerateMfaChallengeToken issues a short lived token proving the user passed
+// the password step of the signin, to be exchanged for a TokenPair together
+// with a second factor.
+func (j *JwtManager) GenerateMfaChallengeToken(userId uuid.UUID) (*jwt.Token, error) {
+	return j.sign(j.newClaims(TokenTypeMfaChallenge, userId.String(), time.Now(), time.Minute*5))
+}
+
+// ClientTokenTTL is the lifetime of access tokens issued to OAuth clients.
+const ClientTokenTTL = time.Minute * 15
+
+// GenerateClientToken issues an access token for an OAuth client with the
+// given scopes. Clients get no refresh token and request a new access token
+// with their credentials instead.
+func (j *JwtManager) GenerateClientToken(clientId string, scopes []string) (*jwt.Token, error) {
+	claims := j.newClaims(TokenTypeAccess, clientId, time.Now(), ClientTokenTTL)
+	claims.ClientId = clientId
+	claims.Scopes = scopes
+	return j.sign(claims)
+}
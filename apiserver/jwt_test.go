@@ -2,9 +2,11 @@ package apiserver_test
 
 import (
 	"testing"
+	"time"
 
 	"asyncapi/config"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
 
@@ -56,3 +58,105 @@ func TestJwtManager_GenerateTokenPair(t *testing.T) {
 	require.Equal(t, tokenPair.RefreshToken, parsedrefreshToken)
 
 }
+
+// TestJwtManager_TokenTypes verifies that access and refresh tokens can be
+// told apart through their typed claims.
+func TestJwtManager_TokenTypes(t *testing.T) {
+	mockConfig, err := config.New()
+	require.NoError(t, err)
+
+	jwtManager := apiserver.NewJwtManager(mockConfig)
+	tokenPair, err := jwtManager.GenerateTokenPair(uuid.New())
+	require.NoError(t, err)
+
+	require.True(t, jwtManager.IsRefreshToken(tokenPair.RefreshToken))
+	require.False(t, jwtManager.IsRefreshToken(tokenPair.AccessToken))
+
+	claims, err := jwtManager.ParseClaims(tokenPair.RefreshToken.Raw)
+	require.NoError(t, err)
+	require.Equal(t, apiserver.TokenTypeRefresh, claims.TokenType)
+	require.Equal(t, jwt.ClaimStrings{mockConfig.JwtAudience}, claims.Audience)
+}
+
+// TestJwtManager_ValidatesClaims verifies that tokens issued for another
+// issuer or audience, or expired beyond the leeway, are rejected.
+func TestJwtManager_ValidatesClaims(t *testing.T) {
+	mockConfig, err := config.New()
+	require.NoError(t, err)
+	mockConfig.JwtLeeway = time.Minute
+
+	jwtManager := apiserver.NewJwtManager(mockConfig)
+	sign := func(claims apiserver.CustomClaims) string {
+		raw, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(mockConfig.JwtSecret))
+		require.NoError(t, err)
+		return raw
+	}
+	claims := func(issuer, audience string, expiresAt time.Time) apiserver.CustomClaims {
+		return apiserver.CustomClaims{
+			TokenType: apiserver.TokenTypeAccess,
+			RegisteredClaims: jwt.RegisteredClaims{
+				Subject:   uuid.NewString(),
+				Issuer:    issuer,
+				Audience:  jwt.ClaimStrings{audience},
+				ExpiresAt: jwt.NewNumericDate(expiresAt),
+			},
+		}
+	}
+	issuer := mockConfig.Issuer()
+	audience := mockConfig.JwtAudience
+
+	_, err = jwtManager.Parse(sign(claims(issuer, audience, time.Now().Add(-30*time.Second))))
+	require.NoError(t, err, "expired within leeway")
+
+	_, err = jwtManager.Parse(sign(claims(issuer, audience, time.Now().Add(-2*time.Minute))))
+	require.ErrorIs(t, err, jwt.ErrTokenExpired)
+
+	_, err = jwtManager.Parse(sign(claims("http://evil.example", audience, time.Now().Add(time.Minute))))
+	require.ErrorIs(t, err, jwt.ErrTokenInvalidIssuer)
+
+	_, err = jwtManager.Parse(sign(claims(issuer, "someone-else", time.Now().Add(time.Minute))))
+	require.ErrorIs(t, err, jwt.ErrTokenInvalidAudience)
+}
+
+// TestJwtManager_GenerateMfaChallengeToken verifies that challenge tokens are
+// neither access nor refresh tokens.
+func TestJwtManager_GenerateMfaChallengeToken(t *testing.T) {
+	mockConfig, err := config.New()
+	require.NoError(t, err)
+
+	jwtManager := apiserver.NewJwtManager(mockConfig)
+	userId := uuid.New()
+	challenge, err := jwtManager.GenerateMfaChallengeToken(userId)
+	require.NoError(t, err)
+
+	require.True(t, jwtManager.IsMfaChallengeToken(challenge))
+	require.False(t, jwtManager.IsAccessToken(challenge))
+	require.False(t, jwtManager.IsRefreshToken(challenge))
+
+	subject, err := challenge.Claims.GetSubject()
+	require.NoError(t, err)
+	require.Equal(t, userId.String(), subject)
+}
+
+func TestJwtManager_GenerateClientToken(t *testing.T) {
+	conf, err := config.New()
+	require.NoError(t, err)
+	jwtManager := apiserver.NewJwtManager(conf)
+
+	token, err := jwtManager.GenerateClientToken("oc_test", []string{apiserver.ScopeReportsWrite})
+	require.NoError(t, err)
+	require.True(t, jwtManager.IsAccessToken(token))
+
+	claims, err := jwtManager.ParseClaims(token.Raw)
+	require.NoError(t, err)
+	require.Equal(t, "oc_test", claims.ClientId)
+	require.Equal(t, "oc_test", claims.Subject)
+	require.Equal(t, []string{apiserver.ScopeReportsWrite}, claims.Scopes)
+
+	//user tokens carry no client
+	tokenPair, err := jwtManager.GenerateTokenPair(uuid.New())
+	require.NoError(t, err)
+	claims, err = jwtManager.ParseClaims(tokenPair.AccessToken.Raw)
+	require.NoError(t, err)
+	require.Empty(t, claims.ClientId)
+}
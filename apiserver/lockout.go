@@ -0,0 +1,62 @@
+package apiserver
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"asyncapi/store"
+)
+
+// clientIP returns the IP address of the client that sent the request.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (s *ApiServer) accountLockoutPolicy() store.LockoutPolicy {
+	return store.LockoutPolicy{
+		MaxFailures: s.config.SigninMaxFailures,
+		BaseLockout: s.config.SigninLockoutBase,
+		MaxLockout:  s.config.SigninLockoutMax,
+		Window:      s.config.SigninFailureWindow,
+	}
+}
+
+func (s *ApiServer) ipLockoutPolicy() store.LockoutPolicy {
+	policy := s.accountLockoutPolicy()
+	policy.MaxFailures = s.config.SigninIpMaxFailures
+	return policy
+}
+
+// checkSigninLockout returns a 429 error, and sets the Retry-After header, if
+// the account or the client IP is currently locked out.
+func (s *ApiServer) checkSigninLockout(ctx context.Context, w http.ResponseWriter, email, ip string) error {
+	lockedUntil, err := s.store.SigninFailures.LockedUntil(ctx, store.AccountKey(email), store.IpKey(ip))
+	if err != nil {
+		return NewErrWithStatus(http.StatusInternalServerError, err)
+	}
+	if wait := time.Until(lockedUntil); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		return NewErrWithStatus(http.StatusTooManyRequests, fmt.Errorf("too many failed signin attempts, retry in %s", wait.Round(time.Second))).WithCode(CodeAccountLocked)
+	}
+	return nil
+}
+
+// recordSigninFailure counts a failed attempt against the account and the IP.
+func (s *ApiServer) recordSigninFailure(ctx context.Context, email, ip string) error {
+	if _, err := s.store.SigninFailures.RecordFailure(ctx, store.AccountKey(email), s.accountLockoutPolicy()); err != nil {
+		return err
+	}
+	if _, err := s.store.SigninFailures.RecordFailure(ctx, store.IpKey(ip), s.ipLockoutPolicy()); err != nil {
+		return err
+	}
+	return nil
+}
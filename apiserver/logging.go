@@ -0,0 +1,151 @@
+package apiserver
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// contextLogHandler adds the attributes of the request in the context, such
+// as its id, to every record logged with a context.
+type contextLogHandler struct {
+	slog.Handler
+}
+
+// NewContextLogHandler wraps h so records logged with the *Context methods of
+// slog during a request carry its request_id, and trace_id when it is traced.
+func NewContextLogHandler(h slog.Handler) slog.Handler {
+	return &contextLogHandler{Handler: h}
+}
+
+func (h *contextLogHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestIdFromContext(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		record.AddAttrs(slog.String("trace_id", spanContext.TraceID().String()))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextLogHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextLogHandler) WithGroup(name string) slog.Handler {
+	return &contextLogHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// responseRecorder captures the status and the size of the response.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *responseRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *responseRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Status returns the status of the response, 200 if nothing was written.
+func (w *responseRecorder) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// accessLogEntry collects what inner handlers learn about a request for its
+// access log line: the matched route and the authenticated user.
+type accessLogEntry struct {
+	route  string
+	userId string
+}
+
+type accessLogCtxKey struct {
+}
+
+func contextWithAccessLog(ctx context.Context, entry *accessLogEntry) context.Context {
+	return context.WithValue(ctx, accessLogCtxKey{}, entry)
+}
+
+// accessLogFromContext returns the entry of the request, never nil so callers
+// don't need to check whether the access log is enabled.
+func accessLogFromContext(ctx context.Context) *accessLogEntry {
+	entry, ok := ctx.Value(accessLogCtxKey{}).(*accessLogEntry)
+	if !ok {
+		return &accessLogEntry{}
+	}
+	return entry
+}
+
+// withRoute records the route pattern the request matches in the mux for the
+// access log and the metrics, before the auth middleware may reject it.
+func withRoute(mux *http.ServeMux) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, pattern := mux.Handler(r)
+			accessLogFromContext(r.Context()).route = pattern
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequestIdHeader carries the id of a request, it is accepted from the client
+// and echoed on the response.
+const RequestIdHeader = "X-Request-ID"
+
+// validRequestId limits client supplied ids to something safe to log.
+func validRequestId(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestId() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// NewRequestIdMiddleware gives every request an id, reusing the X-Request-ID
+// header of the client when it is well formed, and echoes it on the response.
+func NewRequestIdMiddleware() func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(RequestIdHeader)
+			if !validRequestId(id) {
+				id = newRequestId()
+			}
+			w.Header().Set(RequestIdHeader, id)
+			next.ServeHTTP(w, r.WithContext(ContextWithRequestId(r.Context(), id)))
+		})
+	}
+}
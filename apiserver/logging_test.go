@@ -0,0 +1,65 @@
+package apiserver_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"asyncapi/apiserver"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLoggerMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(apiserver.NewContextLogHandler(slog.NewJSONHandler(&buf, nil)))
+
+	h := apiserver.NewRequestIdMiddleware()(apiserver.NewLoggerMiddleware(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger.InfoContext(r.Context(), "in handler")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	})))
+
+	r := httptest.NewRequest(http.MethodPost, "/reports", nil)
+	r.Header.Set(apiserver.RequestIdHeader, "req-42")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+
+	var handlerLine map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &handlerLine))
+	require.Equal(t, "req-42", handlerLine["request_id"])
+
+	var accessLine map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &accessLine))
+	require.Equal(t, "HTTP request", accessLine["msg"])
+	require.Equal(t, "req-42", accessLine["request_id"])
+	require.Equal(t, http.MethodPost, accessLine["method"])
+	require.Equal(t, "/reports", accessLine["path"])
+	require.EqualValues(t, http.StatusCreated, accessLine["status"])
+	require.EqualValues(t, len("created"), accessLine["bytes"])
+	require.Contains(t, accessLine, "duration")
+}
+
+func TestNewRequestIdMiddleware(t *testing.T) {
+	var seen string
+	h := apiserver.NewRequestIdMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = apiserver.RequestIdFromContext(r.Context())
+	}))
+
+	for _, header := range []string{"", "not a valid id", string(make([]byte, 200))} {
+		r := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		r.Header.Set(apiserver.RequestIdHeader, header)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		require.Len(t, seen, 32, header)
+		require.NotEqual(t, header, seen)
+		require.Equal(t, seen, w.Header().Get(apiserver.RequestIdHeader))
+	}
+}
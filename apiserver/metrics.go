@@ -0,0 +1,97 @@
+package apiserver
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"asyncapi/cache"
+)
+
+// Metrics are the Prometheus metrics of the API server. They are registered
+// on their own registry rather than the global one, so a server can be
+// created more than once in a process.
+type Metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+}
+
+// NewMetrics creates the metrics of the API server, with the Go runtime and
+// process metrics and the stats of the user cache.
+func NewMetrics(cacheStats func() cache.Stats) *Metrics {
+	registry := prometheus.NewRegistry()
+	m := &Metrics{
+		registry: registry,
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "asyncapi",
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "HTTP requests by route pattern and status.",
+		}, []string{"route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "asyncapi",
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "HTTP request latency by route pattern.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route"}),
+	}
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+	)
+
+	//the cache keeps its own counters, they are read on every scrape
+	registry.MustRegister(
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: "asyncapi", Subsystem: "user_cache", Name: "hits_total",
+			Help: "User cache lookups served from the cache.",
+		}, func() float64 { return float64(cacheStats().Hits) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: "asyncapi", Subsystem: "user_cache", Name: "misses_total",
+			Help: "User cache lookups that went to the database.",
+		}, func() float64 { return float64(cacheStats().Misses) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: "asyncapi", Subsystem: "user_cache", Name: "evictions_total",
+			Help: "Users evicted from the cache to make room.",
+		}, func() float64 { return float64(cacheStats().Evictions) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "asyncapi", Subsystem: "user_cache", Name: "size",
+			Help: "Users currently in the cache.",
+		}, func() float64 { return float64(cacheStats().Size) }),
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// NewMetricsMiddleware counts the requests and observes their latency by the
+// route recorded by withRoute, which has to run before it. Requests matching
+// no route are recorded as "unmatched" so unknown paths can't blow up the
+// number of series.
+func NewMetricsMiddleware(m *Metrics) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			recorder := &responseRecorder{ResponseWriter: w}
+			next.ServeHTTP(recorder, r)
+
+			route := accessLogFromContext(r.Context()).route
+			if route == "" {
+				route = "unmatched"
+			}
+			m.requests.WithLabelValues(route, strconv.Itoa(recorder.Status())).Inc()
+			m.requestDuration.WithLabelValues(route).Observe(time.Since(start).Seconds())
+		})
+	}
+}
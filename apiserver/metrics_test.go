@@ -0,0 +1,37 @@
+package apiserver_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"asyncapi/apiserver"
+	"asyncapi/cache"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	metrics := apiserver.NewMetrics(func() cache.Stats {
+		return cache.Stats{Hits: 3, Misses: 1, Size: 1}
+	})
+	h := apiserver.NewMetricsMiddleware(metrics)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	for range 2 {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/reports", nil))
+	}
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	body, err := io.ReadAll(w.Body)
+	require.NoError(t, err)
+
+	require.Contains(t, string(body), `asyncapi_http_requests_total{route="unmatched",status="201"} 2`)
+	require.Contains(t, string(body), `asyncapi_http_request_duration_seconds_count{route="unmatched"} 2`)
+	require.Contains(t, string(body), "asyncapi_user_cache_hits_total 3")
+	require.Contains(t, string(body), "asyncapi_user_cache_size 1")
+	require.Contains(t, string(body), "go_goroutines")
+}
@@ -0,0 +1,203 @@
+package apiserver
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"asyncapi/store"
+	"asyncapi/totp"
+)
+
+// recoveryCodeCount is the number of recovery codes issued on TOTP enrolment.
+const recoveryCodeCount = 10
+
+type TotpEnrolmentResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningUri string `json:"provisioning_uri"`
+}
+
+type ConfirmTotpRequest struct {
+	Code string `json:"code"`
+}
+
+func (r ConfirmTotpRequest) Validate() error {
+	var errs ValidationErrors
+	if r.Code == "" {
+		errs.Add("code", "code is required")
+	}
+	return errs.Err()
+}
+
+type ConfirmTotpResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type MfaVerifyRequest struct {
+	MfaToken     string `json:"mfa_token"`
+	Code         string `json:"code,omitempty"`
+	RecoveryCode string `json:"recovery_code,omitempty"`
+}
+
+func (r MfaVerifyRequest) Validate() error {
+	var errs ValidationErrors
+	if r.MfaToken == "" {
+		errs.Add("mfa_token", "mfa_token is required")
+	}
+	if (r.Code == "") == (r.RecoveryCode == "") {
+		errs.Add("code", "exactly one of code or recovery_code is required")
+	}
+	return errs.Err()
+}
+
+// enrolTotpHandler generates a new TOTP secret for the signed in user and
+// returns it with its provisioning URI. The secret is only used for signin
+// once it has been confirmed with a code.
+func (s *ApiServer) enrolTotpHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, err := sessionUserFromContext(r)
+		if err != nil {
+			return err
+		}
+		if user.MfaEnabled() {
+			return NewErrWithStatus(http.StatusConflict, errors.New("two-factor authentication is already enabled"))
+		}
+
+		secret, err := totp.GenerateSecret()
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		if err := s.store.Users.SetTotpSecret(r.Context(), user.Id, secret); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		if err := encode(ApiResponse[TotpEnrolmentResponse]{
+			Data: &TotpEnrolmentResponse{
+				Secret:          secret,
+				ProvisioningUri: totp.ProvisioningURI(s.config.MfaIssuer, user.Email, secret),
+			},
+		}, http.StatusCreated, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		return nil
+	})
+}
+
+// confirmTotpHandler enables TOTP for the signed in user once they proved
+// their authenticator produces valid codes, and returns fresh recovery codes.
+func (s *ApiServer) confirmTotpHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		req, err := decode[ConfirmTotpRequest](r)
+		if err != nil {
+			return err
+		}
+		user, err := sessionUserFromContext(r)
+		if err != nil {
+			return err
+		}
+		if user.MfaEnabled() {
+			return NewErrWithStatus(http.StatusConflict, errors.New("two-factor authentication is already enabled"))
+		}
+		secret, err := s.store.Users.TotpSecret(user)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return NewErrWithStatus(http.StatusBadRequest, errors.New("no pending two-factor enrolment"))
+			}
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		step, ok := totp.Validate(secret, req.Code, time.Now(), 1)
+		if !ok {
+			return NewErrWithStatus(http.StatusBadRequest, errors.New("invalid code"))
+		}
+		if err := s.store.Users.EnableTotp(r.Context(), user.Id); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		if err := s.store.Users.UseTotpStep(r.Context(), user.Id, step); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		codes, err := s.store.RecoveryCodes.Generate(r.Context(), user.Id, recoveryCodeCount)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		if err := encode(ApiResponse[ConfirmTotpResponse]{
+			Data: &ConfirmTotpResponse{RecoveryCodes: codes},
+		}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		return nil
+	})
+}
+
+// mfaVerifyHandler completes a two-step signin: it exchanges the challenge
+// token returned by signinHandler and a TOTP or recovery code for a TokenPair.
+// Failures count towards the signin lockout like wrong passwords do.
+func (s *ApiServer) mfaVerifyHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		req, err := decode[MfaVerifyRequest](r)
+		if err != nil {
+			return err
+		}
+
+		challenge, err := s.jwtManager.Parse(req.MfaToken)
+		if err != nil {
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("invalid mfa token: %w", err)).WithCode(tokenErrorCode(err))
+		}
+		if !s.jwtManager.IsMfaChallengeToken(challenge) {
+			return NewErrWithStatus(http.StatusUnauthorized, errors.New("not an mfa token")).WithCode(CodeInvalidToken).Public()
+		}
+		subject, err := challenge.Claims.GetSubject()
+		if err != nil {
+			return NewErrWithStatus(http.StatusUnauthorized, err)
+		}
+		userId, err := uuid.Parse(subject)
+		if err != nil {
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("invalid user ID in token: %w", err)).WithCode(CodeInvalidToken)
+		}
+		user, err := s.store.Users.GetUserByID(r.Context(), userId)
+		if err != nil {
+			return NewErrWithStatus(http.StatusUnauthorized, err)
+		}
+		if !user.MfaEnabled() {
+			return NewErrWithStatus(http.StatusUnauthorized, errors.New("two-factor authentication is not enabled")).Public()
+		}
+
+		ip := clientIP(r)
+		if err := s.checkSigninLockout(r.Context(), w, user.Email, ip); err != nil {
+			return err
+		}
+
+		if req.RecoveryCode != "" {
+			err = s.store.RecoveryCodes.Consume(r.Context(), user.Id, req.RecoveryCode)
+		} else {
+			var secret string
+			if secret, err = s.store.Users.TotpSecret(user); err != nil {
+				return NewErrWithStatus(http.StatusInternalServerError, err)
+			}
+			if step, ok := totp.Validate(secret, req.Code, time.Now(), 1); ok {
+				err = s.store.Users.UseTotpStep(r.Context(), user.Id, step)
+			} else {
+				err = fmt.Errorf("invalid code: %w", sql.ErrNoRows)
+			}
+		}
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				return NewErrWithStatus(http.StatusInternalServerError, err)
+			}
+			if err := s.recordSigninFailure(r.Context(), user.Email, ip); err != nil {
+				return NewErrWithStatus(http.StatusInternalServerError, err)
+			}
+			return NewErrWithStatus(http.StatusUnauthorized, errors.New("invalid two-factor code")).WithCode(CodeInvalidMfaCode).Public()
+		}
+		if err := s.store.SigninFailures.Reset(r.Context(), store.AccountKey(user.Email)); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return s.issueTokenPair(w, r, user)
+	})
+}
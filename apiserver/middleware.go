@@ -2,9 +2,12 @@ package apiserver
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"slices"
 	"strings"
+	"time"
 
 	"asyncapi/store"
 
@@ -26,82 +29,203 @@ func UserFromContext(ctx context.Context) (*store.User, bool) {
 	return user, true
 }
 
+type apiKeyCtxKey struct {
+}
+
+// ContextWithApiKey records that the request was authenticated with the key.
+func ContextWithApiKey(ctx context.Context, apiKey *store.ApiKey) context.Context {
+	return context.WithValue(ctx, apiKeyCtxKey{}, apiKey)
+}
+
+// ApiKeyFromContext returns the API key the request was authenticated with,
+// if it was not authenticated with an access token.
+func ApiKeyFromContext(ctx context.Context) (*store.ApiKey, bool) {
+	apiKey, ok := ctx.Value(apiKeyCtxKey{}).(*store.ApiKey)
+	if !ok || apiKey == nil {
+		return nil, false
+	}
+	return apiKey, true
+}
+
+// NewLoggerMiddleware writes one access log line per request with its
+// status, size and duration, along with the route it matched and the user it
+// was authenticated as.
 func NewLoggerMiddleware(logger *slog.Logger) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			logger.Info("Request received",
+			start := time.Now()
+			entry := &accessLogEntry{}
+			recorder := &responseRecorder{ResponseWriter: w}
+			r = r.WithContext(contextWithAccessLog(r.Context(), entry))
+			next.ServeHTTP(recorder, r)
+
+			status := recorder.Status()
+			level := slog.LevelInfo
+			if status >= 500 {
+				level = slog.LevelError
+			}
+			attrs := []slog.Attr{
 				slog.String("method", r.Method),
 				slog.String("path", r.URL.Path),
+				slog.String("route", entry.route),
+				slog.Int("status", status),
+				slog.Int64("bytes", recorder.bytes),
+				slog.Duration("duration", time.Since(start)),
 				slog.String("remote_addr", r.RemoteAddr),
-				slog.String("Actual Port", r.RequestURI),
-			)
+				slog.String("user_agent", r.UserAgent()),
+			}
+			if entry.userId != "" {
+				attrs = append(attrs, slog.String("user_id", entry.userId))
+			}
+			logger.LogAttrs(r.Context(), level, "HTTP request", attrs...)
+		})
+	}
+}
+
+// NewBodyLimitMiddleware caps the size of request bodies. Bodies declared
+// larger are refused right away, others fail with an *http.MaxBytesError once
+// the limit is read past, which decode turns into a 413.
+func NewBodyLimitMiddleware(maxBytes int64) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > maxBytes {
+				writeProblem(w, newProblem(r, http.StatusRequestEntityTooLarge, CodeBodyTooLarge, fmt.Sprintf("request body must be at most %d bytes", maxBytes)))
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
 			next.ServeHTTP(w, r)
-			logger.Info("Response sent",
-				// Assuming you have a way to get the response status code
-				//slog.String("response_body", "response body"),
-				slog.String("method", r.Method),
-				slog.String("path", r.URL.Path),
-				slog.String("remote_addr", r.RemoteAddr),
-			)
 		})
 	}
 }
 
-func NewAuthMiddleware(jwtManager *JwtManager, userStore *store.UserStore) func(next http.Handler) http.Handler {
+// isProbePath reports whether the path is probed by the infrastructure, such
+// requests are neither rate limited nor traced. /metrics is not one of them,
+// it is scraped with an admin API key.
+func isProbePath(path string) bool {
+	return path == "/healthz" || path == "/readyz"
+}
+
+// NewAuthMiddleware authenticates every request but those isPublic lets
+// through, see publicRoutes, either with a JWT access token ("Authorization:
+// Bearer <token>") or with a personal API key ("Authorization: ApiKey <key>"),
+// and puts the user in the context along with the scopes granted to the
+// request (see RequireScope). Access tokens of OAuth clients authenticate as
+// the owner of the client, with a Principal recording the client.
+func NewAuthMiddleware(jwtManager *JwtManager, userStore *store.UserStore, apiKeyStore *store.ApiKeyStore, clientStore *store.OAuthClientStore, isPublic func(r *http.Request) bool) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if strings.HasPrefix(r.URL.Path, "/auth") {
+			if isPublic(r) {
 				next.ServeHTTP(w, r)
 				return
 			}
 			//Authorisation header
 			//read auth header
-			authHeader := r.Header.Get("Authorization")
-			var token string
-			if parts := strings.Split(authHeader, "Bearer "); len(parts) == 2 {
-				token = parts[1]
-			}
-			if token == "" {
-				w.WriteHeader(http.StatusUnauthorized)
+			scheme, credentials, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+			credentials = strings.TrimSpace(credentials)
+			if credentials == "" {
+				writeProblem(w, newProblem(r, http.StatusUnauthorized, CodeMissingCredentials, "an access token or api key is required"))
 				return
 			}
-			parsedToken, err := jwtManager.Parse(token)
-			if err != nil {
-				slog.Error("failed to parse the token", "error", err)
-				w.WriteHeader(http.StatusUnauthorized)
-				return
-			}
-			//verify the parsed token
-			if !jwtManager.IsAccessToken(parsedToken) {
-				w.WriteHeader(http.StatusUnauthorized)
-				w.Write([]byte("not an access token"))
+
+			ctx := r.Context()
+			var userId uuid.UUID
+			var client *store.OAuthClient
+			//issuedAt is set for user access tokens, which a forced logout revokes
+			var issuedAt *time.Time
+			//nil requests every scope the role of the user allows
+			var requestedScopes []string
+			switch {
+			case strings.EqualFold(scheme, "Bearer"):
+				parsedToken, err := jwtManager.Parse(credentials)
+				if err != nil {
+					slog.ErrorContext(ctx, "failed to parse the token", "error", err)
+					writeProblem(w, newProblem(r, http.StatusUnauthorized, tokenErrorCode(err), "the access token is invalid or expired"))
+					return
+				}
+				//verify the parsed token
+				if !jwtManager.IsAccessToken(parsedToken) {
+					writeProblem(w, newProblem(r, http.StatusUnauthorized, CodeInvalidToken, "not an access token"))
+					return
+				}
+
+				claims, _ := parsedToken.Claims.(*CustomClaims)
+				requestedScopes = claims.Scopes
+				if requestedScopes == nil {
+					requestedScopes = []string{}
+				}
+
+				if claims.ClientId != "" {
+					//client tokens act on behalf of the owner of the client,
+					//as long as the client is not revoked
+					client, err = clientStore.Get(ctx, claims.ClientId)
+					if err != nil || client.RevokedAt != nil {
+						slog.ErrorContext(ctx, "oauth client is unknown or revoked", "client_id", claims.ClientId, "error", err)
+						writeProblem(w, newProblem(r, http.StatusUnauthorized, CodeClientRevoked, "the oauth client is unknown or revoked"))
+						return
+					}
+					userId = client.OwnerId
+					requestedScopes = slices.DeleteFunc(slices.Clone(requestedScopes), func(scope string) bool {
+						return !slices.Contains(client.Scopes, scope)
+					})
+					break
+				}
+
+				if claims.IssuedAt != nil {
+					issuedAt = &claims.IssuedAt.Time
+				}
+
+				//userId from claims
+				userIdStr, err := parsedToken.Claims.GetSubject()
+				if err != nil {
+					slog.ErrorContext(ctx, "faield to extract user info from claims subject", "error", err)
+					writeProblem(w, newProblem(r, http.StatusUnauthorized, CodeInvalidToken, "the access token has no subject"))
+					return
+				}
+				//convert userId as uuid
+				userId, err = uuid.Parse(userIdStr)
+				if err != nil {
+					slog.ErrorContext(ctx, "failed to parse the userId into uuid type", "error", err)
+					writeProblem(w, newProblem(r, http.StatusUnauthorized, CodeInvalidToken, "the access token has an invalid subject"))
+					return
+				}
+			case strings.EqualFold(scheme, "ApiKey"):
+				apiKey, err := apiKeyStore.Authenticate(ctx, credentials)
+				if err != nil {
+					slog.ErrorContext(ctx, "failed to authenticate the api key", "error", err)
+					writeProblem(w, newProblem(r, http.StatusUnauthorized, CodeInvalidApiKey, "the api key is invalid, expired or revoked"))
+					return
+				}
+				userId = apiKey.UserId
+				requestedScopes = ApiKeyScopes(apiKey.Scopes)
+				ctx = ContextWithApiKey(ctx, apiKey)
+			default:
+				writeProblem(w, newProblem(r, http.StatusUnauthorized, CodeMissingCredentials, "the authorization scheme must be Bearer or ApiKey"))
 				return
 			}
 
-			//userId from claims
-			userIdStr, err := parsedToken.Claims.GetSubject()
+			//check if user exists in db
+			//will try to move this to cache, later
+			user, err := userStore.GetUserByID(ctx, userId)
 			if err != nil {
-				slog.Error("faield to extract user info from claims subject", "error", err)
-				w.WriteHeader(http.StatusUnauthorized)
+				slog.ErrorContext(ctx, "user could not be found in database", "error", err)
+				writeProblem(w, newProblem(r, http.StatusUnauthorized, CodeUnauthorized, "the user of the credentials no longer exists"))
 				return
 			}
-			//convert userId as uuid
-			userId, err := uuid.Parse(userIdStr)
-			if err != nil {
-				slog.Error("failed to parse the userId into uuid type", "error", err)
-				w.WriteHeader(http.StatusUnauthorized)
+
+			if user.Disabled() {
+				writeProblem(w, newProblem(r, http.StatusForbidden, CodeAccountDisabled, "account disabled"))
 				return
 			}
-			//check if user exists in db
-			//will try to move this to cache, later
-			user, err := userStore.GetUserByID(r.Context(), userId)
-			if err != nil {
-				slog.Error("user could not be found in database", "error", err)
-				w.WriteHeader(http.StatusUnauthorized)
+			if issuedAt != nil && user.TokenRevoked(*issuedAt) {
+				writeProblem(w, newProblem(r, http.StatusUnauthorized, CodeTokenRevoked, "the access token has been revoked"))
 				return
 			}
 
-			next.ServeHTTP(w, r.WithContext(ContextWithUser(r.Context(), user)))
+			//a demoted user loses scopes right away, even with a valid token
+			ctx = ContextWithScopes(ctx, grantedScopes(user.Role, requestedScopes))
+			ctx = ContextWithPrincipal(ctx, &Principal{User: user, Client: client})
+			accessLogFromContext(ctx).userId = user.Id.String()
+			next.ServeHTTP(w, r.WithContext(ContextWithUser(ctx, user)))
 
 		})
 	}
@@ -0,0 +1,131 @@
+package apiserver
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"asyncapi/store"
+)
+
+// OAuthTokenRequest is the form body of the token endpoint. The client
+// credentials can be sent with HTTP Basic authentication instead.
+type OAuthTokenRequest struct {
+	GrantType    string `json:"grant_type"`
+	Scope        string `json:"scope,omitempty"`
+	ClientId     string `json:"client_id,omitempty"`
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+// OAuthTokenResponse is the successful response of the token endpoint, see
+// RFC 6749 section 5.1.
+type OAuthTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope,omitempty"`
+}
+
+// OAuthErrorResponse is the error response of the token endpoint, see RFC
+// 6749 section 5.2.
+type OAuthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+func writeOAuthJson(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	//token responses must never be cached
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("failed to encode oauth response", "error", err)
+	}
+}
+
+// writeOAuthError answers with the error format of RFC 6749 rather than a
+// problem, since that is what OAuth client libraries parse.
+func writeOAuthError(w http.ResponseWriter, status int, code, description string) {
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	writeOAuthJson(w, status, OAuthErrorResponse{Error: code, ErrorDescription: description})
+}
+
+// clientCredentials reads the client ID and secret from HTTP Basic
+// authentication, or else from the form body.
+func clientCredentials(r *http.Request) (string, string) {
+	if id, secret, ok := r.BasicAuth(); ok {
+		//RFC 6749 form-encodes the credentials before Basic encoding them
+		if unescaped, err := url.QueryUnescape(id); err == nil {
+			id = unescaped
+		}
+		if unescaped, err := url.QueryUnescape(secret); err == nil {
+			secret = unescaped
+		}
+		return id, secret
+	}
+	return r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+}
+
+// oauthTokenHandler implements the token endpoint for the client_credentials
+// grant. The scope parameter narrows the scopes registered for the client,
+// all of which are granted when it is omitted.
+func (s *ApiServer) oauthTokenHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, 1<<16)
+		if err := r.ParseForm(); err != nil {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_request", "malformed form body")
+			return
+		}
+		if grantType := r.PostFormValue("grant_type"); grantType != "client_credentials" {
+			writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "only client_credentials is supported")
+			return
+		}
+
+		clientId, secret := clientCredentials(r)
+		if clientId == "" || secret == "" {
+			writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "client authentication is required")
+			return
+		}
+		client, err := s.store.OAuthClients.Authenticate(r.Context(), clientId, secret)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) || errors.Is(err, store.ErrOAuthClientRevoked) {
+				writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "invalid client credentials")
+				return
+			}
+			s.logger.ErrorContext(r.Context(), "failed to authenticate oauth client", "client_id", clientId, "error", err)
+			writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+			return
+		}
+
+		scopes := []string(client.Scopes)
+		if requested := r.PostFormValue("scope"); requested != "" {
+			scopes = strings.Fields(requested)
+			for _, scope := range scopes {
+				if !slices.Contains(client.Scopes, scope) {
+					writeOAuthError(w, http.StatusBadRequest, "invalid_scope", "scope "+scope+" is not allowed for this client")
+					return
+				}
+			}
+		}
+
+		token, err := s.jwtManager.GenerateClientToken(client.Id, scopes)
+		if err != nil {
+			s.logger.ErrorContext(r.Context(), "failed to issue oauth client token", "client_id", clientId, "error", err)
+			writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+			return
+		}
+		writeOAuthJson(w, http.StatusOK, OAuthTokenResponse{
+			AccessToken: token.Raw,
+			TokenType:   "Bearer",
+			ExpiresIn:   int(ClientTokenTTL.Seconds()),
+			Scope:       strings.Join(scopes, " "),
+		})
+	}
+}
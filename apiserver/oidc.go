@@ -0,0 +1,102 @@
+package apiserver
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"asyncapi/oidc"
+)
+
+// oidcStateCookie keeps the state and nonce of a sign in attempt between the
+// redirect to the provider and the callback.
+const oidcStateCookie = "oidc_state"
+
+const oidcStateTTL = 10 * time.Minute
+
+func (s *ApiServer) setOidcStateCookie(w http.ResponseWriter, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/auth/oidc",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(s.config.OidcRedirectUrl, "https://"),
+		//the provider redirects back with a top level GET, which Lax allows
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// oidcLoginHandler redirects the browser to the OpenID provider.
+func (s *ApiServer) oidcLoginHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		if s.oidcProvider == nil {
+			return NewErrWithStatus(http.StatusNotFound, errors.New("single sign-on is not configured"))
+		}
+		state, nonce, err := oidc.NewState()
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		authUrl, err := s.oidcProvider.AuthCodeUrl(r.Context(), state, nonce)
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadGateway, err)
+		}
+
+		value := oidc.EncodeState([]byte(s.config.JwtSecret), state, nonce, time.Now().Add(oidcStateTTL))
+		s.setOidcStateCookie(w, value, int(oidcStateTTL.Seconds()))
+		http.Redirect(w, r, authUrl, http.StatusFound)
+		return nil
+	})
+}
+
+// oidcCallbackHandler completes the sign in once the provider redirects back:
+// the code is exchanged for an ID token, whose verified email is linked to a
+// user, and the sign in completes like a password signin. Users who enabled
+// TOTP answer its challenge too: the first SSO sign in links the account with
+// the same email, which must not bypass its second factor.
+func (s *ApiServer) oidcCallbackHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		if s.oidcProvider == nil {
+			return NewErrWithStatus(http.StatusNotFound, errors.New("single sign-on is not configured"))
+		}
+		query := r.URL.Query()
+		if providerErr := query.Get("error"); providerErr != "" {
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("provider denied the sign in: %s %s", providerErr, query.Get("error_description")))
+		}
+
+		cookie, err := r.Cookie(oidcStateCookie)
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, errors.New("missing sign in state, start again from /auth/oidc/login"))
+		}
+		//the state is single use
+		s.setOidcStateCookie(w, "", -1)
+		state, nonce, err := oidc.DecodeState([]byte(s.config.JwtSecret), cookie.Value, time.Now())
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+		if subtle.ConstantTimeCompare([]byte(state), []byte(query.Get("state"))) != 1 {
+			return NewErrWithStatus(http.StatusBadRequest, oidc.ErrInvalidState)
+		}
+		code := query.Get("code")
+		if code == "" {
+			return NewErrWithStatus(http.StatusBadRequest, errors.New("code is required"))
+		}
+
+		claims, err := s.oidcProvider.Exchange(r.Context(), code, nonce)
+		if err != nil {
+			return NewErrWithStatus(http.StatusUnauthorized, err)
+		}
+		if claims.Email == "" || !claims.EmailVerified {
+			return NewErrWithStatus(http.StatusForbidden, errors.New("the provider did not return a verified email")).Public()
+		}
+
+		user, err := s.store.Identities.SigninExternal(r.Context(), s.oidcProvider.Issuer(), claims.Subject, claims.Email)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		return s.completeSignin(w, r, user)
+	})
+}
@@ -0,0 +1,113 @@
+package apiserver
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+
+	"asyncapi/oidc"
+	"asyncapi/totp"
+)
+
+// newFakeIssuer serves an OpenID provider answering every code with an ID
+// token for the claims.
+func newFakeIssuer(t *testing.T, claims func(issuer string) oidc.Claims) *httptest.Server {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	var issuer *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidc.Metadata{
+			Issuer:                issuer.URL,
+			AuthorizationEndpoint: issuer.URL + "/authorize",
+			TokenEndpoint:         issuer.URL + "/token",
+			JwksUri:               issuer.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims(issuer.URL))
+		token.Header["kid"] = "test"
+		raw, err := token.SignedString(key)
+		require.NoError(t, err)
+		json.NewEncoder(w).Encode(map[string]string{"id_token": raw})
+	})
+	issuer = httptest.NewServer(mux)
+	t.Cleanup(issuer.Close)
+	return issuer
+}
+
+func TestOidcCallback_MfaEnabledUser(t *testing.T) {
+	s, _ := newStoreTestServer(t)
+	ctx := context.Background()
+	user, err := s.store.Users.CreateUser(ctx, "test@test.com", "testpassword")
+	require.NoError(t, err)
+	_, err = s.store.Users.MarkVerified(ctx, user.Id)
+	require.NoError(t, err)
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+	require.NoError(t, s.store.Users.SetTotpSecret(ctx, user.Id, secret))
+	require.NoError(t, s.store.Users.EnableTotp(ctx, user.Id))
+
+	issuer := newFakeIssuer(t, func(issuer string) oidc.Claims {
+		return oidc.Claims{
+			Email:         "test@test.com",
+			EmailVerified: true,
+			Nonce:         "nonce",
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    issuer,
+				Subject:   "subject",
+				Audience:  jwt.ClaimStrings{"client"},
+				IssuedAt:  jwt.NewNumericDate(time.Now()),
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			},
+		}
+	})
+	s.oidcProvider = oidc.NewProvider(oidc.Config{
+		Issuer:       issuer.URL,
+		ClientId:     "client",
+		ClientSecret: "secret",
+		RedirectUrl:  "http://localhost/auth/oidc/callback",
+	}, issuer.Client())
+
+	//the first SSO sign in links the account, it must not skip its TOTP
+	r := httptest.NewRequest(http.MethodGet, "/auth/oidc/callback?"+url.Values{"code": {"code"}, "state": {"state"}}.Encode(), nil)
+	r.AddCookie(&http.Cookie{
+		Name:  oidcStateCookie,
+		Value: oidc.EncodeState([]byte(s.config.JwtSecret), "state", "nonce", time.Now().Add(time.Minute)),
+	})
+	w := httptest.NewRecorder()
+	s.oidcCallbackHandler().ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var response ApiResponse[SigninResponse]
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	require.True(t, response.Data.MfaRequired)
+	require.NotEmpty(t, response.Data.MfaToken)
+	require.Empty(t, response.Data.AccessToken)
+	require.Empty(t, response.Data.RefreshToken)
+
+	identities, err := s.store.Identities.ListByUser(ctx, user.Id)
+	require.NoError(t, err)
+	require.Len(t, identities, 1)
+}
@@ -0,0 +1,262 @@
+package apiserver
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"asyncapi/jsonschema"
+	"asyncapi/reports"
+)
+
+// OpenApiDocument is an OpenAPI 3.1 document, with only the fields the
+// generator fills in.
+type OpenApiDocument struct {
+	OpenApi    string                                  `json:"openapi"`
+	Info       OpenApiInfo                             `json:"info"`
+	Tags       []OpenApiTag                            `json:"tags"`
+	Paths      map[string]map[string]*OpenApiOperation `json:"paths"`
+	Components OpenApiComponents                       `json:"components"`
+}
+
+type OpenApiInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type OpenApiTag struct {
+	Name string `json:"name"`
+}
+
+type OpenApiComponents struct {
+	Schemas         map[string]*jsonschema.Schema    `json:"schemas"`
+	SecuritySchemes map[string]OpenApiSecurityScheme `json:"securitySchemes"`
+}
+
+type OpenApiSecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	In           string `json:"in,omitempty"`
+	Name         string `json:"name,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+type OpenApiOperation struct {
+	OperationId string                      `json:"operationId"`
+	Summary     string                      `json:"summary"`
+	Tags        []string                    `json:"tags"`
+	Parameters  []OpenApiParameter          `json:"parameters,omitempty"`
+	RequestBody *OpenApiRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*OpenApiResponse `json:"responses"`
+	//Security lists the schemes that are accepted, with the scope as role
+	Security []map[string][]string `json:"security,omitempty"`
+}
+
+type OpenApiParameter struct {
+	Name        string             `json:"name"`
+	In          string             `json:"in"`
+	Required    bool               `json:"required,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Schema      *jsonschema.Schema `json:"schema"`
+}
+
+type OpenApiRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]OpenApiMediaType `json:"content"`
+}
+
+type OpenApiResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]OpenApiMediaType `json:"content,omitempty"`
+}
+
+type OpenApiMediaType struct {
+	Schema *jsonschema.Schema `json:"schema"`
+}
+
+// pathParamPattern matches the wildcards of a route pattern.
+var pathParamPattern = regexp.MustCompile(`\{([A-Za-z0-9_]+)\}`)
+
+// openApiDocument builds the OpenAPI document of the routes.
+func (s *ApiServer) openApiDocument() *OpenApiDocument {
+	g := jsonschema.NewGenerator("apiserver")
+	doc := &OpenApiDocument{
+		OpenApi: "3.1.0",
+		Info: OpenApiInfo{
+			Title:   "asyncapi",
+			Version: "1.0.0",
+			Description: "Reports are requested with POST /reports and built asynchronously by the worker. " +
+				"Errors are RFC 7807 problem details identified by their code.",
+		},
+		Paths: map[string]map[string]*OpenApiOperation{},
+		Components: OpenApiComponents{
+			Schemas: g.Schemas,
+			SecuritySchemes: map[string]OpenApiSecurityScheme{
+				"bearerAuth": {Type: "http", Scheme: "bearer", BearerFormat: "JWT",
+					Description: "An access token from /auth/signin or a client token from /oauth/token."},
+				"apiKey": {Type: "apiKey", In: "header", Name: "Authorization",
+					Description: "An API key sent as `Authorization: ApiKey <key>`."},
+			},
+		},
+	}
+	g.Schema(reflect.TypeFor[Problem]())
+
+	for _, route := range s.routes() {
+		method, path, _ := strings.Cut(route.pattern, " ")
+		if !slices.ContainsFunc(doc.Tags, func(tag OpenApiTag) bool { return tag.Name == route.tag }) {
+			doc.Tags = append(doc.Tags, OpenApiTag{Name: route.tag})
+		}
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = map[string]*OpenApiOperation{}
+		}
+		doc.Paths[path][strings.ToLower(method)] = s.openApiOperation(g, route, method, path)
+	}
+	return doc
+}
+
+func (s *ApiServer) openApiOperation(g *jsonschema.Generator, route route, method, path string) *OpenApiOperation {
+	op := &OpenApiOperation{
+		OperationId: operationId(method, path),
+		Summary:     route.summary,
+		Tags:        []string{route.tag},
+		Responses:   map[string]*OpenApiResponse{},
+	}
+
+	params := pathParamPattern.FindAllStringSubmatch(path, -1)
+	for _, param := range params {
+		//every path parameter of the API is an ID
+		op.Parameters = append(op.Parameters, OpenApiParameter{
+			Name: param[1], In: "path", Required: true, Schema: &jsonschema.Schema{Type: "string", Format: "uuid"},
+		})
+	}
+	for _, param := range route.query {
+		schema := &jsonschema.Schema{Type: "string", Format: param.format}
+		if param.format == "int32" {
+			schema.Type = "integer"
+		}
+		op.Parameters = append(op.Parameters, OpenApiParameter{
+			Name: param.name, In: "query", Description: param.description, Schema: schema,
+		})
+	}
+
+	if route.request != nil {
+		op.RequestBody = &OpenApiRequestBody{
+			Required: true,
+			Content:  map[string]OpenApiMediaType{mediaType(route.requestType): {Schema: g.Schema(reflect.TypeOf(route.request))}},
+		}
+	}
+
+	success := &OpenApiResponse{Description: http.StatusText(route.status)}
+	if route.response != nil {
+		success.Content = map[string]OpenApiMediaType{mediaType(route.responseType): {Schema: g.Schema(reflect.TypeOf(route.response))}}
+	}
+	op.Responses[strconv.Itoa(route.status)] = success
+
+	errorResponse := route.errorResponse
+	if errorResponse == nil {
+		errorResponse = Problem{}
+	}
+	errorType := "application/json"
+	if _, ok := errorResponse.(Problem); ok {
+		errorType = "application/problem+json"
+	}
+	errorContent := map[string]OpenApiMediaType{errorType: {Schema: g.Schema(reflect.TypeOf(errorResponse))}}
+	addError := func(status int, description string) {
+		op.Responses[strconv.Itoa(status)] = &OpenApiResponse{Description: description, Content: errorContent}
+	}
+	if route.request != nil || len(params) > 0 || len(route.query) > 0 {
+		addError(http.StatusBadRequest, "The request is malformed or invalid.")
+	}
+	if !route.public {
+		addError(http.StatusUnauthorized, "Credentials are missing or invalid.")
+		scopes := []string{}
+		if route.scope != "" {
+			scopes = []string{route.scope}
+			addError(http.StatusForbidden, fmt.Sprintf("The credentials lack the %s scope.", route.scope))
+		}
+		//access tokens of OAuth clients are bearer tokens too, sessionUserFromContext
+		//refuses them at runtime, which OpenAPI can't express
+		op.Security = []map[string][]string{{"bearerAuth": scopes}, {"apiKey": scopes}}
+		if route.session {
+			op.Security = []map[string][]string{{"bearerAuth": scopes}}
+			addError(http.StatusForbidden, "Only signed in users may call this operation, API keys and OAuth clients are refused.")
+		}
+	}
+	if len(params) > 0 {
+		addError(http.StatusNotFound, "The resource does not exist.")
+	}
+	if rateLimitGroup(path) != "" {
+		addError(http.StatusTooManyRequests, "The rate limit is exceeded, see the Retry-After header.")
+	}
+	op.Responses["default"] = &OpenApiResponse{Description: "Unexpected error.", Content: errorContent}
+	return op
+}
+
+// operationId turns "GET /admin/users/{userId}" into "getAdminUsersUserId".
+func operationId(method, path string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+	for _, word := range strings.FieldsFunc(path, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	}) {
+		b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	return b.String()
+}
+
+func mediaType(contentType string) string {
+	if contentType == "" {
+		return "application/json"
+	}
+	return contentType
+}
+
+// openApiHandler serves the OpenAPI document.
+func (s *ApiServer) openApiHandler() http.HandlerFunc {
+	return documentHandler(func() any { return s.openApiDocument() })
+}
+
+// asyncApiHandler serves the AsyncAPI document of the reports queue.
+func (s *ApiServer) asyncApiHandler() http.HandlerFunc {
+	return documentHandler(func() any { return reports.NewAsyncApiDocument(s.config.SqsQueue) })
+}
+
+// documentHandler serves the JSON document, built on the first request.
+func documentHandler(build func() any) http.HandlerFunc {
+	document := sync.OnceValues(func() ([]byte, error) {
+		return json.Marshal(build())
+	})
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		body, err := document()
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, fmt.Errorf("failed to encode the document: %w", err))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+		return nil
+	})
+}
+
+//go:embed docs.html
+var docsPage []byte
+
+// docsHandler serves a page rendering /openapi.json. It is self-contained so
+// the docs work without access to a CDN.
+func docsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'unsafe-inline'; style-src 'unsafe-inline'")
+		w.WriteHeader(http.StatusOK)
+		w.Write(docsPage)
+	}
+}
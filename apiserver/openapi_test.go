@@ -0,0 +1,169 @@
+package apiserver
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"asyncapi/cache"
+	"asyncapi/config"
+	"asyncapi/health"
+	"asyncapi/reports"
+	"asyncapi/store"
+)
+
+func newDocsTestServer() *ApiServer {
+	return &ApiServer{
+		config:  &config.Config{},
+		logger:  slog.Default(),
+		metrics: NewMetrics(func() cache.Stats { return cache.Stats{} }),
+		health:  health.NewChecker(slog.Default(), time.Second, 0),
+	}
+}
+
+func TestOpenApi_CoversEveryRoute(t *testing.T) {
+	//the mux Start serves, with whatever is registered besides the route table
+	s := newChainTestServer(&config.Config{})
+	_, mux := s.handler()
+	patterns := mux.patterns
+	require.NotEmpty(t, patterns)
+	isPublic := publicRoutes(mux.ServeMux, s.routes())
+
+	//the served document, not the Go value, is what clients generate from
+	w := httptest.NewRecorder()
+	s.openApiHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var doc OpenApiDocument
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&doc))
+	require.Equal(t, "3.1.0", doc.OpenApi)
+
+	operations := 0
+	for _, item := range doc.Paths {
+		operations += len(item)
+	}
+	require.Equal(t, len(patterns), operations, "the document has operations that are not served")
+	for _, pattern := range patterns {
+		method, path, _ := strings.Cut(pattern, " ")
+		op := doc.Paths[path][strings.ToLower(method)]
+		require.NotNil(t, op, "%s is missing from the OpenAPI document", pattern)
+		require.NotEmpty(t, op.Summary, "%s has no summary", pattern)
+		require.NotEmpty(t, op.Tags, "%s has no tag", pattern)
+		require.Contains(t, op.Responses, "default", "%s has no error response", pattern)
+		if isPublic(httptest.NewRequest(method, path, nil)) {
+			require.Empty(t, op.Security, "%s is public", pattern)
+		} else {
+			require.NotEmpty(t, op.Security, "%s requires credentials", pattern)
+			require.Contains(t, op.Responses, "401", "%s", pattern)
+		}
+	}
+}
+
+func TestRegisterRoutes_EnforcesDocumentedRequirements(t *testing.T) {
+	s := newChainTestServer(&config.Config{})
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	doc := s.openApiDocument()
+	user := &store.User{Id: uuid.New(), Role: store.RoleAdmin}
+	auth := NewAuthMiddleware(nil, nil, nil, nil, publicRoutes(mux, s.routes()))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for _, route := range s.routes() {
+		method, path, _ := strings.Cut(route.pattern, " ")
+		security := doc.Paths[path][strings.ToLower(method)].Security
+		url := strings.NewReplacer("{id}", uuid.NewString(), "{userId}", uuid.NewString(), "{org}", uuid.NewString()).Replace(path)
+
+		//only the public routes are let through without credentials
+		w := httptest.NewRecorder()
+		auth.ServeHTTP(w, httptest.NewRequest(method, url, nil))
+		if route.public {
+			require.Equal(t, http.StatusNoContent, w.Code, route.pattern)
+		} else {
+			require.Equal(t, http.StatusUnauthorized, w.Code, route.pattern)
+		}
+
+		//an API key with every scope is only refused by session routes
+		r := httptest.NewRequest(method, url, nil)
+		ctx := ContextWithScopes(ContextWithUser(r.Context(), user), ScopesForRole(store.RoleAdmin))
+		ctx = ContextWithApiKey(ctx, &store.ApiKey{Id: uuid.New(), UserId: user.Id})
+		w = httptest.NewRecorder()
+		if route.session {
+			mux.ServeHTTP(w, r.WithContext(ctx))
+			require.Equal(t, http.StatusForbidden, w.Code, route.pattern)
+			require.Contains(t, w.Body.String(), CodeSignInRequired, route.pattern)
+			require.Equal(t, []map[string][]string{{"bearerAuth": {}}}, security, route.pattern)
+		} else if !route.public {
+			require.Len(t, security, 2, "%s accepts API keys", route.pattern)
+		}
+
+		//a user without scopes is refused by scoped routes
+		if route.scope != "" {
+			r = httptest.NewRequest(method, url, nil)
+			w = httptest.NewRecorder()
+			mux.ServeHTTP(w, r.WithContext(ContextWithScopes(ContextWithUser(r.Context(), user), []string{})))
+			require.Equal(t, http.StatusForbidden, w.Code, route.pattern)
+			require.Contains(t, w.Body.String(), CodeInsufficientScope, route.pattern)
+			require.Equal(t, []string{route.scope}, security[0]["bearerAuth"], route.pattern)
+		}
+	}
+}
+
+func TestOpenApi_Schemas(t *testing.T) {
+	doc := newDocsTestServer().openApiDocument()
+	schemas := doc.Components.Schemas
+
+	report := schemas["ApiReport"]
+	require.NotNil(t, report)
+	require.Equal(t, "uuid", report.Properties["id"].Format)
+	require.Equal(t, "date-time", report.Properties["created_at"].Format)
+	require.Equal(t, []string{"id", "user_id"}, report.Required)
+	require.Equal(t, []string{"email", "password"}, schemas["SignupRequest"].Required)
+	require.Contains(t, schemas, "Problem")
+
+	op := doc.Paths["/reports"]["post"]
+	require.Equal(t, "#/components/schemas/CreateReportRequest", op.RequestBody.Content["application/json"].Schema.Ref)
+	//the ApiResponse envelope is inlined around the data
+	created := op.Responses["201"].Content["application/json"].Schema
+	require.Equal(t, "#/components/schemas/ApiReport", created.Properties["data"].Ref)
+	require.Equal(t, "string", created.Properties["message"].Type)
+	require.Equal(t, []map[string][]string{{"bearerAuth": {ScopeReportsWrite}}, {"apiKey": {ScopeReportsWrite}}}, op.Security)
+	require.Equal(t, "#/components/schemas/Problem", op.Responses["429"].Content["application/problem+json"].Schema.Ref)
+
+	list := doc.Paths["/admin/reports"]["get"].Responses["200"].Content["application/json"].Schema
+	require.Equal(t, "array", list.Properties["data"].Type)
+	require.Equal(t, "#/components/schemas/ApiReport", list.Properties["data"].Items.Ref)
+}
+
+func TestDocsHandler(t *testing.T) {
+	mux := http.NewServeMux()
+	newDocsTestServer().registerRoutes(mux)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	require.Contains(t, w.Body.String(), `fetch("/openapi.json")`)
+}
+
+func TestAsyncApi_ReportMessage(t *testing.T) {
+	s := newDocsTestServer()
+	s.config.SqsQueue = "reports-queue"
+	w := httptest.NewRecorder()
+	s.asyncApiHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/asyncapi.json", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var doc reports.AsyncApiDocument
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&doc))
+	require.Equal(t, "reports-queue", doc.Channels["reports"].Address)
+
+	//the message enqueueReport sends must match the document
+	body, err := reportMessageBody(context.Background(), &store.Report{Id: uuid.New(), UserId: uuid.New()})
+	require.NoError(t, err)
+	require.NoError(t, doc.ValidateMessage(reports.MessageGenerateReport, body))
+}
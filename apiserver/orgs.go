@@ -0,0 +1,306 @@
+package apiserver
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"asyncapi/store"
+)
+
+// maxOrgReports bounds the number of reports listed for an organization.
+const maxOrgReports = 100
+
+type CreateOrgRequest struct {
+	Name string `json:"name"`
+}
+
+func (r CreateOrgRequest) Validate() error {
+	var errs ValidationErrors
+	if r.Name == "" {
+		errs.Add("name", "name is required")
+	} else if len(r.Name) > 100 {
+		errs.Add("name", "name must be at most 100 characters")
+	}
+	return errs.Err()
+}
+
+type OrgResponse struct {
+	Id        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type AddMemberRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+func (r AddMemberRequest) Validate() error {
+	var errs ValidationErrors
+	if r.Email == "" {
+		errs.Add("email", "email is required")
+	}
+	if r.Role != store.OrgRoleAdmin && r.Role != store.OrgRoleMember {
+		errs.Add("role", fmt.Sprintf("role must be %q or %q", store.OrgRoleAdmin, store.OrgRoleMember))
+	}
+	return errs.Err()
+}
+
+type MemberResponse struct {
+	UserId    uuid.UUID `json:"user_id"`
+	Email     string    `json:"email,omitempty"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// orgMembership returns the membership of the user in the organization. Non
+// members get a 404 so they can't tell which organizations exist.
+func (s *ApiServer) orgMembership(r *http.Request, orgId, userId uuid.UUID) (*store.Membership, error) {
+	membership, err := s.store.Orgs.GetMembership(r.Context(), orgId, userId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, NewErrWithStatus(http.StatusNotFound, errors.New("organization not found")).WithCode(CodeOrgNotFound)
+		}
+		return nil, NewErrWithStatus(http.StatusInternalServerError, err)
+	}
+	return membership, nil
+}
+
+// orgFromPath returns the organization in the path and the membership of the
+// user in it, requiring the given role when it's not empty.
+func (s *ApiServer) orgFromPath(r *http.Request, user *store.User, role string) (uuid.UUID, *store.Membership, error) {
+	orgId, err := uuid.Parse(r.PathValue("org"))
+	if err != nil {
+		return uuid.Nil, nil, NewErrWithStatus(http.StatusBadRequest, err)
+	}
+	membership, err := s.orgMembership(r, orgId, user.Id)
+	if err != nil {
+		return uuid.Nil, nil, err
+	}
+	if role != "" && membership.Role != role {
+		return uuid.Nil, nil, NewErrWithStatus(http.StatusForbidden, fmt.Errorf("organization %s role required", role)).Public()
+	}
+	return orgId, membership, nil
+}
+
+// createOrgHandler creates an organization with the signed in user as admin.
+func (s *ApiServer) createOrgHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		req, err := decode[CreateOrgRequest](r)
+		if err != nil {
+			return err
+		}
+		user, err := sessionUserFromContext(r)
+		if err != nil {
+			return err
+		}
+
+		org, err := s.store.Orgs.Create(r.Context(), req.Name, user.Id)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		if err := encode(ApiResponse[OrgResponse]{
+			Data: &OrgResponse{
+				Id:        org.Id,
+				Name:      org.Name,
+				Role:      store.OrgRoleAdmin,
+				CreatedAt: org.CreatedAt,
+			},
+		}, http.StatusCreated, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		return nil
+	})
+}
+
+// listOrgsHandler lists the organizations the user is a member of.
+func (s *ApiServer) listOrgsHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+		}
+
+		orgs, err := s.store.Orgs.ListForUser(r.Context(), user.Id)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		response := make([]OrgResponse, 0, len(orgs))
+		for _, org := range orgs {
+			response = append(response, OrgResponse{
+				Id:        org.Id,
+				Name:      org.Name,
+				Role:      org.Role,
+				CreatedAt: org.CreatedAt,
+			})
+		}
+
+		if err := encode(ApiResponse[[]OrgResponse]{Data: &response}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		return nil
+	})
+}
+
+// listOrgMembersHandler lists the members of an organization to its members.
+func (s *ApiServer) listOrgMembersHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+		}
+		orgId, _, err := s.orgFromPath(r, user, "")
+		if err != nil {
+			return err
+		}
+
+		members, err := s.store.Orgs.ListMembers(r.Context(), orgId)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		response := make([]MemberResponse, 0, len(members))
+		for _, member := range members {
+			response = append(response, MemberResponse{
+				UserId:    member.UserId,
+				Email:     member.Email,
+				Role:      member.Role,
+				CreatedAt: member.CreatedAt,
+			})
+		}
+
+		if err := encode(ApiResponse[[]MemberResponse]{Data: &response}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		return nil
+	})
+}
+
+// addOrgMemberHandler lets organization admins add an existing user by email
+// or change the role of a member. The last admin cannot be demoted.
+func (s *ApiServer) addOrgMemberHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		req, err := decode[AddMemberRequest](r)
+		if err != nil {
+			return err
+		}
+		user, err := sessionUserFromContext(r)
+		if err != nil {
+			return err
+		}
+		orgId, _, err := s.orgFromPath(r, user, store.OrgRoleAdmin)
+		if err != nil {
+			return err
+		}
+
+		member, err := s.store.Users.GetUserByEmail(r.Context(), req.Email)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return NewErrWithStatus(http.StatusNotFound, errors.New("user not found")).WithCode(CodeUserNotFound)
+			}
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		membership, err := s.store.Orgs.AddMember(r.Context(), orgId, member.Id, req.Role)
+		if err != nil {
+			if errors.Is(err, store.ErrLastOrgAdmin) {
+				return NewErrWithStatus(http.StatusConflict, store.ErrLastOrgAdmin).WithCode(CodeLastOrgAdmin)
+			}
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		if err := encode(ApiResponse[MemberResponse]{
+			Data: &MemberResponse{
+				UserId:    membership.UserId,
+				Email:     member.Email,
+				Role:      membership.Role,
+				CreatedAt: membership.CreatedAt,
+			},
+		}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		return nil
+	})
+}
+
+// removeOrgMemberHandler lets organization admins remove a member, and any
+// member leave the organization, except its last admin.
+func (s *ApiServer) removeOrgMemberHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, err := sessionUserFromContext(r)
+		if err != nil {
+			return err
+		}
+		memberId, err := uuid.Parse(r.PathValue("userId"))
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+		role := store.OrgRoleAdmin
+		if memberId == user.Id {
+			role = ""
+		}
+		orgId, _, err := s.orgFromPath(r, user, role)
+		if err != nil {
+			return err
+		}
+
+		if err := s.store.Orgs.RemoveMember(r.Context(), orgId, memberId); err != nil {
+			switch {
+			case errors.Is(err, store.ErrLastOrgAdmin):
+				return NewErrWithStatus(http.StatusConflict, store.ErrLastOrgAdmin).WithCode(CodeLastOrgAdmin)
+			case errors.Is(err, sql.ErrNoRows):
+				return NewErrWithStatus(http.StatusNotFound, err)
+			}
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		if err := encode(ApiResponse[struct{}]{
+			Message: "member removed",
+		}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		return nil
+	})
+}
+
+// listOrgReportsHandler lists the reports shared with an organization, newest
+// first. The number of reports can be limited with ?limit=.
+func (s *ApiServer) listOrgReportsHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+		}
+		orgId, _, err := s.orgFromPath(r, user, "")
+		if err != nil {
+			return err
+		}
+		limit := maxOrgReports
+		if v := r.URL.Query().Get("limit"); v != "" {
+			limit, err = strconv.Atoi(v)
+			if err != nil || limit < 1 || limit > maxOrgReports {
+				return NewErrWithStatus(http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d", maxOrgReports))
+			}
+		}
+
+		reports, err := s.store.ReportStore.ListByOrg(r.Context(), orgId, limit)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		response := make([]ApiReport, 0, len(reports))
+		for i := range reports {
+			response = append(response, *newApiReport(&reports[i]))
+		}
+
+		if err := encode(ApiResponse[[]ApiReport]{Data: &response}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,106 @@
+package apiserver
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"asyncapi/mailer"
+)
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+func (r ForgotPasswordRequest) Validate() error {
+	var errs ValidationErrors
+	if r.Email == "" {
+		errs.Add("email", "email is required")
+	}
+	return errs.Err()
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+func (r ResetPasswordRequest) Validate() error {
+	var errs ValidationErrors
+	if r.Token == "" {
+		errs.Add("token", "token is required")
+	}
+	if r.Password == "" {
+		errs.Add("password", "password is required")
+	}
+	return errs.Err()
+}
+
+func (r ResetPasswordRequest) PasswordField() (string, string) {
+	return "password", r.Password
+}
+
+// forgotPasswordHandler emails a single-use password reset token to the user.
+// It responds with 202 whether or not the email belongs to an account, so the
+// endpoint cannot be used to discover registered emails.
+func (s *ApiServer) forgotPasswordHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		req, err := decode[ForgotPasswordRequest](r)
+		if err != nil {
+			return err
+		}
+
+		user, err := s.store.Users.GetUserByEmail(r.Context(), req.Email)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		if user != nil {
+			token, _, err := s.store.PasswordResets.Create(r.Context(), user.Id, s.config.PasswordResetTTL)
+			if err != nil {
+				return NewErrWithStatus(http.StatusInternalServerError, err)
+			}
+			if err := s.mailer.Send(r.Context(), mailer.Message{
+				To:      user.Email,
+				Subject: "Reset your password",
+				Body: fmt.Sprintf("Use the following token to reset your password. It expires in %s and can only be used once.\n\n%s\n",
+					s.config.PasswordResetTTL, token),
+			}); err != nil {
+				s.logger.ErrorContext(r.Context(), "failed to send password reset email", "user_id", user.Id, "error", err)
+			}
+		}
+
+		if err := encode(ApiResponse[struct{}]{
+			Message: "if the account exists, a password reset email has been sent",
+		}, http.StatusAccepted, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		return nil
+	})
+}
+
+// resetPasswordHandler consumes a password reset token, sets the new password
+// and signs the user out everywhere by deleting their refresh tokens, all or
+// nothing.
+func (s *ApiServer) resetPasswordHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		req, err := decodePassword[ResetPasswordRequest](r, s.passwords)
+		if err != nil {
+			return err
+		}
+
+		if _, err := s.store.PasswordResets.Reset(r.Context(), req.Token, req.Password); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return NewErrWithStatus(http.StatusBadRequest, errors.New("invalid or expired password reset token"))
+			}
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		if err := encode(ApiResponse[struct{}]{
+			Message: "password has been reset",
+		}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,37 @@
+package apiserver
+
+import (
+	"context"
+
+	"asyncapi/store"
+)
+
+// Principal is who a request is authenticated as: a user, or an OAuth client
+// acting on behalf of the user owning it.
+type Principal struct {
+	// User is the signed in user, or the owner of Client.
+	User *store.User
+	// Client is set when the request was authenticated with a token issued
+	// through the client_credentials grant.
+	Client *store.OAuthClient
+}
+
+// IsClient reports whether the request was made by an OAuth client.
+func (p *Principal) IsClient() bool {
+	return p.Client != nil
+}
+
+type principalCtxKey struct {
+}
+
+func ContextWithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalCtxKey{}, principal)
+}
+
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalCtxKey{}).(*Principal)
+	if !ok || principal == nil {
+		return nil, false
+	}
+	return principal, true
+}
@@ -0,0 +1,260 @@
+package apiserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Error codes are part of the API contract: clients branch on them, so they
+// never change once published. Errors without a more specific code fall back
+// to the code of their status (see codeForStatus).
+const (
+	CodeBadRequest       = "bad_request"
+	CodeValidationFailed = "validation_failed"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeConflict         = "conflict"
+	CodeTooManyRequests  = "too_many_requests"
+	CodeInternal         = "internal_error"
+	CodeBadGateway       = "bad_gateway"
+
+	CodeInvalidJson          = "invalid_json"
+	CodeBodyTooLarge         = "request_too_large"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+
+	CodeRouteNotFound    = "route_not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+
+	CodeMissingCredentials = "missing_credentials"
+	CodeInvalidToken       = "invalid_token"
+	CodeTokenExpired       = "token_expired"
+	CodeTokenRevoked       = "token_revoked"
+	CodeInvalidApiKey      = "invalid_api_key"
+	CodeClientRevoked      = "client_revoked"
+	CodeInvalidCredentials = "invalid_credentials"
+	CodeInvalidMfaCode     = "invalid_mfa_code"
+	CodeAccountDisabled    = "account_disabled"
+	CodeAccountLocked      = "account_locked"
+	CodeSignInRequired     = "sign_in_required"
+	CodeInsufficientScope  = "insufficient_scope"
+	CodeEmailNotVerified   = "email_not_verified"
+	CodeEmailTaken         = "email_taken"
+	CodeQuotaExceeded      = "quota_exceeded"
+	CodeRateLimited        = "rate_limited"
+
+	CodeUserNotFound   = "user_not_found"
+	CodeReportNotFound = "report_not_found"
+	CodeOrgNotFound    = "organization_not_found"
+
+	CodeLastOrgAdmin = "last_organization_admin"
+)
+
+// tokenErrorCode returns the code for a token that failed to parse.
+func tokenErrorCode(err error) string {
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return CodeTokenExpired
+	}
+	return CodeInvalidToken
+}
+
+// codeForStatus returns the generic code of an HTTP status.
+func codeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusTooManyRequests:
+		return CodeTooManyRequests
+	case http.StatusBadGateway:
+		return CodeBadGateway
+	}
+	if status >= 500 {
+		return CodeInternal
+	}
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
+
+// Problem is an RFC 7807 problem details object, the body of every error
+// response. Type is derived from Code so it is just as stable.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestId string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError is a validation error of a single request field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors collects the field errors of a request. Validators return
+// it (through Err) so the response can point at every invalid field.
+type ValidationErrors []FieldError
+
+// Add records an error for the field.
+func (e *ValidationErrors) Add(field, message string) {
+	*e = append(*e, FieldError{Field: field, Message: message})
+}
+
+// Err returns the errors as an error, or nil when there are none.
+func (e ValidationErrors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, fieldErr := range e {
+		messages = append(messages, fieldErr.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// newProblem builds the problem for a request. The detail is only exposed for
+// client errors, server errors are described by their status text alone.
+func newProblem(r *http.Request, status int, code string, detail string) *Problem {
+	if code == "" {
+		code = codeForStatus(status)
+	}
+	if status >= 500 {
+		detail = ""
+	}
+	return &Problem{
+		Type:      "urn:asyncapi:problem:" + code,
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		Code:      code,
+		RequestId: RequestIdFromContext(r.Context()),
+	}
+}
+
+// detailedStatuses are the statuses whose error messages describe what the
+// client got wrong. Others, such as a 401 wrapping the error of the SSO
+// provider, may carry internals and only have a detail when made Public.
+var detailedStatuses = []int{
+	http.StatusBadRequest,
+	http.StatusNotFound,
+	http.StatusConflict,
+	http.StatusRequestEntityTooLarge,
+	http.StatusUnsupportedMediaType,
+	http.StatusTooManyRequests,
+}
+
+// problemFromError converts an error returned by a handler into a problem,
+// taking the status and code from an *ErrWithStatus and the field errors from
+// ValidationErrors anywhere in the chain.
+func problemFromError(r *http.Request, err error) *Problem {
+	status := http.StatusInternalServerError
+	code := ""
+	public := false
+	var statusErr *ErrWithStatus
+	if errors.As(err, &statusErr) {
+		status = statusErr.status
+		code = statusErr.code
+		public = statusErr.public
+	}
+	var fieldErrs ValidationErrors
+	isValidation := errors.As(err, &fieldErrs)
+	if code == "" && isValidation && status == http.StatusBadRequest {
+		code = CodeValidationFailed
+	}
+	detail := ""
+	if public || slices.Contains(detailedStatuses, status) {
+		detail = err.Error()
+	}
+	problem := newProblem(r, status, code, detail)
+	if isValidation && status < 500 {
+		problem.Errors = fieldErrs
+	}
+	return problem
+}
+
+// writeProblem writes the problem as an application/problem+json response.
+func writeProblem(w http.ResponseWriter, problem *Problem) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(problem.Status)
+	if err := json.NewEncoder(w).Encode(problem); err != nil {
+		slog.Error("failed to encode problem", "status", problem.Status, "code", problem.Code, "error", err)
+	}
+}
+
+type requestIdCtxKey struct {
+}
+
+// ContextWithRequestId records the id of the request.
+func ContextWithRequestId(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIdCtxKey{}, id)
+}
+
+// RequestIdFromContext returns the id of the request, or an empty string.
+func RequestIdFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIdCtxKey{}).(string)
+	return id
+}
+
+// problemFallbackWriter replaces the plain text 404 and 405 responses of the
+// mux with problems.
+type problemFallbackWriter struct {
+	http.ResponseWriter
+	r           *http.Request
+	intercepted bool
+}
+
+func (w *problemFallbackWriter) WriteHeader(status int) {
+	if status != http.StatusNotFound && status != http.StatusMethodNotAllowed {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.intercepted = true
+	code := CodeRouteNotFound
+	if status == http.StatusMethodNotAllowed {
+		code = CodeMethodNotAllowed
+	}
+	writeProblem(w.ResponseWriter, newProblem(w.r, status, code, ""))
+}
+
+func (w *problemFallbackWriter) Write(b []byte) (int, error) {
+	if w.intercepted {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// withProblemFallback serves the mux, answering requests that match no route
+// with a problem instead of the plain text of the mux.
+func withProblemFallback(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := mux.Handler(r); pattern == "" {
+			mux.ServeHTTP(&problemFallbackWriter{ResponseWriter: w, r: r}, r)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
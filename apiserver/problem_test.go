@@ -0,0 +1,49 @@
+package apiserver_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"asyncapi/apiserver"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequireScope_Problem(t *testing.T) {
+	h := apiserver.RequireScope(apiserver.ScopeAdmin, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/admin/users", nil)
+	ctx := apiserver.ContextWithRequestId(r.Context(), "req-123")
+	r = r.WithContext(apiserver.ContextWithScopes(ctx, []string{apiserver.ScopeReportsRead}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	require.Equal(t, http.StatusForbidden, w.Code)
+	require.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+
+	var problem apiserver.Problem
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&problem))
+	require.Equal(t, http.StatusForbidden, problem.Status)
+	require.Equal(t, apiserver.CodeInsufficientScope, problem.Code)
+	require.Equal(t, "urn:asyncapi:problem:insufficient_scope", problem.Type)
+	require.Equal(t, "/admin/users", problem.Instance)
+	require.Equal(t, "req-123", problem.RequestId)
+	require.Contains(t, problem.Detail, apiserver.ScopeAdmin)
+}
+
+func TestValidationErrors(t *testing.T) {
+	err := apiserver.SignupRequest{Email: "test"}.Validate()
+	var fieldErrs apiserver.ValidationErrors
+	require.True(t, errors.As(err, &fieldErrs))
+	require.Len(t, fieldErrs, 2)
+	require.Equal(t, "email", fieldErrs[0].Field)
+	require.Equal(t, "password", fieldErrs[1].Field)
+	require.Equal(t, "password is required", fieldErrs[1].Message)
+
+	require.NoError(t, apiserver.SigninRequest{Email: "test@test.com", Password: "password"}.Validate())
+}
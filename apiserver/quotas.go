@@ -0,0 +1,56 @@
+package apiserver
+
+import (
+	"fmt"
+	"net/http"
+
+	"asyncapi/store"
+)
+
+// QuotaUsage is the consumption of one quota, a zero limit is unlimited.
+type QuotaUsage struct {
+	Used  int64 `json:"used"`
+	Limit int64 `json:"limit,omitempty"`
+}
+
+type UsageResponse struct {
+	InFlightReports QuotaUsage `json:"in_flight_reports"`
+	// DailyReports counts the reports created in the last 24 hours.
+	DailyReports QuotaUsage `json:"daily_reports"`
+	StoredBytes  QuotaUsage `json:"stored_bytes"`
+}
+
+func (s *ApiServer) reportQuota() store.ReportQuota {
+	return store.ReportQuota{
+		MaxInFlight:    s.config.ReportMaxInFlight,
+		DailyLimit:     s.config.ReportDailyLimit,
+		MaxStoredBytes: s.config.ReportMaxStoredBytes,
+	}
+}
+
+// usageHandler reports the consumption of the user against their report quotas.
+func (s *ApiServer) usageHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			return NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("user not found in context"))
+		}
+
+		usage, err := s.store.ReportStore.Usage(r.Context(), user.Id)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		quota := s.reportQuota()
+
+		if err := encode(ApiResponse[UsageResponse]{
+			Data: &UsageResponse{
+				InFlightReports: QuotaUsage{Used: usage.InFlight, Limit: int64(quota.MaxInFlight)},
+				DailyReports:    QuotaUsage{Used: usage.CreatedLastDay, Limit: int64(quota.DailyLimit)},
+				StoredBytes:     QuotaUsage{Used: usage.StoredBytes, Limit: quota.MaxStoredBytes},
+			},
+		}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,57 @@
+package apiserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/stretchr/testify/require"
+
+	"asyncapi/store"
+)
+
+func TestCreateReport_EnqueueFailureReleasesQuota(t *testing.T) {
+	s, _ := newStoreTestServer(t)
+	s.config.ReportMaxInFlight = 1
+	//every SQS call fails
+	sqsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(sqsServer.Close)
+	s.sqsClient = sqs.New(sqs.Options{
+		Region:           "us-east-1",
+		BaseEndpoint:     aws.String(sqsServer.URL),
+		Credentials:      aws.AnonymousCredentials{},
+		RetryMaxAttempts: 1,
+	})
+
+	ctx := context.Background()
+	user, err := s.store.Users.CreateUser(ctx, "test@test.com", "testpassword")
+	require.NoError(t, err)
+
+	create := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/reports", strings.NewReader(`{"report_type":"monsters"}`))
+		r.Header.Set("Content-Type", "application/json")
+		r = r.WithContext(ContextWithUser(r.Context(), user))
+		w := httptest.NewRecorder()
+		s.createReportHandler().ServeHTTP(w, r)
+		return w
+	}
+	require.Equal(t, http.StatusInternalServerError, create().Code)
+
+	usage, err := s.store.ReportStore.Usage(ctx, user.Id)
+	require.NoError(t, err)
+	require.Zero(t, usage.InFlight, "the unqueued report must not hold the quota")
+	reports, err := s.store.ReportStore.ListReports(ctx, store.ReportFilter{UserId: &user.Id, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, reports, 1)
+	require.Equal(t, store.ReportStatusFailed, reports[0].Status())
+	require.Equal(t, "failed to enqueue the report", *reports[0].ErrorMessage)
+
+	//the quota of one report in flight is still available
+	require.Equal(t, http.StatusInternalServerError, create().Code)
+}
@@ -0,0 +1,151 @@
+package apiserver
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"asyncapi/ratelimit"
+)
+
+// Route groups with their own rate limit. RateLimitClient is not a group but
+// the limit of every request of a client IP, see NewClientRateLimitMiddleware.
+const (
+	RateLimitAuth    = "auth"
+	RateLimitReports = "reports"
+	RateLimitAdmin   = "admin"
+	RateLimitClient  = "client"
+)
+
+// rateLimitGroup returns the route group of the path, or an empty string for
+// routes that are not rate limited.
+func rateLimitGroup(path string) string {
+	switch {
+	case strings.HasPrefix(path, "/auth/") || strings.HasPrefix(path, "/oauth/"):
+		return RateLimitAuth
+	case strings.HasPrefix(path, "/admin/"):
+		return RateLimitAdmin
+	case strings.HasPrefix(path, "/reports") || strings.HasSuffix(path, "/reports"):
+		return RateLimitReports
+	}
+	return ""
+}
+
+func (s *ApiServer) rateLimits() map[string]ratelimit.Limit {
+	return map[string]ratelimit.Limit{
+		RateLimitAuth:    {PerMinute: s.config.RateLimitAuthPerMinute, Burst: s.config.RateLimitAuthBurst},
+		RateLimitReports: {PerMinute: s.config.RateLimitReportsPerMinute, Burst: s.config.RateLimitReportsBurst},
+		RateLimitAdmin:   {PerMinute: s.config.RateLimitAdminPerMinute, Burst: s.config.RateLimitAdminBurst},
+		RateLimitClient:  {PerMinute: s.config.RateLimitClientPerMinute, Burst: s.config.RateLimitClientBurst},
+	}
+}
+
+// seconds rounds the duration up to whole seconds for the headers.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// NewRateLimitMiddleware limits the requests of every route group, with a
+// bucket per signed in user, or per client IP for unauthenticated requests.
+// It has to run inside NewAuthMiddleware to see the user. When the limiter
+// fails the request is let through rather than taking the API down with it.
+func NewRateLimitMiddleware(limiter ratelimit.Limiter, limits map[string]ratelimit.Limit) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			group := rateLimitGroup(r.URL.Path)
+			limit, ok := limits[group]
+			if !ok || !limit.Enabled() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := group + ":ip:" + clientIP(r)
+			if user, ok := UserFromContext(r.Context()); ok {
+				key = group + ":user:" + user.Id.String()
+			}
+			if takeToken(w, r, limiter, key, limit) {
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// NewClientRateLimitMiddleware limits every request but the probes with a
+// bucket per client IP. It has to run outside NewAuthMiddleware: requests
+// with guessed or missing credentials are rejected, and valid ones looked up
+// in the database, only once they are within the limit.
+func NewClientRateLimitMiddleware(limiter ratelimit.Limiter, limit ratelimit.Limit) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !limit.Enabled() || isProbePath(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if takeToken(w, r, limiter, RateLimitClient+":ip:"+clientIP(r), limit) {
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// takeToken takes a token from the bucket of the key and sets the rate limit
+// headers. It writes a 429 and returns false when the bucket is empty.
+func takeToken(w http.ResponseWriter, r *http.Request, limiter ratelimit.Limiter, key string, limit ratelimit.Limit) bool {
+	result, err := limiter.Take(r.Context(), key, limit)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to apply the rate limit", "key", key, "error", err)
+		return true
+	}
+
+	w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%s", limit.Burst, seconds(limit.Window())))
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	w.Header().Set("RateLimit-Reset", seconds(result.Reset))
+	if !result.Allowed {
+		w.Header().Set("Retry-After", seconds(result.RetryAfter))
+		writeProblem(w, newProblem(r, http.StatusTooManyRequests, CodeRateLimited,
+			fmt.Sprintf("too many requests, retry in %s", result.RetryAfter.Round(time.Second))))
+		return false
+	}
+	return true
+}
+
+// newRateLimiter returns the limiter selected by RateLimitStore.
+func (s *ApiServer) newRateLimiter() ratelimit.Limiter {
+	switch s.config.RateLimitStore {
+	case "postgres":
+		return ratelimit.NewPostgres(s.store.RateLimits)
+	case "", "memory":
+	default:
+		s.logger.Error("unknown rate limit store, using memory", "store", s.config.RateLimitStore)
+	}
+	return ratelimit.NewMemory()
+}
+
+// deleteIdleRateLimits periodically deletes the Postgres buckets that had
+// time to refill completely, until the context is done.
+func (s *ApiServer) deleteIdleRateLimits(ctx context.Context) {
+	var idle time.Duration
+	for _, limit := range s.rateLimits() {
+		if limit.Enabled() {
+			idle = max(idle, limit.Window())
+		}
+	}
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.store.RateLimits.DeleteIdle(ctx, idle+time.Minute); err != nil {
+				s.logger.Error("failed to delete idle rate limit buckets", "error", err)
+			}
+		}
+	}
+}
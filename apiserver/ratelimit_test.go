@@ -0,0 +1,64 @@
+package apiserver_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"asyncapi/apiserver"
+	"asyncapi/ratelimit"
+	"asyncapi/store"
+)
+
+func TestNewRateLimitMiddleware(t *testing.T) {
+	h := apiserver.NewRateLimitMiddleware(ratelimit.NewMemory(), map[string]ratelimit.Limit{
+		apiserver.RateLimitAuth:    {PerMinute: 1, Burst: 2},
+		apiserver.RateLimitReports: {PerMinute: 1, Burst: 1},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	do := func(path, remoteAddr string, user *store.User) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, path, nil)
+		r.RemoteAddr = remoteAddr
+		if user != nil {
+			r = r.WithContext(apiserver.ContextWithUser(r.Context(), user))
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	//unauthenticated requests are limited per client IP
+	w := do("/auth/signin", "10.0.0.1:1234", nil)
+	require.Equal(t, http.StatusNoContent, w.Code)
+	require.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	require.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	require.Equal(t, "2;w=120", w.Header().Get("RateLimit-Policy"))
+	require.Equal(t, http.StatusNoContent, do("/auth/signin", "10.0.0.1:5678", nil).Code)
+
+	w = do("/auth/signin", "10.0.0.1:1234", nil)
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	require.Equal(t, "60", w.Header().Get("Retry-After"))
+	require.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	require.Contains(t, w.Body.String(), apiserver.CodeRateLimited)
+
+	require.Equal(t, http.StatusNoContent, do("/auth/signin", "10.0.0.2:1234", nil).Code)
+
+	//signed in users are limited per user, whatever their IP
+	user := &store.User{Id: uuid.New()}
+	require.Equal(t, http.StatusNoContent, do("/reports", "10.0.0.3:1234", user).Code)
+	require.Equal(t, http.StatusTooManyRequests, do("/reports", "10.0.0.4:1234", user).Code)
+	require.Equal(t, http.StatusNoContent, do("/reports", "10.0.0.3:1234", &store.User{Id: uuid.New()}).Code)
+
+	//groups without a limit are not limited
+	for range 3 {
+		w = do("/admin/users", "10.0.0.1:1234", user)
+		require.Equal(t, http.StatusNoContent, w.Code)
+		require.Empty(t, w.Header().Get("RateLimit-Limit"))
+	}
+}
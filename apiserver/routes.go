@@ -0,0 +1,213 @@
+package apiserver
+
+import (
+	"net/http"
+
+	"asyncapi/health"
+)
+
+// route is an endpoint of the API together with what the OpenAPI document
+// says about it. Every route is registered from this table, so an endpoint
+// can't be served without being documented.
+type route struct {
+	pattern string
+	handler http.Handler
+	tag     string
+	summary string
+	//public routes are served without credentials, see publicRoutes
+	public bool
+	//scope is required from every credential, registerRoutes wraps the
+	//handler with RequireScope
+	scope string
+	//session routes are refused to API keys and OAuth clients, only signed in
+	//users may call them, see sessionUserFromContext
+	session bool
+	query   []queryParam
+	//request is the JSON body decoded by the handler, nil when it reads none
+	request any
+	//status and response are those of a successful response, a nil response
+	//has no body
+	status   int
+	response any
+	//requestType and responseType default to application/json
+	requestType  string
+	responseType string
+	//errorResponse is the body of the error responses, a Problem by default
+	errorResponse any
+}
+
+// queryParam is an optional query parameter of a route.
+type queryParam struct {
+	name        string
+	format      string
+	description string
+}
+
+var paginationParams = []queryParam{
+	{name: "limit", format: "int32", description: "Page size, 50 by default and at most 200."},
+	{name: "offset", format: "int32", description: "Number of items to skip."},
+}
+
+// routeRegistrar is satisfied by http.ServeMux.
+type routeRegistrar interface {
+	Handle(pattern string, handler http.Handler)
+}
+
+// routeMux is an http.ServeMux that remembers its patterns, so tests can check
+// that every route served is documented.
+type routeMux struct {
+	*http.ServeMux
+	patterns []string
+}
+
+func newRouteMux() *routeMux {
+	return &routeMux{ServeMux: http.NewServeMux()}
+}
+
+func (m *routeMux) Handle(pattern string, handler http.Handler) {
+	m.patterns = append(m.patterns, pattern)
+	m.ServeMux.Handle(pattern, handler)
+}
+
+func (m *routeMux) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	m.Handle(pattern, http.HandlerFunc(handler))
+}
+
+// registerRoutes adds every route of the API to the mux, enforcing the scope
+// and session requirements documented by the route.
+func (s *ApiServer) registerRoutes(mux routeRegistrar) {
+	for _, route := range s.routes() {
+		handler := route.handler
+		if route.scope != "" {
+			handler = RequireScope(route.scope, handler.ServeHTTP)
+		}
+		if route.session {
+			handler = requireSession(handler)
+		}
+		mux.Handle(route.pattern, handler)
+	}
+}
+
+// publicRoutes reports whether a request matches a public route on the mux,
+// the auth middleware serves those without credentials.
+func publicRoutes(mux *http.ServeMux, routes []route) func(r *http.Request) bool {
+	public := map[string]bool{}
+	for _, route := range routes {
+		if route.public {
+			public[route.pattern] = true
+		}
+	}
+	return func(r *http.Request) bool {
+		_, pattern := mux.Handler(r)
+		return public[pattern]
+	}
+}
+
+func (s *ApiServer) routes() []route {
+	return []route{
+		{pattern: "GET /ping", handler: http.HandlerFunc(s.ping), tag: "probes", summary: "Check that the server is up",
+			status: http.StatusOK, response: "", responseType: "text/plain"},
+		{pattern: "GET /metrics", handler: s.metrics.Handler(), tag: "probes", summary: "Prometheus metrics",
+			scope: ScopeAdmin, status: http.StatusOK, response: "", responseType: "text/plain"},
+		{pattern: "GET /healthz", handler: health.LivenessHandler(), tag: "probes", summary: "Liveness probe",
+			public: true, status: http.StatusOK, response: map[string]string{}},
+		{pattern: "GET /readyz", handler: s.health.ReadinessHandler(), tag: "probes", summary: "Readiness probe, 503 when a dependency is unavailable",
+			public: true, status: http.StatusOK, response: health.Report{}, errorResponse: health.Report{}},
+		{pattern: "GET /openapi.json", handler: s.openApiHandler(), tag: "docs", summary: "This OpenAPI document",
+			public: true, status: http.StatusOK, response: map[string]any{}},
+		{pattern: "GET /asyncapi.json", handler: s.asyncApiHandler(), tag: "docs", summary: "AsyncAPI document of the reports queue",
+			public: true, status: http.StatusOK, response: map[string]any{}},
+		{pattern: "GET /docs", handler: docsHandler(), tag: "docs", summary: "Browse this OpenAPI document",
+			public: true, status: http.StatusOK, response: "", responseType: "text/html"},
+
+		{pattern: "POST /auth/signup", handler: s.signupHandler(), tag: "auth", summary: "Sign up with an email and a password",
+			public: true, request: SignupRequest{}, status: http.StatusCreated, response: ApiResponse[struct{}]{}},
+		{pattern: "POST /auth/signin", handler: s.signinHandler(), tag: "auth", summary: "Sign in, or get an MFA challenge",
+			public: true, request: SigninRequest{}, status: http.StatusOK, response: ApiResponse[SigninResponse]{}},
+		{pattern: "POST /auth/refresh", handler: s.tokenRefreshHandler(), tag: "auth", summary: "Exchange a refresh token for a new token pair",
+			public: true, request: TokenRefreshRequest{}, status: http.StatusOK, response: ApiResponse[TokenRefreshResponse]{}},
+		{pattern: "POST /auth/password/forgot", handler: s.forgotPasswordHandler(), tag: "auth", summary: "Email a password reset link",
+			public: true, request: ForgotPasswordRequest{}, status: http.StatusAccepted, response: ApiResponse[struct{}]{}},
+		{pattern: "POST /auth/password/reset", handler: s.resetPasswordHandler(), tag: "auth", summary: "Reset the password with a reset token",
+			public: true, request: ResetPasswordRequest{}, status: http.StatusOK, response: ApiResponse[struct{}]{}},
+		{pattern: "POST /auth/verify", handler: s.verifyEmailHandler(), tag: "auth", summary: "Verify the email address with a verification token",
+			public: true, request: VerifyEmailRequest{}, status: http.StatusOK, response: ApiResponse[struct{}]{}},
+		{pattern: "POST /auth/verify-email/resend", handler: s.resendVerificationHandler(), tag: "auth", summary: "Email a new verification token",
+			public: true, request: ResendVerificationRequest{}, status: http.StatusAccepted, response: ApiResponse[struct{}]{}},
+		{pattern: "POST /auth/mfa/verify", handler: s.mfaVerifyHandler(), tag: "auth", summary: "Answer an MFA challenge",
+			public: true, request: MfaVerifyRequest{}, status: http.StatusOK, response: ApiResponse[SigninResponse]{}},
+		{pattern: "GET /auth/oidc/login", handler: s.oidcLoginHandler(), tag: "auth", summary: "Redirect to the SSO provider",
+			public: true, status: http.StatusFound},
+		{pattern: "GET /auth/oidc/callback", handler: s.oidcCallbackHandler(), tag: "auth", summary: "Sign in with the answer of the SSO provider",
+			public: true, status: http.StatusOK, response: ApiResponse[SigninResponse]{},
+			query: []queryParam{{name: "code"}, {name: "state"}, {name: "error"}, {name: "error_description"}}},
+		{pattern: "POST /oauth/token", handler: s.oauthTokenHandler(), tag: "auth", summary: "Issue a client credentials token (RFC 6749)",
+			public: true, request: OAuthTokenRequest{}, requestType: "application/x-www-form-urlencoded",
+			status: http.StatusOK, response: OAuthTokenResponse{}, errorResponse: OAuthErrorResponse{}},
+
+		{pattern: "POST /reports", handler: s.createReportHandler(), tag: "reports", summary: "Request a report",
+			scope: ScopeReportsWrite, request: CreateReportRequest{}, status: http.StatusCreated, response: ApiResponse[ApiReport]{}},
+		{pattern: "GET /reports/{id}", handler: s.getReportHandler(), tag: "reports", summary: "Get a report and its download URL",
+			scope: ScopeReportsRead, status: http.StatusOK, response: ApiResponse[ApiReport]{}},
+
+		{pattern: "GET /admin/users", handler: s.adminListUsersHandler(), tag: "admin", summary: "List users, newest first",
+			scope: ScopeAdmin, status: http.StatusOK, response: ApiResponse[[]AdminUserResponse]{},
+			query: append([]queryParam{{name: "q", description: "Only users whose email contains it."}}, paginationParams...)},
+		{pattern: "GET /admin/users/{userId}", handler: s.adminGetUserHandler(), tag: "admin", summary: "Get a user",
+			scope: ScopeAdmin, status: http.StatusOK, response: ApiResponse[AdminUserResponse]{}},
+		{pattern: "POST /admin/users/{userId}/disable", handler: s.adminSetDisabledHandler(true), tag: "admin", summary: "Disable a user",
+			scope: ScopeAdmin, status: http.StatusOK, response: ApiResponse[AdminUserResponse]{}},
+		{pattern: "POST /admin/users/{userId}/enable", handler: s.adminSetDisabledHandler(false), tag: "admin", summary: "Enable a disabled user",
+			scope: ScopeAdmin, status: http.StatusOK, response: ApiResponse[AdminUserResponse]{}},
+		{pattern: "POST /admin/users/{userId}/logout", handler: s.adminLogoutUserHandler(), tag: "admin", summary: "Revoke every session of a user",
+			scope: ScopeAdmin, status: http.StatusOK, response: ApiResponse[struct{}]{}},
+		{pattern: "POST /admin/users/{userId}/unlock", handler: s.adminUnlockUserHandler(), tag: "admin", summary: "Unlock a user locked out by failed sign ins",
+			scope: ScopeAdmin, status: http.StatusOK, response: ApiResponse[struct{}]{}},
+		{pattern: "GET /admin/users/{userId}/reports/{id}", handler: s.getUserReportHandler(), tag: "admin", summary: "Get a report of a user",
+			scope: ScopeAdmin, status: http.StatusOK, response: ApiResponse[ApiReport]{}},
+		{pattern: "GET /admin/reports", handler: s.adminListReportsHandler(), tag: "admin", summary: "List reports, newest first",
+			scope: ScopeAdmin, status: http.StatusOK, response: ApiResponse[[]ApiReport]{},
+			query: append([]queryParam{
+				{name: "user_id", format: "uuid"},
+				{name: "report_type"},
+				{name: "status"},
+				{name: "created_after", format: "date-time"},
+				{name: "created_before", format: "date-time"},
+			}, paginationParams...)},
+		{pattern: "GET /admin/reports/{id}", handler: s.adminGetReportHandler(), tag: "admin", summary: "Get any report",
+			scope: ScopeAdmin, status: http.StatusOK, response: ApiResponse[ApiReport]{}},
+		{pattern: "POST /admin/reports/{id}/requeue", handler: s.adminRequeueReportHandler(), tag: "admin", summary: "Build a failed report again",
+			scope: ScopeAdmin, status: http.StatusAccepted, response: ApiResponse[ApiReport]{}},
+
+		{pattern: "POST /me/password", handler: s.changePasswordHandler(), tag: "account", summary: "Change the password",
+			session: true, request: ChangePasswordRequest{}, status: http.StatusOK, response: ApiResponse[struct{}]{}},
+		{pattern: "DELETE /me", handler: s.deleteAccountHandler(), tag: "account", summary: "Delete the account and its reports",
+			session: true, status: http.StatusOK, response: ApiResponse[struct{}]{}},
+		{pattern: "GET /me/usage", handler: s.usageHandler(), tag: "account", summary: "Get the report quota usage",
+			scope: ScopeReportsRead, status: http.StatusOK, response: ApiResponse[UsageResponse]{}},
+		{pattern: "POST /me/mfa/totp", handler: s.enrolTotpHandler(), tag: "account", summary: "Start the TOTP enrolment",
+			session: true, status: http.StatusCreated, response: ApiResponse[TotpEnrolmentResponse]{}},
+		{pattern: "POST /me/mfa/totp/confirm", handler: s.confirmTotpHandler(), tag: "account", summary: "Confirm the TOTP enrolment and get recovery codes",
+			session: true, request: ConfirmTotpRequest{}, status: http.StatusOK, response: ApiResponse[ConfirmTotpResponse]{}},
+		{pattern: "POST /me/api-keys", handler: s.createApiKeyHandler(), tag: "account", summary: "Create an API key",
+			session: true, request: CreateApiKeyRequest{}, status: http.StatusCreated, response: ApiResponse[ApiKeyResponse]{}},
+		{pattern: "GET /me/api-keys", handler: s.listApiKeysHandler(), tag: "account", summary: "List the API keys",
+			session: true, status: http.StatusOK, response: ApiResponse[[]ApiKeyResponse]{}},
+		{pattern: "DELETE /me/api-keys/{id}", handler: s.revokeApiKeyHandler(), tag: "account", summary: "Revoke an API key",
+			session: true, status: http.StatusOK, response: ApiResponse[ApiKeyResponse]{}},
+
+		{pattern: "POST /orgs", handler: s.createOrgHandler(), tag: "orgs", summary: "Create an organization",
+			session: true, request: CreateOrgRequest{}, status: http.StatusCreated, response: ApiResponse[OrgResponse]{}},
+		{pattern: "GET /orgs", handler: s.listOrgsHandler(), tag: "orgs", summary: "List the organizations of the user",
+			scope: ScopeReportsRead, status: http.StatusOK, response: ApiResponse[[]OrgResponse]{}},
+		{pattern: "GET /orgs/{org}/members", handler: s.listOrgMembersHandler(), tag: "orgs", summary: "List the members of an organization",
+			scope: ScopeReportsRead, status: http.StatusOK, response: ApiResponse[[]MemberResponse]{}},
+		{pattern: "POST /orgs/{org}/members", handler: s.addOrgMemberHandler(), tag: "orgs", summary: "Add a member to an organization",
+			session: true, request: AddMemberRequest{}, status: http.StatusOK, response: ApiResponse[MemberResponse]{}},
+		{pattern: "DELETE /orgs/{org}/members/{userId}", handler: s.removeOrgMemberHandler(), tag: "orgs", summary: "Remove a member from an organization",
+			session: true, status: http.StatusOK, response: ApiResponse[struct{}]{}},
+		{pattern: "GET /orgs/{org}/reports", handler: s.listOrgReportsHandler(), tag: "orgs", summary: "List the reports shared with an organization",
+			scope: ScopeReportsRead, status: http.StatusOK, response: ApiResponse[[]ApiReport]{},
+			query: []queryParam{{name: "limit", format: "int32", description: "At most 100, the default."}}},
+	}
+}
@@ -0,0 +1,85 @@
+package apiserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"asyncapi/store"
+)
+
+const (
+	ScopeReportsRead  = "reports:read"
+	ScopeReportsWrite = "reports:write"
+	// ScopeAdmin grants access to the /admin routes, including every user's reports.
+	ScopeAdmin = "admin"
+)
+
+// ScopesForRole returns every scope a user with the role may be granted.
+func ScopesForRole(role string) []string {
+	switch role {
+	case store.RoleAdmin:
+		return []string{ScopeReportsRead, ScopeReportsWrite, ScopeAdmin}
+	case store.RoleUser:
+		return []string{ScopeReportsRead, ScopeReportsWrite}
+	default:
+		return nil
+	}
+}
+
+// grantedScopes returns the requested scopes the role allows. A nil request
+// stands for everything the role allows.
+func grantedScopes(role string, requested []string) []string {
+	allowed := ScopesForRole(role)
+	if requested == nil {
+		return allowed
+	}
+	granted := []string{}
+	for _, scope := range requested {
+		if slices.Contains(allowed, scope) {
+			granted = append(granted, scope)
+		}
+	}
+	return granted
+}
+
+// ApiKeyScopes returns the scopes an API key with the given scopes asks for.
+// Keys without scopes only read reports, they never fall back to everything
+// the role of their owner allows.
+func ApiKeyScopes(scopes []string) []string {
+	if len(scopes) == 0 {
+		return []string{ScopeReportsRead}
+	}
+	return scopes
+}
+
+type scopesCtxKey struct {
+}
+
+func ContextWithScopes(ctx context.Context, scopes []string) context.Context {
+	return context.WithValue(ctx, scopesCtxKey{}, scopes)
+}
+
+// ScopesFromContext returns the scopes the request was authorized with.
+func ScopesFromContext(ctx context.Context) []string {
+	scopes, _ := ctx.Value(scopesCtxKey{}).([]string)
+	return scopes
+}
+
+// HasScope reports whether the request was authorized with the scope.
+func HasScope(ctx context.Context, scope string) bool {
+	return slices.Contains(ScopesFromContext(ctx), scope)
+}
+
+// RequireScope wraps a route handler so it is only reached by requests
+// authorized with the scope; others get a 403.
+func RequireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		if !HasScope(r.Context(), scope) {
+			return NewErrWithStatus(http.StatusForbidden, fmt.Errorf("missing required scope %q", scope)).WithCode(CodeInsufficientScope).Public()
+		}
+		next(w, r)
+		return nil
+	})
+}
@@ -0,0 +1,68 @@
+package apiserver_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"asyncapi/apiserver"
+	"asyncapi/config"
+	"asyncapi/store"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScopesForRole(t *testing.T) {
+	require.ElementsMatch(t, []string{apiserver.ScopeReportsRead, apiserver.ScopeReportsWrite}, apiserver.ScopesForRole(store.RoleUser))
+	require.Contains(t, apiserver.ScopesForRole(store.RoleAdmin), apiserver.ScopeAdmin)
+	require.Empty(t, apiserver.ScopesForRole("root"))
+}
+
+func TestApiKeyScopes(t *testing.T) {
+	//keys without scopes never get the admin scope of their owner
+	require.Equal(t, []string{apiserver.ScopeReportsRead}, apiserver.ApiKeyScopes(nil))
+	require.Equal(t, []string{apiserver.ScopeReportsRead}, apiserver.ApiKeyScopes([]string{}))
+	require.Equal(t, []string{apiserver.ScopeReportsWrite}, apiserver.ApiKeyScopes([]string{apiserver.ScopeReportsWrite}))
+}
+
+func TestRequireScope(t *testing.T) {
+	h := apiserver.RequireScope(apiserver.ScopeAdmin, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name   string
+		scopes []string
+		status int
+	}{
+		{name: "granted", scopes: []string{apiserver.ScopeReportsRead, apiserver.ScopeAdmin}, status: http.StatusNoContent},
+		{name: "missing", scopes: []string{apiserver.ScopeReportsRead}, status: http.StatusForbidden},
+		{name: "none", scopes: nil, status: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			r = r.WithContext(apiserver.ContextWithScopes(r.Context(), tt.scopes))
+			w := httptest.NewRecorder()
+			h(w, r)
+			require.Equal(t, tt.status, w.Code)
+		})
+	}
+}
+
+func TestJwtManager_GenerateTokenPairScopes(t *testing.T) {
+	conf, err := config.New()
+	require.NoError(t, err)
+	jwtManager := apiserver.NewJwtManager(conf)
+
+	tokenPair, err := jwtManager.GenerateTokenPair(uuid.New(), apiserver.ScopesForRole(store.RoleAdmin)...)
+	require.NoError(t, err)
+
+	claims, err := jwtManager.ParseClaims(tokenPair.AccessToken.Raw)
+	require.NoError(t, err)
+	require.Equal(t, apiserver.ScopesForRole(store.RoleAdmin), claims.Scopes)
+	claims, err = jwtManager.ParseClaims(tokenPair.RefreshToken.Raw)
+	require.NoError(t, err)
+	require.Empty(t, claims.Scopes)
+}
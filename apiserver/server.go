@@ -2,7 +2,6 @@ package apiserver
 
 import (
 	"context"
-	"io"
 	"log/slog"
 	"net"
 	"net/http"
@@ -11,7 +10,12 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 
+	"asyncapi/health"
+	"asyncapi/mailer"
+	"asyncapi/oidc"
+	"asyncapi/passwords"
 	"asyncapi/store"
 
 	"asyncapi/config"
@@ -30,19 +34,50 @@ type ApiServer struct {
 	sqsClient *sqs.Client
 
 	presignClient *s3.PresignClient
+	//s3 client to clean up the objects of deleted users
+	s3Client *s3.Client
+	//mailer for password reset and verification emails
+	mailer mailer.Mailer
+	//oidcProvider signs users in with SSO, nil when it is not configured
+	oidcProvider *oidc.Provider
+	//metrics served on /metrics to admins
+	metrics *Metrics
+	//readiness checks of the dependencies served on /readyz
+	health *health.Checker
+	//passwords validates the new passwords of signups, changes and resets
+	passwords *passwords.Policy
 }
 
-func New(conf *config.Config, logger *slog.Logger, store *store.Store, jwtManager *JwtManager, sqsClient *sqs.Client, presignClient *s3.PresignClient) *ApiServer {
+func New(conf *config.Config, logger *slog.Logger, store *store.Store, jwtManager *JwtManager, sqsClient *sqs.Client, s3Client *s3.Client, presignClient *s3.PresignClient, mailer mailer.Mailer, passwordPolicy *passwords.Policy) *ApiServer {
 	// Create a new instance of ApiServer with the provided configuration
 	// and logger
-	return &ApiServer{
+	s := &ApiServer{
 		config:        conf,
 		logger:        logger,
 		store:         store,
 		jwtManager:    jwtManager,
 		sqsClient:     sqsClient,
 		presignClient: presignClient,
+		s3Client:      s3Client,
+		mailer:        mailer,
+		metrics:       NewMetrics(store.Users.CacheStats),
+		passwords:     passwordPolicy,
 	}
+	s.health = health.NewChecker(logger, conf.HealthCheckTimeout, conf.HealthCacheTTL)
+	s.health.Add("database", health.DbCheck(store))
+	s.health.Add("queue", health.SqsCheck(sqsClient, conf.SqsQueue))
+	s.health.Add("bucket", health.S3Check(s3Client, conf.S3Bucket))
+	if conf.OidcIssuer != "" {
+		s.oidcProvider = oidc.NewProvider(oidc.Config{
+			Issuer:       conf.OidcIssuer,
+			ClientId:     conf.OidcClientId,
+			ClientSecret: conf.OidcClientSecret,
+			RedirectUrl:  conf.OidcRedirectUrl,
+			Scopes:       conf.OidcScopes,
+			Leeway:       conf.JwtLeeway,
+		}, &http.Client{Timeout: 10 * time.Second})
+	}
+	return s
 }
 
 func (s *ApiServer) ping(w http.ResponseWriter, r *http.Request) {
@@ -53,33 +88,53 @@ func (s *ApiServer) ping(w http.ResponseWriter, r *http.Request) {
 	// or
 	// json.NewEncoder(w).Encode(map[string]string{"message": "pong"})
 	// set status to StatusOk and write pong back in response
-	//read the request body
-	//and write it back to the response
+	//the body is never read, let alone echoed back
 
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusInternalServerError)
-		return
-	}
-	w.Write(body)
 	w.Write([]byte("pong"))
 }
 
-func (s *ApiServer) Start(ctx context.Context) error {
-	// Start the API server
-	// This is where you would set up your HTTP server, routes, etc.
-	mux := http.NewServeMux()
-	mux.HandleFunc("GET /ping", s.ping)
-	mux.HandleFunc("POST /auth/signup", s.signupHandler())
-	mux.HandleFunc("POST /auth/signin", s.signinHandler())
-	mux.HandleFunc("POST /auth/refresh", s.tokenRefreshHandler())
-	mux.HandleFunc("POST /reports", s.createReportHandler())
-	mux.HandleFunc("GET /reports/{id}", s.getReportHandler())
+// handler builds the routes and the middleware chain served by Start. The
+// mux is returned for the tests checking that every route is documented.
+func (s *ApiServer) handler() (http.Handler, *routeMux) {
+	mux := newRouteMux()
+	s.registerRoutes(mux)
 	//middleware := NewLoggerMiddleware(s.logger)
 	//middleware = NewAuthMiddleware(s.jwtManager, s.store.Users)
 
-	handler := NewLoggerMiddleware(s.logger)(NewAuthMiddleware(s.jwtManager, s.store.Users)(mux))
+	limiter := s.newRateLimiter()
+	limits := s.rateLimits()
+	var handler http.Handler = withProblemFallback(mux.ServeMux)
+	handler = NewRateLimitMiddleware(limiter, limits)(handler)
+	handler = NewAuthMiddleware(s.jwtManager, s.store.Users, s.store.ApiKeys, s.store.OAuthClients, publicRoutes(mux.ServeMux, s.routes()))(handler)
+	//clients are limited before their credentials are checked
+	handler = NewClientRateLimitMiddleware(limiter, limits[RateLimitClient])(handler)
+	handler = NewBodyLimitMiddleware(s.config.MaxRequestBodyBytes)(handler)
+	handler = NewMetricsMiddleware(s.metrics)(handler)
+	handler = withRoute(mux.ServeMux)(handler)
+	handler = NewLoggerMiddleware(s.logger)(handler)
+	//the request id comes first so every error response carries it
+	handler = NewRequestIdMiddleware()(handler)
+	//spans are named after the route, traces started by clients are continued
+	handler = otelhttp.NewHandler(handler, "http.server",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			if _, pattern := mux.Handler(r); pattern != "" {
+				return pattern
+			}
+			return r.Method + " unmatched"
+		}),
+		otelhttp.WithFilter(func(r *http.Request) bool {
+			return !isProbePath(r.URL.Path)
+		}),
+	)
+	return handler, mux
+}
+
+func (s *ApiServer) Start(ctx context.Context) error {
+	// Start the API server
+	// This is where you would set up your HTTP server, routes, etc.
+	handler, _ := s.handler()
 	srv := &http.Server{
 		Addr:    net.JoinHostPort(s.config.ApiServerHost, s.config.ApiServerPort),
 		Handler: handler,
@@ -90,6 +145,10 @@ func (s *ApiServer) Start(ctx context.Context) error {
 			Addr:    net.JoinHostPort(s.config.ApiServerHost, s.config.ApiServerPort),
 			Handler: middleware(mux)}
 	*/
+	//shared buckets are not dropped by anyone else
+	if s.config.RateLimitStore == "postgres" {
+		go s.deleteIdleRateLimits(ctx)
+	}
 	// Start the server in a goroutine and return the server.ListebnAndServe() error
 	go func() {
 		// Log server start message with the port
@@ -122,6 +181,8 @@ func (s *ApiServer) Start(ctx context.Context) error {
 	}()
 	// Wait for the shutdown goroutine to finish
 	wg.Wait()
+	cacheStats := s.store.Users.CacheStats()
+	s.logger.Info("User cache stats", slog.Uint64("hits", cacheStats.Hits), slog.Uint64("misses", cacheStats.Misses), slog.Uint64("evictions", cacheStats.Evictions))
 	// Log server shutdown complete message
 	s.logger.Info("Server shutdown complete", slog.String("status", "success"), slog.String("component", "ApiServer"), slog.String("event", "shutdown"))
 	// Close the server gracefully
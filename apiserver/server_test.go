@@ -0,0 +1,107 @@
+package apiserver
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"asyncapi/config"
+	"asyncapi/fixtures"
+	"asyncapi/mailer"
+	"asyncapi/passwords"
+	"asyncapi/store"
+)
+
+// recordingMailer keeps the messages instead of sending them.
+type recordingMailer struct {
+	mu       sync.Mutex
+	messages []mailer.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+func (m *recordingMailer) sent() []mailer.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]mailer.Message(nil), m.messages...)
+}
+
+// newStoreTestServer creates a server backed by the test database, its
+// tables are truncated when the test ends.
+func newStoreTestServer(t *testing.T) (*ApiServer, *recordingMailer) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() {
+		cleanup(t)
+	})
+	mails := &recordingMailer{}
+	s := New(env.Config, slog.Default(), store.New(env.Db, env.Passwords, env.TotpCipher), NewJwtManager(env.Config), nil, nil, nil, mails, env.Passwords)
+	return s, mails
+}
+
+// newChainTestServer creates a server without a reachable database, for the
+// requests the middleware chain answers on its own.
+func newChainTestServer(conf *config.Config) *ApiServer {
+	conf.MaxRequestBodyBytes = 1 << 20
+	policy, err := passwords.NewPolicy(8, passwords.MaxBcryptLength, bcrypt.MinCost, nil)
+	if err != nil {
+		panic(err)
+	}
+	return New(conf, slog.Default(), store.New(nil, policy, nil), NewJwtManager(conf), nil, nil, nil, &recordingMailer{}, policy)
+}
+
+func TestHandler_ClientRateLimitBeforeAuth(t *testing.T) {
+	s := newChainTestServer(&config.Config{
+		JwtSecret:                "secret",
+		RateLimitClientPerMinute: 1,
+		RateLimitClientBurst:     2,
+	})
+	h, _ := s.handler()
+
+	do := func(remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/me/api-keys", nil)
+		r.RemoteAddr = remoteAddr
+		r.Header.Set("Authorization", "Bearer guessed")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	//guessed credentials are rejected, but they use up the bucket of the IP
+	require.Equal(t, http.StatusUnauthorized, do("10.0.0.1:1234").Code)
+	require.Equal(t, http.StatusUnauthorized, do("10.0.0.1:1234").Code)
+	w := do("10.0.0.1:1234")
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, "60", w.Header().Get("Retry-After"))
+	require.Equal(t, http.StatusUnauthorized, do("10.0.0.2:1234").Code)
+
+	//the probes are not limited
+	for range 3 {
+		r := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+}
+
+func TestHandler_MetricsNotPublic(t *testing.T) {
+	s := newChainTestServer(&config.Config{JwtSecret: "secret"})
+	h, _ := s.handler()
+
+	//metrics are scraped with an admin API key, not anonymously
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	require.NotContains(t, w.Body.String(), "go_goroutines")
+}
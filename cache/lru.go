@@ -0,0 +1,115 @@
+// Package cache provides a small in-memory LRU cache with expiring entries.
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Stats are the counters of an LRU since it was created.
+type Stats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	// Size is the current number of entries, expired ones included until they
+	// are looked up or evicted.
+	Size int
+}
+
+// LRU is a cache holding at most capacity entries, each for at most ttl. When
+// full, the least recently used entry is evicted. It is safe for concurrent use.
+type LRU[K comparable, V any] struct {
+	capacity int
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[K]*list.Element
+	stats   Stats
+}
+
+type entry[K comparable, V any] struct {
+	key       K
+	value     V
+	expiresAt time.Time
+}
+
+func NewLRU[K comparable, V any](capacity int, ttl time.Duration) *LRU[K, V] {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &LRU[K, V]{
+		capacity: capacity,
+		ttl:      ttl,
+		order:    list.New(),
+		entries:  make(map[K]*list.Element, capacity),
+	}
+}
+
+// Get returns the value cached for the key, if it has not expired.
+func (c *LRU[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+	element, ok := c.entries[key]
+	if !ok {
+		c.stats.Misses++
+		return zero, false
+	}
+	e := element.Value.(*entry[K, V])
+	if time.Now().After(e.expiresAt) {
+		c.remove(element)
+		c.stats.Misses++
+		return zero, false
+	}
+	c.order.MoveToFront(element)
+	c.stats.Hits++
+	return e.value, true
+}
+
+// Set caches the value for the key for the ttl of the cache.
+func (c *LRU[K, V]) Set(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt := time.Now().Add(c.ttl)
+	if element, ok := c.entries[key]; ok {
+		e := element.Value.(*entry[K, V])
+		e.value = value
+		e.expiresAt = expiresAt
+		c.order.MoveToFront(element)
+		return
+	}
+	for c.order.Len() >= c.capacity {
+		c.remove(c.order.Back())
+		c.stats.Evictions++
+	}
+	c.entries[key] = c.order.PushFront(&entry[K, V]{key: key, value: value, expiresAt: expiresAt})
+}
+
+// Delete removes the key from the cache.
+func (c *LRU[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+}
+
+// Stats returns the counters of the cache.
+func (c *LRU[K, V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Size = c.order.Len()
+	return stats
+}
+
+func (c *LRU[K, V]) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*entry[K, V]).key)
+}
@@ -0,0 +1,52 @@
+package cache_test
+
+import (
+	"testing"
+	"time"
+
+	"asyncapi/cache"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLRU(t *testing.T) {
+	lru := cache.NewLRU[string, int](2, time.Minute)
+
+	_, ok := lru.Get("a")
+	require.False(t, ok)
+
+	lru.Set("a", 1)
+	lru.Set("b", 2)
+	value, ok := lru.Get("a")
+	require.True(t, ok)
+	require.Equal(t, 1, value)
+
+	//b is the least recently used
+	lru.Set("c", 3)
+	_, ok = lru.Get("b")
+	require.False(t, ok)
+	_, ok = lru.Get("c")
+	require.True(t, ok)
+
+	lru.Set("a", 10)
+	value, _ = lru.Get("a")
+	require.Equal(t, 10, value)
+
+	lru.Delete("a")
+	_, ok = lru.Get("a")
+	require.False(t, ok)
+
+	require.Equal(t, cache.Stats{Hits: 3, Misses: 3, Evictions: 1, Size: 1}, lru.Stats())
+}
+
+func TestLRU_Expiry(t *testing.T) {
+	lru := cache.NewLRU[string, int](10, 20*time.Millisecond)
+	lru.Set("a", 1)
+	_, ok := lru.Get("a")
+	require.True(t, ok)
+
+	time.Sleep(30 * time.Millisecond)
+	_, ok = lru.Get("a")
+	require.False(t, ok)
+	require.Equal(t, 0, lru.Stats().Size)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+
+	"asyncapi/apiserver"
+	"asyncapi/config"
+	"asyncapi/passwords"
+	"asyncapi/store"
+	"asyncapi/totp"
+)
+
+const usage = `usage: admin <command> [flags]
+
+commands:
+  unlock -email <email> | -ip <ip>   clear failed signin attempts and lockouts
+  set-role -email <email> -role <role>  make an account a "user" or an "admin"
+  create-client -name <name> -owner <email> -scopes <a,b>  register an OAuth client
+  revoke-client -id <client id>        revoke an OAuth client
+  seal-totp-secrets                    encrypt TOTP secrets stored in plain text
+`
+
+// main runs one-off administrative operations against the database.
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return errors.New("missing command")
+	}
+
+	conf, err := config.New()
+	if err != nil {
+		return err
+	}
+	passwordPolicy, err := passwords.LoadPolicy(conf)
+	if err != nil {
+		return err
+	}
+	totpCipher, err := totp.NewCipher(conf.TotpEncryptionKey)
+	if err != nil {
+		return err
+	}
+	db, err := store.NewPostgresDb(conf)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	dataStore := store.New(db, passwordPolicy, totpCipher)
+	ctx := context.Background()
+
+	switch args[0] {
+	case "unlock":
+		return unlock(ctx, dataStore, args[1:])
+	case "set-role":
+		return setRole(ctx, dataStore, args[1:])
+	case "create-client":
+		return createClient(ctx, dataStore, args[1:])
+	case "revoke-client":
+		return revokeClient(ctx, dataStore, args[1:])
+	case "seal-totp-secrets":
+		return sealTotpSecrets(ctx, dataStore)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+// unlock clears the signin lockout of an account or a client IP.
+func unlock(ctx context.Context, dataStore *store.Store, args []string) error {
+	flags := flag.NewFlagSet("unlock", flag.ExitOnError)
+	email := flags.String("email", "", "email of the account to unlock")
+	ip := flags.String("ip", "", "client IP to unlock")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var keys []string
+	if *email != "" {
+		keys = append(keys, store.AccountKey(*email))
+	}
+	if *ip != "" {
+		keys = append(keys, store.IpKey(*ip))
+	}
+	if len(keys) == 0 {
+		return errors.New("unlock requires -email or -ip")
+	}
+	if err := dataStore.SigninFailures.Reset(ctx, keys...); err != nil {
+		return err
+	}
+	fmt.Printf("unlocked %v\n", keys)
+	return nil
+}
+
+// setRole changes the role of an account, which takes effect once the API
+// servers' user cache expires (USER_CACHE_TTL).
+func setRole(ctx context.Context, dataStore *store.Store, args []string) error {
+	flags := flag.NewFlagSet("set-role", flag.ExitOnError)
+	email := flags.String("email", "", "email of the account")
+	role := flags.String("role", "", `"user" or "admin"`)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *email == "" || *role == "" {
+		return errors.New("set-role requires -email and -role")
+	}
+
+	user, err := dataStore.Users.GetUserByEmail(ctx, *email)
+	if err != nil {
+		return err
+	}
+	if err := dataStore.Users.SetRole(ctx, user.Id, *role); err != nil {
+		return err
+	}
+	fmt.Printf("%s is now %s\n", user.Email, *role)
+	return nil
+}
+
+// createClient registers an OAuth client acting on behalf of the owner and
+// prints its credentials, the secret can't be shown again.
+func createClient(ctx context.Context, dataStore *store.Store, args []string) error {
+	flags := flag.NewFlagSet("create-client", flag.ExitOnError)
+	name := flags.String("name", "", "name of the client")
+	ownerEmail := flags.String("owner", "", "email of the account owning the reports the client creates")
+	scopes := flags.String("scopes", apiserver.ScopeReportsRead+","+apiserver.ScopeReportsWrite, "comma separated scopes of the client")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *name == "" || *ownerEmail == "" {
+		return errors.New("create-client requires -name and -owner")
+	}
+
+	owner, err := dataStore.Users.GetUserByEmail(ctx, *ownerEmail)
+	if err != nil {
+		return err
+	}
+	clientScopes := strings.Split(*scopes, ",")
+	allowed := apiserver.ScopesForRole(owner.Role)
+	for _, scope := range clientScopes {
+		if !slices.Contains(allowed, scope) {
+			return fmt.Errorf("scope %q is unknown or not allowed for the owner", scope)
+		}
+	}
+
+	secret, client, err := dataStore.OAuthClients.Create(ctx, *name, owner.Id, clientScopes)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("client_id=%s\nclient_secret=%s\n", client.Id, secret)
+	return nil
+}
+
+// revokeClient revokes an OAuth client, its tokens stop being accepted.
+func revokeClient(ctx context.Context, dataStore *store.Store, args []string) error {
+	flags := flag.NewFlagSet("revoke-client", flag.ExitOnError)
+	id := flags.String("id", "", "client id")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *id == "" {
+		return errors.New("revoke-client requires -id")
+	}
+	if err := dataStore.OAuthClients.Revoke(ctx, *id); err != nil {
+		return err
+	}
+	fmt.Printf("revoked %s\n", *id)
+	return nil
+}
+
+// sealTotpSecrets encrypts the TOTP secrets stored before they were encrypted
+// at rest. The API servers read both, so it can run while they serve.
+func sealTotpSecrets(ctx context.Context, dataStore *store.Store) error {
+	n, err := dataStore.Users.SealTotpSecrets(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("encrypted %d totp secrets\n", n)
+	return nil
+}
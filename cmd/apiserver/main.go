@@ -7,15 +7,21 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-sdk-go-v2/otelaws"
 
 	"asyncapi/apiserver"
 	"asyncapi/config"
+	"asyncapi/mailer"
+	"asyncapi/passwords"
 	"asyncapi/store"
+	"asyncapi/totp"
+	"asyncapi/tracing"
 )
 
 // main runs the API server.
@@ -43,13 +49,42 @@ func run() error {
 	}
 	// Create a new logger
 	jsonHandler := slog.NewJSONHandler(os.Stdout, nil)
-	logger := slog.New(jsonHandler)
+	//records logged during a request carry its request id
+	logger := slog.New(apiserver.NewContextLogHandler(jsonHandler))
+	slog.SetDefault(logger)
+
+	// Set up tracing, the remaining spans are flushed on shutdown
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg, "asyncapi-apiserver")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(shutdownCtx); err != nil {
+			logger.Error("failed to flush spans", "error", err)
+		}
+	}()
+
+	// Load the password policy used to validate and hash passwords
+	passwordPolicy, err := passwords.LoadPolicy(cfg)
+	if err != nil {
+		return err
+	}
+	// TOTP secrets are encrypted in the database, the key is required
+	totpCipher, err := totp.NewCipher(cfg.TotpEncryptionKey)
+	if err != nil {
+		return err
+	}
 
 	db, err := store.NewPostgresDb(cfg)
 	if err != nil {
 		return nil
 	}
-	dataStore := store.New(db)
+	dataStore := store.New(db, passwordPolicy, totpCipher)
+	if cfg.UserCacheSize > 0 {
+		dataStore.Users.EnableCache(cfg.UserCacheSize, cfg.UserCacheTTL)
+	}
 	jwtManager := apiserver.NewJwtManager(cfg)
 	// Set Context to signal Notify Context
 
@@ -62,6 +97,8 @@ func run() error {
 	if err != nil {
 		return fmt.Errorf("Couldn't load default configuration. Have you set up your AWS account?:%w", err)
 	}
+	//spans for the SQS and S3 calls
+	otelaws.AppendMiddlewares(&sdkConfig.APIOptions)
 	sqsClient := sqs.NewFromConfig(sdkConfig, func(options *sqs.Options) {
 		options.BaseEndpoint = aws.String(cfg.ReportsSQSEndpoint)
 	})
@@ -73,7 +110,7 @@ func run() error {
 	// Create a presign client from the s3 client
 	s3PresignClient := s3.NewPresignClient(s3Client)
 	// Create a new API server instance
-	apiServer := apiserver.New(cfg, logger, dataStore, jwtManager, sqsClient, s3PresignClient)
+	apiServer := apiserver.New(cfg, logger, dataStore, jwtManager, sqsClient, s3Client, s3PresignClient, mailer.New(cfg, logger), passwordPolicy)
 	// Start the API server
 	if err := apiServer.Start(ctx); err != nil {
 		return err
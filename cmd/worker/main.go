@@ -10,12 +10,16 @@ import (
 	"time"
 
 	"asyncapi/config"
+	"asyncapi/health"
 	"asyncapi/store"
+	"asyncapi/tracing"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-sdk-go-v2/otelaws"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 
 	"asyncapi/reports"
 )
@@ -35,17 +39,32 @@ func run() error {
 		return err
 	}
 
+	shutdownTracing, err := tracing.Setup(ctx, conf, "asyncapi-worker")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(shutdownCtx); err != nil {
+			log.Printf("failed to flush spans: %v", err)
+		}
+	}()
+
 	db, err := store.NewPostgresDb(conf)
 	if err != nil {
 		return err
 	}
 
-	dataStore := store.New(db)
+	//the worker never hashes passwords nor reads TOTP secrets, so it goes
+	//without the password policy and the TOTP key
+	dataStore := store.New(db, nil, nil)
 
 	awsConf, err := awsconfig.LoadDefaultConfig(ctx)
 	if err != nil {
 		return err
 	}
+	otelaws.AppendMiddlewares(&awsConf.APIOptions)
 	s3Client := s3.NewFromConfig(awsConf, func(options *s3.Options) {
 		options.BaseEndpoint = aws.String(conf.S3LocalstackEndpoint)
 		options.UsePathStyle = true
@@ -57,10 +76,17 @@ func run() error {
 	jsonHandler := slog.NewJSONHandler(os.Stdout, nil)
 	logger := slog.New(jsonHandler)
 
-	lozClient := reports.NewLozClient(&http.Client{Timeout: time.Second * 10})
+	lozClient := reports.NewLozClient(&http.Client{
+		Timeout:   time.Second * 10,
+		Transport: otelhttp.NewTransport(http.DefaultTransport),
+	})
 	builder := reports.NewReportBuilder(conf, dataStore.ReportStore, lozClient, s3Client, logger)
+	checker := health.NewChecker(logger, conf.HealthCheckTimeout, conf.HealthCacheTTL)
+	checker.Add("database", health.DbCheck(db))
+	checker.Add("queue", health.SqsCheck(sqsClient, conf.SqsQueue))
+	checker.Add("bucket", health.S3Check(s3Client, conf.S3Bucket))
 	maxConcurrency := 2
-	worker := reports.NewWorker(conf, logger, sqsClient, maxConcurrency, builder)
+	worker := reports.NewWorker(conf, logger, sqsClient, maxConcurrency, builder, checker)
 
 	if err := worker.Start(ctx); err != nil {
 		return err
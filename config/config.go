@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/caarlos0/env/v11"
 	"github.com/joho/godotenv"
@@ -33,6 +34,97 @@ type Config struct {
 	ReportsSQSEndpoint   string `env:"REPORTS_SQS_ENDPOINT"`
 	S3Bucket             string `env:"S3_BUCKET"`
 	SqsQueue             string `env:"SQS_QUEUE"`
+	// SqsDeadLetterQueue receives the messages the worker can't handle, such
+	// as those of an unsupported major version. When empty they are left to
+	// the redrive policy of SqsQueue.
+	SqsDeadLetterQueue string `env:"SQS_DLQ"`
+	// JwtIssuer is the "iss" claim written to and required on every token.
+	// When empty it defaults to http://ApiServerHost:ApiServerPort.
+	JwtIssuer string `env:"JWT_ISSUER"`
+	// JwtAudience is the "aud" claim written to and required on every token.
+	JwtAudience string        `env:"JWT_AUDIENCE" envDefault:"asyncapi"`
+	JwtLeeway   time.Duration `env:"JWT_LEEWAY" envDefault:"30s"`
+	// Mailer selects how emails are delivered: "smtp", "file" or "log".
+	Mailer           string        `env:"MAILER" envDefault:"log"`
+	MailFrom         string        `env:"MAIL_FROM" envDefault:"noreply@asyncapi.local"`
+	MailDir          string        `env:"MAIL_DIR" envDefault:"mail"`
+	SmtpHost         string        `env:"SMTP_HOST"`
+	SmtpPort         string        `env:"SMTP_PORT" envDefault:"587"`
+	SmtpUsername     string        `env:"SMTP_USERNAME"`
+	SmtpPassword     string        `env:"SMTP_PASSWORD"`
+	PasswordResetTTL time.Duration `env:"PASSWORD_RESET_TTL" envDefault:"30m"`
+	// EmailVerificationTTL is how long the token sent on signup stays valid.
+	EmailVerificationTTL time.Duration `env:"EMAIL_VERIFICATION_TTL" envDefault:"72h"`
+	// RequireVerifiedEmail blocks report creation until the user verified their email.
+	RequireVerifiedEmail bool `env:"REQUIRE_VERIFIED_EMAIL" envDefault:"false"`
+	// Signin lockout: after SigninMaxFailures failed attempts on an account
+	// (SigninIpMaxFailures from one IP) within SigninFailureWindow, signin is
+	// locked for SigninLockoutBase, doubling on every further failure up to
+	// SigninLockoutMax.
+	SigninMaxFailures   int           `env:"SIGNIN_MAX_FAILURES" envDefault:"5"`
+	SigninIpMaxFailures int           `env:"SIGNIN_IP_MAX_FAILURES" envDefault:"20"`
+	SigninLockoutBase   time.Duration `env:"SIGNIN_LOCKOUT_BASE" envDefault:"30s"`
+	SigninLockoutMax    time.Duration `env:"SIGNIN_LOCKOUT_MAX" envDefault:"1h"`
+	SigninFailureWindow time.Duration `env:"SIGNIN_FAILURE_WINDOW" envDefault:"1h"`
+	// Password policy, PasswordMaxLength is in bytes and capped at bcrypt's 72.
+	PasswordMinLength int `env:"PASSWORD_MIN_LENGTH" envDefault:"8"`
+	PasswordMaxLength int `env:"PASSWORD_MAX_LENGTH" envDefault:"72"`
+	// BreachedPasswordsFile is a file with one rejected password per line.
+	BreachedPasswordsFile string `env:"BREACHED_PASSWORDS_FILE"`
+	// TotpEncryptionKey is the base64 encoded 32 byte AES key the TOTP
+	// secrets are encrypted with in the database. It has no default and must
+	// be provided by the deployment.
+	TotpEncryptionKey string `env:"TOTP_ENCRYPTION_KEY"`
+	// BcryptCost is used for new hashes; older hashes are upgraded on signin.
+	BcryptCost int `env:"BCRYPT_COST" envDefault:"10"`
+	// MfaIssuer is the account issuer shown by authenticator apps.
+	MfaIssuer string `env:"MFA_ISSUER" envDefault:"asyncapi"`
+	// Report quotas per user, 0 disables a limit. ReportDailyLimit counts the
+	// reports created in the last 24 hours.
+	ReportMaxInFlight    int   `env:"REPORT_MAX_IN_FLIGHT" envDefault:"5"`
+	ReportDailyLimit     int   `env:"REPORT_DAILY_LIMIT" envDefault:"100"`
+	ReportMaxStoredBytes int64 `env:"REPORT_MAX_STORED_BYTES" envDefault:"1073741824"`
+	// OpenID Connect sign in, enabled when OidcIssuer is set. OidcRedirectUrl
+	// must point to /auth/oidc/callback and be registered with the provider.
+	OidcIssuer       string   `env:"OIDC_ISSUER"`
+	OidcClientId     string   `env:"OIDC_CLIENT_ID"`
+	OidcClientSecret string   `env:"OIDC_CLIENT_SECRET"`
+	OidcRedirectUrl  string   `env:"OIDC_REDIRECT_URL"`
+	OidcScopes       []string `env:"OIDC_SCOPES" envSeparator:"," envDefault:"openid,email"`
+	// UserCacheSize users looked up by the auth middleware are cached for up
+	// to UserCacheTTL, a size of 0 disables the cache.
+	UserCacheSize int           `env:"USER_CACHE_SIZE" envDefault:"10000"`
+	UserCacheTTL  time.Duration `env:"USER_CACHE_TTL" envDefault:"30s"`
+	// WorkerHttpAddr is where the worker serves /metrics, /healthz and /readyz,
+	// empty disables it.
+	WorkerHttpAddr string `env:"WORKER_HTTP_ADDR" envDefault:":9090"`
+	// TracingExporter selects where spans go: "none", "stdout" or "otlp", the
+	// latter sends them over HTTP to OtlpEndpoint (e.g. http://localhost:4318).
+	TracingExporter    string  `env:"TRACING_EXPORTER" envDefault:"none"`
+	OtlpEndpoint       string  `env:"OTLP_ENDPOINT" envDefault:"http://localhost:4318"`
+	TracingSampleRatio float64 `env:"TRACING_SAMPLE_RATIO" envDefault:"1"`
+	// Readiness checks of /readyz time out after HealthCheckTimeout and their
+	// result is reused for HealthCacheTTL.
+	HealthCheckTimeout time.Duration `env:"HEALTH_CHECK_TIMEOUT" envDefault:"2s"`
+	HealthCacheTTL     time.Duration `env:"HEALTH_CACHE_TTL" envDefault:"5s"`
+	// Rate limits per route group as token buckets per user, or per client IP
+	// before signin: Burst requests at once, refilled at PerMinute a minute. A
+	// PerMinute of 0 disables the limit of the group. The client limit applies
+	// to every request of a client IP before it is authenticated, so guessed
+	// credentials are limited too. RateLimitStore is "memory", or "postgres"
+	// to share the buckets between replicas.
+	RateLimitStore            string `env:"RATE_LIMIT_STORE" envDefault:"memory"`
+	RateLimitClientPerMinute  int    `env:"RATE_LIMIT_CLIENT_PER_MINUTE" envDefault:"300"`
+	RateLimitClientBurst      int    `env:"RATE_LIMIT_CLIENT_BURST" envDefault:"60"`
+	RateLimitAuthPerMinute    int    `env:"RATE_LIMIT_AUTH_PER_MINUTE" envDefault:"20"`
+	RateLimitAuthBurst        int    `env:"RATE_LIMIT_AUTH_BURST" envDefault:"10"`
+	RateLimitReportsPerMinute int    `env:"RATE_LIMIT_REPORTS_PER_MINUTE" envDefault:"120"`
+	RateLimitReportsBurst     int    `env:"RATE_LIMIT_REPORTS_BURST" envDefault:"30"`
+	RateLimitAdminPerMinute   int    `env:"RATE_LIMIT_ADMIN_PER_MINUTE" envDefault:"60"`
+	RateLimitAdminBurst       int    `env:"RATE_LIMIT_ADMIN_BURST" envDefault:"20"`
+	// MaxRequestBodyBytes is the largest request body accepted, larger ones
+	// get a 413.
+	MaxRequestBodyBytes int64 `env:"MAX_REQUEST_BODY_BYTES" envDefault:"1048576"`
 }
 
 func (c *Config) DatabaseUrl() string {
@@ -45,6 +137,15 @@ func (c *Config) DatabaseUrl() string {
 		c.DatabaseUser, c.DatabasePassword, c.DatabaseHost, port, c.DatabaseName, c.DatabaseSSLMode)
 }
 
+// Issuer returns the configured JWT issuer, falling back to the API server
+// base url when JWT_ISSUER is not set.
+func (c *Config) Issuer() string {
+	if c.JwtIssuer != "" {
+		return c.JwtIssuer
+	}
+	return "http://" + c.ApiServerHost + ":" + c.ApiServerPort
+}
+
 func New() (*Config, error) {
 
 	wd := "/Users/surendraraika/projects/asyncapi"
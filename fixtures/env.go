@@ -5,6 +5,7 @@ package fixtures
 // packages for database interaction, configuration management, and testing utilities.
 
 // Package imports:
+// - "crypto/rand" and "encoding/base64": Generate the throwaway TOTP encryption key.
 // - "database/sql": Provides generic interface around SQL (or SQL-like) databases.
 // - "fmt": Implements formatted I/O with functions analogous to C's printf and scanf.
 // - "os": Provides functions to interact with the operating system, such as reading environment variables.
@@ -13,6 +14,8 @@ package fixtures
 
 // Project-specific imports:
 // - "asyncapi/config": Handles configuration management for the AsyncAPI project.
+// - "asyncapi/passwords": Provides the password policy used to hash passwords.
+// - "asyncapi/totp": Provides the cipher used to encrypt TOTP secrets.
 // - "asyncapi/store": Manages data storage and retrieval for the AsyncAPI project.
 
 // Third-party imports:
@@ -20,14 +23,18 @@ package fixtures
 // - "github.com/lib/pq": A pure Go Postgres driver for database/sql.
 // - "github.com/stretchr/testify/require": Provides assertion methods for testing, ensuring test conditions are met.
 import (
+	"crypto/rand"
 	"database/sql"
+	"encoding/base64"
 	"fmt"
 	"os"
 	"strings"
 	"testing"
 
 	"asyncapi/config"
+	"asyncapi/passwords"
 	"asyncapi/store"
+	"asyncapi/totp"
 
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/lib/pq"
@@ -37,8 +44,10 @@ import (
 // TestEnv represents the test environment for integration tests.
 // It provides the configuration and database connection required for testing.
 type TestEnv struct {
-	Config *config.Config // The application configuration for the test environment.
-	Db     *sql.DB        // The database connection used for testing.
+	Config     *config.Config    // The application configuration for the test environment.
+	Db         *sql.DB           // The database connection used for testing.
+	Passwords  *passwords.Policy // The password policy of the configuration.
+	TotpCipher *totp.Cipher      // Encrypts TOTP secrets with the configured key.
 }
 
 // NewTestEnv initializes a new test environment for integration tests.
@@ -66,6 +75,17 @@ func NewTestEnv(t *testing.T) *TestEnv {
 	fmt.Printf(">>> database url: %s\n", conf.DatabaseUrl())
 	fmt.Printf(">>> project root: %s\n", os.Getenv("PROJECT_ROOT"))
 
+	// Load the password policy the stores hash passwords with
+	policy, err := passwords.LoadPolicy(conf)
+	require.NoError(t, err)
+	// The deployment provides the TOTP key, tests use a throwaway one
+	totpKey := make([]byte, 32)
+	_, err = rand.Read(totpKey)
+	require.NoError(t, err)
+	conf.TotpEncryptionKey = base64.StdEncoding.EncodeToString(totpKey)
+	totpCipher, err := totp.NewCipher(conf.TotpEncryptionKey)
+	require.NoError(t, err)
+
 	// Establish a connection to the PostgreSQL database
 	db, err := store.NewPostgresDb(conf)
 	require.NoError(t, err)
@@ -76,8 +96,10 @@ func NewTestEnv(t *testing.T) *TestEnv {
 
 	// Return the initialized test environment
 	return &TestEnv{
-		Db:     db,
-		Config: conf,
+		Db:         db,
+		Config:     conf,
+		Passwords:  policy,
+		TotpCipher: totpCipher,
 	}
 }
 
@@ -118,7 +140,7 @@ func (te *TestEnv) SetupDb(t *testing.T) func(t *testing.T) {
 // - t: The testing object used for assertions and cleanup.
 func (te *TestEnv) TeardownDb(t *testing.T) {
 	// Truncate all tables to remove test data
-	_, err := te.Db.Exec(fmt.Sprintf("TRUNCATE TABLE %s CASCADE", strings.Join([]string{"users", "refresh_tokens", "reports"}, ",")))
+	_, err := te.Db.Exec(fmt.Sprintf("TRUNCATE TABLE %s CASCADE", strings.Join([]string{"users", "refresh_tokens", "reports", "password_reset_tokens", "email_verification_tokens", "signin_failures", "mfa_recovery_codes", "api_keys", "organizations", "org_memberships", "user_identities", "oauth_clients", "rate_limit_buckets"}, ",")))
 	require.NoError(t, err)
 
 	// Close the database connection
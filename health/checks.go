@@ -0,0 +1,45 @@
+package health
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// Pinger is implemented by *sql.DB and *store.Store.
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// DbCheck checks that a connection of the pool reaches the database.
+func DbCheck(db Pinger) Check {
+	return func(ctx context.Context) error {
+		if err := db.PingContext(ctx); err != nil {
+			return fmt.Errorf("failed to ping the database: %w", err)
+		}
+		return nil
+	}
+}
+
+// SqsCheck checks that the queue exists and is reachable.
+func SqsCheck(client *sqs.Client, queue string) Check {
+	return func(ctx context.Context) error {
+		if _, err := client.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{QueueName: aws.String(queue)}); err != nil {
+			return fmt.Errorf("failed to get url for queue %s: %w", queue, err)
+		}
+		return nil
+	}
+}
+
+// S3Check checks that the bucket exists and the credentials can access it.
+func S3Check(client *s3.Client, bucket string) Check {
+	return func(ctx context.Context) error {
+		if _, err := client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(bucket)}); err != nil {
+			return fmt.Errorf("failed to access bucket %s: %w", bucket, err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,139 @@
+// Package health serves the liveness and readiness endpoints of the API
+// server and the worker.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	StatusOk          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// Check reports whether a dependency is usable, it must honour the deadline
+// of the context.
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// CheckResult is the outcome of one check. The error itself is only logged,
+// the endpoints are public and must not reveal internal addresses.
+type CheckResult struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+}
+
+// Report is the body of /readyz.
+type Report struct {
+	Status    string                 `json:"status"`
+	Checks    map[string]CheckResult `json:"checks"`
+	CheckedAt time.Time              `json:"checked_at"`
+}
+
+// Checker runs the readiness checks concurrently, each with a timeout, and
+// caches the report for a while so that probes can't overload a dependency.
+type Checker struct {
+	logger   *slog.Logger
+	timeout  time.Duration
+	cacheTTL time.Duration
+	checks   []namedCheck
+
+	mu     sync.Mutex
+	report *Report
+}
+
+// NewChecker creates a Checker without checks, see Add.
+func NewChecker(logger *slog.Logger, timeout, cacheTTL time.Duration) *Checker {
+	return &Checker{logger: logger, timeout: timeout, cacheTTL: cacheTTL}
+}
+
+// Add registers a check under the name of its dependency. Checks must be
+// added before the Checker is used.
+func (c *Checker) Add(name string, check Check) {
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// Check returns the readiness report, running the checks again when the cached
+// report is older than the cache TTL. Concurrent callers wait for a single run.
+func (c *Checker) Check(ctx context.Context) Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.report != nil && time.Since(c.report.CheckedAt) < c.cacheTTL {
+		return *c.report
+	}
+
+	report := Report{Status: StatusOk, Checks: make(map[string]CheckResult, len(c.checks)), CheckedAt: time.Now()}
+	results := make([]CheckResult, len(c.checks))
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			//the probe may be cancelled, the check must still finish for the cache
+			checkCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.timeout)
+			defer cancel()
+			start := time.Now()
+			err := check.check(checkCtx)
+			results[i] = CheckResult{Status: StatusOk, LatencyMs: float64(time.Since(start).Microseconds()) / 1000}
+			if err != nil {
+				results[i].Status = StatusUnavailable
+				c.logger.ErrorContext(ctx, "health check failed", "check", check.name, "error", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i, check := range c.checks {
+		report.Checks[check.name] = results[i]
+		if results[i].Status != StatusOk {
+			report.Status = StatusUnavailable
+		}
+	}
+	c.report = &report
+	return report
+}
+
+// LivenessHandler answers 200 as long as the process serves requests.
+func LivenessHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJson(w, http.StatusOK, map[string]string{"status": StatusOk})
+	}
+}
+
+// ReadinessHandler answers 200 with the report when every dependency is
+// reachable, and 503 otherwise.
+func (c *Checker) ReadinessHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := c.Check(r.Context())
+		status := http.StatusOK
+		if report.Status != StatusOk {
+			status = http.StatusServiceUnavailable
+		}
+		writeJson(w, status, report)
+	}
+}
+
+// Register adds /healthz and /readyz to the mux.
+func (c *Checker) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /healthz", LivenessHandler())
+	mux.HandleFunc("GET /readyz", c.ReadinessHandler())
+}
+
+func writeJson(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	//probes must always see the current state
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("failed to encode health response", "error", err)
+	}
+}
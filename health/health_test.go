@@ -0,0 +1,71 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"asyncapi/health"
+)
+
+func TestChecker(t *testing.T) {
+	var calls atomic.Int32
+	var failing atomic.Bool
+	checker := health.NewChecker(slog.Default(), 50*time.Millisecond, time.Hour)
+	checker.Add("database", func(ctx context.Context) error {
+		calls.Add(1)
+		return nil
+	})
+	checker.Add("queue", func(ctx context.Context) error {
+		if failing.Load() {
+			return errors.New("unreachable")
+		}
+		return nil
+	})
+
+	report := checker.Check(context.Background())
+	require.Equal(t, health.StatusOk, report.Status)
+	require.Equal(t, health.StatusOk, report.Checks["database"].Status)
+	require.Equal(t, health.StatusOk, report.Checks["queue"].Status)
+
+	//the report is cached
+	failing.Store(true)
+	require.Equal(t, health.StatusOk, checker.Check(context.Background()).Status)
+	require.EqualValues(t, 1, calls.Load())
+}
+
+func TestChecker_ReadinessHandler(t *testing.T) {
+	checker := health.NewChecker(slog.Default(), 50*time.Millisecond, 0)
+	checker.Add("database", func(ctx context.Context) error { return nil })
+	checker.Add("bucket", func(ctx context.Context) error {
+		//a hanging dependency fails on the timeout
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	mux := http.NewServeMux()
+	checker.Register(mux)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	var report health.Report
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&report))
+	require.Equal(t, health.StatusUnavailable, report.Status)
+	require.Equal(t, health.StatusOk, report.Checks["database"].Status)
+	require.Equal(t, health.StatusUnavailable, report.Checks["bucket"].Status)
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"status":"ok"}`, w.Body.String())
+}
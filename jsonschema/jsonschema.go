@@ -0,0 +1,279 @@
+// Package jsonschema derives JSON schemas from Go types, for the OpenAPI and
+// AsyncAPI documents, and validates JSON values against them.
+package jsonschema
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RefPrefix is where OpenAPI and AsyncAPI documents keep named schemas.
+const RefPrefix = "#/components/schemas/"
+
+// Schema is the subset of JSON Schema 2020-12 needed to describe the request,
+// response and message types.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 any                `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+var (
+	timeType = reflect.TypeFor[time.Time]()
+	uuidType = reflect.TypeFor[uuid.UUID]()
+)
+
+// Generator derives schemas from Go types the way encoding/json marshals
+// them. Named structs are collected in Schemas and referenced, generic and
+// anonymous ones such as ApiResponse[T] are inlined. Types of packages other
+// than the local one are prefixed with their package, health.Report is
+// HealthReport.
+type Generator struct {
+	Schemas  map[string]*Schema
+	localPkg string
+}
+
+// NewGenerator creates a Generator for the types of the package named
+// localPkg.
+func NewGenerator(localPkg string) *Generator {
+	return &Generator{Schemas: map[string]*Schema{}, localPkg: localPkg}
+}
+
+// Schema returns the schema of the type, or a reference to it.
+func (g *Generator) Schema(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case uuidType:
+		return &Schema{Type: "string", Format: "uuid"}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: g.Schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.Schema(t.Elem())}
+	case reflect.Struct:
+		name := t.Name()
+		if name == "" || strings.Contains(name, "[") {
+			return g.object(t)
+		}
+		if pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]; pkg != g.localPkg {
+			name = strings.ToUpper(pkg[:1]) + pkg[1:] + name
+		}
+		if _, ok := g.Schemas[name]; !ok {
+			//the placeholder stops recursive types
+			g.Schemas[name] = nil
+			g.Schemas[name] = g.object(t)
+		}
+		return &Schema{Ref: RefPrefix + name}
+	}
+	//interfaces can hold anything
+	return &Schema{}
+}
+
+func (g *Generator) object(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		//untagged embedded structs are flattened like encoding/json does
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			embedded := g.object(field.Type)
+			for name, property := range embedded.Properties {
+				if _, ok := s.Properties[name]; !ok {
+					s.Properties[name] = property
+				}
+			}
+			s.Required = append(s.Required, embedded.Required...)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		property := g.Schema(field.Type)
+		omitEmpty := slices.Contains(strings.Split(options, ","), "omitempty")
+		switch field.Type.Kind() {
+		case reflect.Pointer, reflect.Slice, reflect.Map:
+			if !omitEmpty {
+				property = nullable(property)
+			}
+		}
+		s.Properties[name] = property
+		if field.Type.Kind() != reflect.Pointer && !omitEmpty {
+			s.Required = append(s.Required, name)
+		}
+	}
+	//fields of the struct override those of embedded ones
+	slices.Sort(s.Required)
+	s.Required = slices.Compact(s.Required)
+	return s
+}
+
+// nullable allows null besides the schema, nil pointers, slices and maps are
+// marshalled as null unless they are omitted.
+func nullable(s *Schema) *Schema {
+	if s.Ref != "" {
+		return &Schema{AnyOf: []*Schema{s, {Type: "null"}}}
+	}
+	if s.Type != nil {
+		s.Type = []any{s.Type, "null"}
+	}
+	return s
+}
+
+// Validate checks a value decoded by encoding/json into an any against the
+// schema, resolving references in schemas. It supports the keywords of
+// Schema and the uuid and date-time formats, and returns every violation.
+func Validate(schema *Schema, schemas map[string]*Schema, value any) error {
+	v := validator{schemas: schemas}
+	v.validate("", schema, value)
+	return errors.Join(v.errs...)
+}
+
+type validator struct {
+	schemas map[string]*Schema
+	errs    []error
+}
+
+func (v *validator) fail(path, format string, args ...any) {
+	if path == "" {
+		path = "/"
+	}
+	v.errs = append(v.errs, fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...)))
+}
+
+func (v *validator) validate(path string, schema *Schema, value any) {
+	if schema.Ref != "" {
+		resolved := v.schemas[strings.TrimPrefix(schema.Ref, RefPrefix)]
+		if resolved == nil {
+			v.fail(path, "unresolved reference %s", schema.Ref)
+			return
+		}
+		schema = resolved
+	}
+	if len(schema.AnyOf) > 0 {
+		for _, candidate := range schema.AnyOf {
+			if Validate(candidate, v.schemas, value) == nil {
+				return
+			}
+		}
+		v.fail(path, "matches none of the allowed schemas")
+		return
+	}
+	if schema.Type != nil && !v.hasType(schema.Type, value) {
+		v.fail(path, "must be of type %v", schema.Type)
+		return
+	}
+	if len(schema.Enum) > 0 && !slices.Contains(schema.Enum, value) {
+		v.fail(path, "must be one of %v", schema.Enum)
+	}
+
+	switch value := value.(type) {
+	case string:
+		switch schema.Format {
+		case "uuid":
+			if _, err := uuid.Parse(value); err != nil {
+				v.fail(path, "must be a uuid")
+			}
+		case "date-time":
+			if _, err := time.Parse(time.RFC3339, value); err != nil {
+				v.fail(path, "must be an RFC 3339 date-time")
+			}
+		}
+	case map[string]any:
+		for _, name := range schema.Required {
+			if _, ok := value[name]; !ok {
+				v.fail(path+"/"+name, "is required")
+			}
+		}
+		for name, property := range value {
+			if propertySchema, ok := schema.Properties[name]; ok {
+				v.validate(path+"/"+name, propertySchema, property)
+			} else if schema.AdditionalProperties != nil {
+				v.validate(path+"/"+name, schema.AdditionalProperties, property)
+			}
+		}
+	case []any:
+		if schema.Items != nil {
+			for i, item := range value {
+				v.validate(fmt.Sprintf("%s/%d", path, i), schema.Items, item)
+			}
+		}
+	}
+}
+
+// hasType reports whether the value has the type, or one of the types.
+func (v *validator) hasType(schemaType any, value any) bool {
+	types, ok := schemaType.([]any)
+	if !ok {
+		types = []any{schemaType}
+	}
+	for _, t := range types {
+		switch t {
+		case "null":
+			if value == nil {
+				return true
+			}
+		case "string", "boolean", "number", "integer", "object", "array":
+			if typeOf(value) == t || t == "number" && typeOf(value) == "integer" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func typeOf(value any) string {
+	switch value := value.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		if value == float64(int64(value)) {
+			return "integer"
+		}
+		return "number"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	}
+	return "null"
+}
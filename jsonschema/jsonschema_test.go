@@ -0,0 +1,83 @@
+package jsonschema_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"asyncapi/jsonschema"
+)
+
+type item struct {
+	Id        uuid.UUID         `json:"id"`
+	Name      string            `json:"name,omitempty"`
+	Count     int64             `json:"count"`
+	DeletedAt *time.Time        `json:"deleted_at"`
+	Tags      []string          `json:"tags"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	internal  string
+}
+
+type envelope[T any] struct {
+	Data *T `json:"data,omitempty"`
+}
+
+func TestGenerator(t *testing.T) {
+	g := jsonschema.NewGenerator("jsonschema_test")
+	schema := g.Schema(reflect.TypeFor[envelope[[]item]]())
+
+	//generic types are inlined, named ones referenced
+	require.Equal(t, "object", schema.Type)
+	require.Equal(t, "array", schema.Properties["data"].Type)
+	require.Equal(t, jsonschema.RefPrefix+"item", schema.Properties["data"].Items.Ref)
+
+	item := g.Schemas["item"]
+	require.Equal(t, []string{"count", "id", "tags"}, item.Required)
+	require.Equal(t, "uuid", item.Properties["id"].Format)
+	require.Equal(t, "int64", item.Properties["count"].Format)
+	require.Equal(t, "date-time", item.Properties["deleted_at"].Format)
+	require.Equal(t, []any{"string", "null"}, item.Properties["deleted_at"].Type)
+	require.Equal(t, "string", item.Properties["labels"].AdditionalProperties.Type)
+	require.NotContains(t, item.Properties, "internal")
+
+	//types of other packages are prefixed with it
+	require.Equal(t, jsonschema.RefPrefix+"UuidNullUUID", g.Schema(reflect.TypeFor[uuid.NullUUID]()).Ref)
+}
+
+func TestValidate(t *testing.T) {
+	g := jsonschema.NewGenerator("jsonschema_test")
+	schema := g.Schema(reflect.TypeFor[item]())
+
+	tests := []struct {
+		name   string
+		value  string
+		errors []string
+	}{
+		{name: "valid", value: `{"id":"6f1f1f5e-8a35-4c6e-9d1c-1b2b3c4d5e6f","count":2,"tags":[],"deleted_at":"2024-01-02T03:04:05Z"}`},
+		{name: "null", value: `{"id":"6f1f1f5e-8a35-4c6e-9d1c-1b2b3c4d5e6f","count":2,"tags":null,"deleted_at":null}`},
+		{name: "missing", value: `{"count":2}`, errors: []string{"/id: is required", "/tags: is required"}},
+		{name: "types", value: `{"id":"nope","count":1.5,"tags":[1],"labels":{"a":true}}`, errors: []string{
+			"/id: must be a uuid", "/count: must be of type integer", "/tags/0: must be of type string", "/labels/a: must be of type string",
+		}},
+		{name: "not an object", value: `[]`, errors: []string{"/: must be of type object"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var value any
+			require.NoError(t, json.Unmarshal([]byte(tt.value), &value))
+			err := jsonschema.Validate(schema, g.Schemas, value)
+			if tt.errors == nil {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			for _, msg := range tt.errors {
+				require.Contains(t, err.Error(), msg)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LogMailer writes messages to the logger instead of sending them.
+type LogMailer struct {
+	logger *slog.Logger
+	from   string
+}
+
+func NewLogMailer(logger *slog.Logger, from string) *LogMailer {
+	return &LogMailer{logger: logger, from: from}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	m.logger.InfoContext(ctx, "mail sent",
+		slog.String("from", m.from),
+		slog.String("to", msg.To),
+		slog.String("subject", msg.Subject),
+		slog.String("body", msg.Body),
+	)
+	return nil
+}
+
+// FileMailer writes every message as an .eml file into a directory, so tests
+// and local setups can inspect what would have been sent.
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+func NewFileMailer(dir, from string) *FileMailer {
+	return &FileMailer{dir: dir, from: from}
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create mail directory %s: %w", m.dir, err)
+	}
+	now := time.Now()
+	name := fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405.000000000"), uuid.NewString())
+	path := filepath.Join(m.dir, name)
+	if err := os.WriteFile(path, format(m.from, msg, now), 0o644); err != nil {
+		return fmt.Errorf("failed to write mail to %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"asyncapi/config"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends emails on behalf of the API server.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New returns the Mailer selected by config.Mailer: "smtp" sends through the
+// configured SMTP server, "file" writes .eml files to config.MailDir and
+// anything else logs the message, which is the default for local development.
+func New(conf *config.Config, logger *slog.Logger) Mailer {
+	switch conf.Mailer {
+	case "smtp":
+		return NewSmtpMailer(conf.SmtpHost, conf.SmtpPort, conf.SmtpUsername, conf.SmtpPassword, conf.MailFrom)
+	case "file":
+		return NewFileMailer(conf.MailDir, conf.MailFrom)
+	default:
+		return NewLogMailer(logger, conf.MailFrom)
+	}
+}
+
+// format renders the message in RFC 5322 format.
+func format(from string, msg Message, now time.Time) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(msg.Body)
+	return b.Bytes()
+}
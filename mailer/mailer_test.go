@@ -0,0 +1,47 @@
+package mailer_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"asyncapi/mailer"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	m := mailer.NewFileMailer(dir, "noreply@asyncapi.local")
+
+	err := m.Send(context.Background(), mailer.Message{
+		To:      "test@test.com",
+		Subject: "hello",
+		Body:    "body text",
+	})
+	require.NoError(t, err)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	content, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	require.Contains(t, string(content), "From: noreply@asyncapi.local\r\n")
+	require.Contains(t, string(content), "To: test@test.com\r\n")
+	require.Contains(t, string(content), "Subject: hello\r\n")
+	require.Contains(t, string(content), "\r\n\r\nbody text")
+}
+
+func TestLogMailer(t *testing.T) {
+	var buf bytes.Buffer
+	m := mailer.NewLogMailer(slog.New(slog.NewTextHandler(&buf, nil)), "noreply@asyncapi.local")
+
+	err := m.Send(context.Background(), mailer.Message{To: "test@test.com", Subject: "hello", Body: "body text"})
+	require.NoError(t, err)
+	require.Contains(t, buf.String(), "to=test@test.com")
+	require.Contains(t, buf.String(), "subject=hello")
+}
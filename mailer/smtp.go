@@ -0,0 +1,44 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"time"
+)
+
+// SmtpMailer sends messages through an SMTP server, authenticating with
+// PLAIN auth when a username is configured.
+type SmtpMailer struct {
+	addr     string
+	host     string
+	username string
+	password string
+	from     string
+}
+
+func NewSmtpMailer(host, port, username, password, from string) *SmtpMailer {
+	return &SmtpMailer{
+		addr:     net.JoinHostPort(host, port),
+		host:     host,
+		username: username,
+		password: password,
+		from:     from,
+	}
+}
+
+func (m *SmtpMailer) Send(ctx context.Context, msg Message) error {
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+	// net/smtp does not take a context, so honour cancellation before dialing.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := smtp.SendMail(m.addr, auth, m.from, []string{msg.To}, format(m.from, msg, time.Now())); err != nil {
+		return fmt.Errorf("failed to send mail to %s via %s: %w", msg.To, m.addr, err)
+	}
+	return nil
+}
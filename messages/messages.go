@@ -0,0 +1,172 @@
+// Package messages defines the versioned envelope of the SQS messages sent by
+// the API server to the worker, see reports.NewAsyncApiDocument.
+//
+// Versions are "major.minor". A minor version only adds optional fields,
+// which decoders of older minor versions ignore. A new major version breaks
+// older decoders: workers must be deployed with support for it before the API
+// server starts sending it.
+package messages
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"asyncapi/tracing"
+)
+
+// TypeGenerateReport asks the worker to build a report, its payload is a
+// GenerateReport.
+const TypeGenerateReport = "report.generate"
+
+const (
+	// Version is the version of the envelopes written by Marshal.
+	Version = "2.0"
+	// LegacyVersion is the version given to the bare GenerateReport bodies
+	// sent before the envelope.
+	LegacyVersion = "1.0"
+)
+
+var (
+	// ErrUnsupportedVersion is returned for a major version the decoder
+	// doesn't know, such messages belong in the dead letter queue.
+	ErrUnsupportedVersion = errors.New("unsupported message version")
+	// ErrUnknownType is returned for a message type the decoder doesn't know.
+	ErrUnknownType = errors.New("unknown message type")
+)
+
+// Envelope wraps every message with what is needed to route, trace and
+// evolve it.
+type Envelope struct {
+	Type      string    `json:"type"`
+	Version   string    `json:"version"`
+	Id        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	// Trace is the W3C trace context of the sender.
+	Trace   map[string]string `json:"trace,omitempty"`
+	Payload json.RawMessage   `json:"payload"`
+}
+
+// GenerateReport is the payload of TypeGenerateReport messages.
+type GenerateReport struct {
+	UserId   uuid.UUID `json:"user_id"`
+	ReportId uuid.UUID `json:"report_id"`
+}
+
+// Marshal wraps the payload in an envelope of the current version carrying
+// the trace context of ctx.
+func Marshal(ctx context.Context, msgType string, payload any) ([]byte, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal the %s payload: %w", msgType, err)
+	}
+	body, err := json.Marshal(Envelope{
+		Type:      msgType,
+		Version:   Version,
+		Id:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		Trace:     tracing.Inject(ctx),
+		Payload:   data,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal the %s envelope: %w", msgType, err)
+	}
+	return body, nil
+}
+
+// Decode decodes an envelope of a supported major version, or a legacy body
+// which it wraps in an envelope of LegacyVersion.
+func Decode(body []byte) (*Envelope, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, fmt.Errorf("failed to decode the message: %w", err)
+	}
+	if _, ok := fields["version"]; !ok {
+		//legacy bodies are the bare payload of a report request
+		if _, ok := fields["report_id"]; !ok {
+			return nil, errors.New("message is neither an envelope nor a legacy report request")
+		}
+		return &Envelope{Type: TypeGenerateReport, Version: LegacyVersion, Payload: body}, nil
+	}
+
+	var envelope Envelope
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, fmt.Errorf("failed to decode the message envelope: %w", err)
+	}
+	major, err := envelope.Major()
+	if err != nil {
+		return nil, err
+	}
+	if major != majorVersion(Version) {
+		return nil, fmt.Errorf("%w %s", ErrUnsupportedVersion, envelope.Version)
+	}
+	if envelope.Type != TypeGenerateReport {
+		return nil, fmt.Errorf("%w %q", ErrUnknownType, envelope.Type)
+	}
+	if len(envelope.Payload) == 0 {
+		return nil, fmt.Errorf("%s message %s has no payload", envelope.Type, envelope.Id)
+	}
+	return &envelope, nil
+}
+
+// ReportId returns the id of the report a message asks for, looking at the
+// payload of an envelope of any version or type and at a legacy body. It is
+// meant for messages Decode rejected, so their report can be marked failed.
+func ReportId(body []byte) (uuid.UUID, bool) {
+	var probe struct {
+		ReportId string `json:"report_id"`
+		Payload  struct {
+			ReportId string `json:"report_id"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(body, &probe); err != nil {
+		return uuid.Nil, false
+	}
+	raw := probe.Payload.ReportId
+	if raw == "" {
+		raw = probe.ReportId
+	}
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// Major returns the major version of the envelope.
+func (e *Envelope) Major() (int, error) {
+	major, err := strconv.Atoi(strings.SplitN(e.Version, ".", 2)[0])
+	if err != nil {
+		return 0, fmt.Errorf("%w %q", ErrUnsupportedVersion, e.Version)
+	}
+	return major, nil
+}
+
+// DecodePayload decodes the payload into v. Unknown fields are ignored so
+// newer minor versions can be decoded.
+func (e *Envelope) DecodePayload(v any) error {
+	if err := json.Unmarshal(e.Payload, v); err != nil {
+		return fmt.Errorf("failed to decode the %s payload: %w", e.Type, err)
+	}
+	return nil
+}
+
+// Context returns ctx with the trace context of the sender, legacy messages
+// carry none.
+func (e *Envelope) Context(ctx context.Context) context.Context {
+	if len(e.Trace) == 0 {
+		return ctx
+	}
+	return tracing.Extract(ctx, e.Trace)
+}
+
+func majorVersion(version string) int {
+	major, _ := strconv.Atoi(strings.SplitN(version, ".", 2)[0])
+	return major
+}
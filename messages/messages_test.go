@@ -0,0 +1,114 @@
+package messages_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"asyncapi/config"
+	"asyncapi/messages"
+	"asyncapi/tracing"
+)
+
+func TestMarshalDecode(t *testing.T) {
+	_, err := tracing.Setup(context.Background(), &config.Config{TracingExporter: tracing.ExporterNone}, "test")
+	require.NoError(t, err)
+	ctx, span := sdktrace.NewTracerProvider().Tracer("test").Start(context.Background(), "send")
+	defer span.End()
+
+	payload := messages.GenerateReport{UserId: uuid.New(), ReportId: uuid.New()}
+	body, err := messages.Marshal(ctx, messages.TypeGenerateReport, payload)
+	require.NoError(t, err)
+
+	envelope, err := messages.Decode(body)
+	require.NoError(t, err)
+	require.Equal(t, messages.TypeGenerateReport, envelope.Type)
+	require.Equal(t, messages.Version, envelope.Version)
+	require.NotEqual(t, uuid.Nil, envelope.Id)
+	require.False(t, envelope.CreatedAt.IsZero())
+
+	var decoded messages.GenerateReport
+	require.NoError(t, envelope.DecodePayload(&decoded))
+	require.Equal(t, payload, decoded)
+
+	//the worker continues the trace of the sender
+	extracted := trace.SpanContextFromContext(envelope.Context(context.Background()))
+	require.Equal(t, span.SpanContext().TraceID(), extracted.TraceID())
+}
+
+func TestDecode(t *testing.T) {
+	userId, reportId := uuid.New(), uuid.New()
+	envelope := func(version, msgType string, payload string) []byte {
+		return []byte(`{"type":"` + msgType + `","version":"` + version + `","id":"` + uuid.NewString() +
+			`","created_at":"2025-01-02T03:04:05Z","payload":` + payload + `}`)
+	}
+	payload := `{"user_id":"` + userId.String() + `","report_id":"` + reportId.String() + `"}`
+
+	tests := []struct {
+		name    string
+		body    []byte
+		version string
+		err     error
+		invalid bool
+	}{
+		{name: "legacy", body: []byte(payload), version: messages.LegacyVersion},
+		{name: "current", body: envelope(messages.Version, messages.TypeGenerateReport, payload), version: messages.Version},
+		//newer minor versions only add fields
+		{name: "newer minor", body: envelope("2.7", messages.TypeGenerateReport,
+			`{"user_id":"`+userId.String()+`","report_id":"`+reportId.String()+`","priority":"high"}`), version: "2.7"},
+		{name: "newer major", body: envelope("3.0", messages.TypeGenerateReport, payload), err: messages.ErrUnsupportedVersion},
+		{name: "garbled version", body: envelope("v2", messages.TypeGenerateReport, payload), err: messages.ErrUnsupportedVersion},
+		{name: "unknown type", body: envelope(messages.Version, "report.delete", payload), err: messages.ErrUnknownType},
+		{name: "not json", body: []byte(`report`), invalid: true},
+		{name: "unrelated object", body: []byte(`{"hello":"world"}`), invalid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			envelope, err := messages.Decode(tt.body)
+			switch {
+			case tt.err != nil:
+				require.ErrorIs(t, err, tt.err)
+			case tt.invalid:
+				require.Error(t, err)
+				require.NotErrorIs(t, err, messages.ErrUnsupportedVersion)
+			default:
+				require.NoError(t, err)
+				require.Equal(t, tt.version, envelope.Version)
+				var decoded messages.GenerateReport
+				require.NoError(t, envelope.DecodePayload(&decoded))
+				require.Equal(t, messages.GenerateReport{UserId: userId, ReportId: reportId}, decoded)
+				require.True(t, json.Valid(envelope.Payload))
+			}
+		})
+	}
+}
+
+func TestReportId(t *testing.T) {
+	reportId := uuid.New()
+	tests := []struct {
+		name string
+		body string
+		ok   bool
+	}{
+		{name: "legacy", body: `{"user_id":"` + uuid.NewString() + `","report_id":"` + reportId.String() + `"}`, ok: true},
+		{name: "newer major", body: `{"type":"report.generate","version":"3.0","payload":{"report_id":"` + reportId.String() + `","user":{}}}`, ok: true},
+		{name: "unknown type", body: `{"type":"report.delete","version":"2.0","payload":{"report_id":"` + reportId.String() + `"}}`, ok: true},
+		{name: "invalid id", body: `{"type":"report.generate","version":"2.0","payload":{"report_id":"report"}}`},
+		{name: "payload of another type", body: `{"type":"report.generate","version":"2.0","payload":{"report_id":42}}`},
+		{name: "not json", body: `report`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, ok := messages.ReportId([]byte(tt.body))
+			require.Equal(t, tt.ok, ok)
+			if tt.ok {
+				require.Equal(t, reportId, id)
+			}
+		})
+	}
+}
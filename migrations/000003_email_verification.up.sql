@@ -0,0 +1,10 @@
+ALTER TABLE users ADD COLUMN verified_at TIMESTAMPTZ;
+
+CREATE TABLE email_verification_tokens (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    hashed_token VARCHAR(500) NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    PRIMARY KEY (user_id, hashed_token)
+);
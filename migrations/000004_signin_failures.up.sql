@@ -0,0 +1,6 @@
+CREATE TABLE signin_failures (
+    key VARCHAR(400) PRIMARY KEY,
+    failures INTEGER NOT NULL DEFAULT 0,
+    locked_until TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,3 @@
+ALTER TABLE reports DROP COLUMN IF EXISTS org_id;
+DROP TABLE IF EXISTS org_memberships;
+DROP TABLE IF EXISTS organizations;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS reports_user_id_created_at_idx;
+ALTER TABLE reports DROP COLUMN IF EXISTS output_size_bytes;
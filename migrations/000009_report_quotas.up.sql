@@ -0,0 +1,3 @@
+ALTER TABLE reports ADD COLUMN output_size_bytes BIGINT;
+
+CREATE INDEX reports_user_id_created_at_idx ON reports (user_id, created_at);
@@ -0,0 +1,11 @@
+CREATE TABLE oauth_clients (
+    id VARCHAR(64) PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    owner_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    hashed_secret VARCHAR(500) NOT NULL,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX oauth_clients_owner_id_idx ON oauth_clients (owner_id);
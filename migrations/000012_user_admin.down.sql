@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS reports_created_at_idx;
+ALTER TABLE users DROP COLUMN IF EXISTS sessions_revoked_at;
+ALTER TABLE users DROP COLUMN IF EXISTS disabled_at;
@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN disabled_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN sessions_revoked_at TIMESTAMPTZ;
+
+CREATE INDEX reports_created_at_idx ON reports (created_at);
@@ -0,0 +1,2 @@
+-- encrypted secrets are longer than the 64 characters of a plain one
+ALTER TABLE users ALTER COLUMN totp_secret TYPE TEXT;
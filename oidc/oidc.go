@@ -0,0 +1,291 @@
+// Package oidc implements the parts of OpenID Connect needed to sign users in
+// with the authorization code flow: provider discovery, the code exchange and
+// verification of RS256 signed ID tokens against the provider's keys.
+package oidc
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Config describes the provider and the client registered with it.
+type Config struct {
+	// Issuer is the provider URL, its metadata is discovered from
+	// <Issuer>/.well-known/openid-configuration.
+	Issuer       string
+	ClientId     string
+	ClientSecret string
+	RedirectUrl  string
+	Scopes       []string
+	// Leeway is accepted on the expiry and issue time of ID tokens.
+	Leeway time.Duration
+}
+
+// Metadata is the subset of the provider metadata used by Provider.
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksUri               string `json:"jwks_uri"`
+}
+
+// Claims are the ID token claims used to sign a user in.
+type Claims struct {
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Nonce         string `json:"nonce"`
+	jwt.RegisteredClaims
+}
+
+// Provider talks to one OpenID provider. Its metadata and keys are fetched on
+// first use and cached, so creating a Provider never fails on the network.
+type Provider struct {
+	config Config
+	client *http.Client
+
+	mu       sync.Mutex
+	metadata *Metadata
+	keys     map[string]*rsa.PublicKey
+	// keysFetchedAt rate limits refetching the keys for unknown key IDs.
+	keysFetchedAt time.Time
+}
+
+func NewProvider(config Config, client *http.Client) *Provider {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email"}
+	}
+	return &Provider{
+		config: config,
+		client: client,
+	}
+}
+
+// Issuer returns the configured issuer URL.
+func (p *Provider) Issuer() string {
+	return p.config.Issuer
+}
+
+// Metadata returns the discovered provider metadata.
+func (p *Provider) Metadata(ctx context.Context) (*Metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.metadataLocked(ctx)
+}
+
+func (p *Provider) metadataLocked(ctx context.Context) (*Metadata, error) {
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+	wellKnown := strings.TrimSuffix(p.config.Issuer, "/") + "/.well-known/openid-configuration"
+	var metadata Metadata
+	if err := p.getJson(ctx, wellKnown, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to discover provider: %w", err)
+	}
+	if metadata.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("provider issuer %q does not match configured issuer %q", metadata.Issuer, p.config.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JwksUri == "" {
+		return nil, errors.New("provider metadata is missing an endpoint")
+	}
+	p.metadata = &metadata
+	return p.metadata, nil
+}
+
+// AuthCodeUrl returns the URL to redirect the user to for signing in.
+func (p *Provider) AuthCodeUrl(ctx context.Context, state, nonce string) (string, error) {
+	metadata, err := p.Metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+	authUrl, err := url.Parse(metadata.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid authorization endpoint: %w", err)
+	}
+	query := authUrl.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.ClientId)
+	query.Set("redirect_uri", p.config.RedirectUrl)
+	query.Set("scope", strings.Join(p.config.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	authUrl.RawQuery = query.Encode()
+	return authUrl.String(), nil
+}
+
+// Exchange redeems the authorization code at the token endpoint and returns
+// the verified claims of the ID token, which must carry the given nonce.
+func (p *Provider) Exchange(ctx context.Context, code, nonce string) (*Claims, error) {
+	metadata, err := p.Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {p.config.RedirectUrl},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.config.ClientId), url.QueryEscape(p.config.ClientSecret))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange code: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned %s: %s", resp.Status, body)
+	}
+	var tokens struct {
+		IdToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return nil, fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if tokens.IdToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+	return p.Verify(ctx, tokens.IdToken, nonce)
+}
+
+// Verify checks the signature, issuer, audience, expiry and nonce of an ID
+// token and returns its claims.
+func (p *Provider) Verify(ctx context.Context, idToken, nonce string) (*Claims, error) {
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		jwt.WithIssuer(p.config.Issuer),
+		jwt.WithAudience(p.config.ClientId),
+		jwt.WithLeeway(p.config.Leeway),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	var claims Claims
+	if _, err := parser.ParseWithClaims(idToken, &claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, kid)
+	}); err != nil {
+		return nil, fmt.Errorf("invalid id token: %w", err)
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("id token has no subject")
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("id token nonce does not match")
+	}
+	return &claims, nil
+}
+
+// key returns the provider key with the given ID, refetching the keys at
+// most once a minute when it's unknown, e.g. after the provider rotated them.
+func (p *Provider) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetchedAt) < time.Minute {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	metadata, err := p.metadataLocked(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var set jsonWebKeySet
+	if err := p.getJson(ctx, metadata.JwksUri, &set); err != nil {
+		return nil, fmt.Errorf("failed to fetch provider keys: %w", err)
+	}
+	p.keys = set.rsaKeys()
+	p.keysFetchedAt = time.Now()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+// lookupKey finds the key by ID, or the only key when the token has no ID.
+func (p *Provider) lookupKey(kid string) (*rsa.PublicKey, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+func (p *Provider) getJson(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %s", url, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+// rsaKeys returns the RSA signing keys of the set by key ID, skipping the
+// keys it can't use.
+func (s jsonWebKeySet) rsaKeys() map[string]*rsa.PublicKey {
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range s.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) > 4 {
+			continue
+		}
+		exponent := new(big.Int).SetBytes(e)
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}
+	}
+	return keys
+}
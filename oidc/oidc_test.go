@@ -0,0 +1,189 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"asyncapi/oidc"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeIssuer is a minimal OpenID provider issuing ID tokens for the codes
+// registered in codes.
+type fakeIssuer struct {
+	*httptest.Server
+	key   *rsa.PrivateKey
+	codes map[string]oidc.Claims
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	f := &fakeIssuer{key: key, codes: map[string]oidc.Claims{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidc.Metadata{
+			Issuer:                f.URL,
+			AuthorizationEndpoint: f.URL + "/authorize",
+			TokenEndpoint:         f.URL + "/token",
+			JwksUri:               f.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		clientId, clientSecret, ok := r.BasicAuth()
+		if !ok || clientId != "client" || clientSecret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		claims, ok := f.codes[r.FormValue("code")]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": f.sign(t, claims)})
+	})
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeIssuer) sign(t *testing.T, claims oidc.Claims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test"
+	raw, err := token.SignedString(f.key)
+	require.NoError(t, err)
+	return raw
+}
+
+func (f *fakeIssuer) claims(nonce string) oidc.Claims {
+	return oidc.Claims{
+		Email:         "test@test.com",
+		EmailVerified: true,
+		Nonce:         nonce,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    f.URL,
+			Subject:   "subject",
+			Audience:  jwt.ClaimStrings{"client"},
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	}
+}
+
+func TestProvider(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	provider := oidc.NewProvider(oidc.Config{
+		Issuer:       issuer.URL,
+		ClientId:     "client",
+		ClientSecret: "secret",
+		RedirectUrl:  "http://localhost:8080/auth/oidc/callback",
+	}, issuer.Client())
+	ctx := context.Background()
+
+	authUrl, err := provider.AuthCodeUrl(ctx, "state", "nonce")
+	require.NoError(t, err)
+	parsed, err := url.Parse(authUrl)
+	require.NoError(t, err)
+	require.Equal(t, "/authorize", parsed.Path)
+	require.Equal(t, "client", parsed.Query().Get("client_id"))
+	require.Equal(t, "openid email", parsed.Query().Get("scope"))
+	require.Equal(t, "state", parsed.Query().Get("state"))
+	require.Equal(t, "nonce", parsed.Query().Get("nonce"))
+
+	issuer.codes["code"] = issuer.claims("nonce")
+	claims, err := provider.Exchange(ctx, "code", "nonce")
+	require.NoError(t, err)
+	require.Equal(t, "subject", claims.Subject)
+	require.Equal(t, "test@test.com", claims.Email)
+	require.True(t, claims.EmailVerified)
+
+	_, err = provider.Exchange(ctx, "code", "other nonce")
+	require.Error(t, err)
+	_, err = provider.Exchange(ctx, "unknown code", "nonce")
+	require.Error(t, err)
+}
+
+func TestProvider_Verify(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	provider := oidc.NewProvider(oidc.Config{Issuer: issuer.URL, ClientId: "client"}, issuer.Client())
+	ctx := context.Background()
+
+	claims := issuer.claims("nonce")
+	_, err := provider.Verify(ctx, issuer.sign(t, claims), "nonce")
+	require.NoError(t, err)
+
+	tests := map[string]func(c *oidc.Claims){
+		"expired":      func(c *oidc.Claims) { c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute)) },
+		"wrong issuer": func(c *oidc.Claims) { c.Issuer = "https://evil.example.com" },
+		"wrong client": func(c *oidc.Claims) { c.Audience = jwt.ClaimStrings{"other"} },
+		"no subject":   func(c *oidc.Claims) { c.Subject = "" },
+	}
+	for name, mutate := range tests {
+		t.Run(name, func(t *testing.T) {
+			claims := issuer.claims("nonce")
+			mutate(&claims)
+			_, err := provider.Verify(ctx, issuer.sign(t, claims), "nonce")
+			require.Error(t, err)
+		})
+	}
+
+	//signed with another key
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, issuer.claims("nonce"))
+	token.Header["kid"] = "test"
+	forged, err := token.SignedString(otherKey)
+	require.NoError(t, err)
+	_, err = provider.Verify(ctx, forged, "nonce")
+	require.Error(t, err)
+
+	//HS256 signed with the public key must not be accepted
+	hsToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, issuer.claims("nonce")).SignedString(issuer.key.N.Bytes())
+	require.NoError(t, err)
+	_, err = provider.Verify(ctx, hsToken, "nonce")
+	require.Error(t, err)
+}
+
+func TestState(t *testing.T) {
+	secret := []byte("secret")
+	now := time.Now()
+	state, nonce, err := oidc.NewState()
+	require.NoError(t, err)
+	require.NotEqual(t, state, nonce)
+
+	value := oidc.EncodeState(secret, state, nonce, now.Add(time.Minute))
+	decodedState, decodedNonce, err := oidc.DecodeState(secret, value, now)
+	require.NoError(t, err)
+	require.Equal(t, state, decodedState)
+	require.Equal(t, nonce, decodedNonce)
+
+	_, _, err = oidc.DecodeState(secret, value, now.Add(2*time.Minute))
+	require.ErrorIs(t, err, oidc.ErrInvalidState)
+	_, _, err = oidc.DecodeState([]byte("other"), value, now)
+	require.ErrorIs(t, err, oidc.ErrInvalidState)
+	_, _, err = oidc.DecodeState(secret, "x"+value, now)
+	require.ErrorIs(t, err, oidc.ErrInvalidState)
+}
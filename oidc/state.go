@@ -0,0 +1,60 @@
+package oidc
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidState is returned by DecodeState for tampered or expired values.
+var ErrInvalidState = errors.New("invalid or expired oidc state")
+
+// NewState returns a random state and nonce for one sign in attempt.
+func NewState() (state string, nonce string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("failed to generate oidc state: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b[:16]), base64.RawURLEncoding.EncodeToString(b[16:]), nil
+}
+
+// EncodeState packs the state and nonce into a value signed with the secret,
+// to be kept by the browser in a cookie until the provider redirects back.
+func EncodeState(secret []byte, state, nonce string, expiresAt time.Time) string {
+	payload := state + "." + nonce + "." + strconv.FormatInt(expiresAt.Unix(), 10)
+	return payload + "." + sign(secret, payload)
+}
+
+// DecodeState verifies a value produced by EncodeState and returns its state
+// and nonce.
+func DecodeState(secret []byte, value string, now time.Time) (state string, nonce string, err error) {
+	i := strings.LastIndex(value, ".")
+	if i < 0 {
+		return "", "", ErrInvalidState
+	}
+	payload, signature := value[:i], value[i+1:]
+	if !hmac.Equal([]byte(signature), []byte(sign(secret, payload))) {
+		return "", "", ErrInvalidState
+	}
+	parts := strings.Split(payload, ".")
+	if len(parts) != 3 {
+		return "", "", ErrInvalidState
+	}
+	expiresAt, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil || now.Unix() > expiresAt {
+		return "", "", ErrInvalidState
+	}
+	return parts[0], parts[1], nil
+}
+
+func sign(secret []byte, payload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("oidc-state:" + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,120 @@
+package passwords
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"asyncapi/config"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MaxBcryptLength is the number of bytes bcrypt takes into account, anything
+// beyond it is silently ignored.
+const MaxBcryptLength = 72
+
+// Policy describes which passwords are accepted and how they are hashed.
+type Policy struct {
+	// MinLength is the minimum number of characters.
+	MinLength int
+	// MaxLength is the maximum number of bytes, at most MaxBcryptLength.
+	MaxLength int
+	// Cost is the bcrypt cost new hashes are generated with.
+	Cost int
+	// breached holds lowercased passwords known from data breaches.
+	breached map[string]struct{}
+}
+
+// NewPolicy returns a policy rejecting the given breached passwords
+// (compared case-insensitively).
+func NewPolicy(minLength, maxLength, cost int, breached []string) (*Policy, error) {
+	if maxLength <= 0 || maxLength > MaxBcryptLength {
+		maxLength = MaxBcryptLength
+	}
+	if minLength > maxLength {
+		return nil, fmt.Errorf("password min length %d is greater than max length %d", minLength, maxLength)
+	}
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("bcrypt cost %d is outside of [%d, %d]", cost, bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	p := &Policy{
+		MinLength: minLength,
+		MaxLength: maxLength,
+		Cost:      cost,
+		breached:  make(map[string]struct{}, len(breached)),
+	}
+	for _, password := range breached {
+		p.breached[strings.ToLower(password)] = struct{}{}
+	}
+	return p, nil
+}
+
+// LoadPolicy builds the policy from the configuration, reading the breached
+// password list from conf.BreachedPasswordsFile when set.
+func LoadPolicy(conf *config.Config) (*Policy, error) {
+	var breached []string
+	if conf.BreachedPasswordsFile != "" {
+		var err error
+		breached, err = readList(conf.BreachedPasswordsFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return NewPolicy(conf.PasswordMinLength, conf.PasswordMaxLength, conf.BcryptCost, breached)
+}
+
+// readList reads one password per line, skipping blank lines and # comments.
+func readList(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached password list: %w", err)
+	}
+	defer f.Close()
+
+	var list []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		list = append(list, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read breached password list: %w", err)
+	}
+	return list, nil
+}
+
+// Validate returns an error describing why the password is not acceptable.
+func (p *Policy) Validate(password string) error {
+	if n := utf8.RuneCountInString(password); n < p.MinLength {
+		return fmt.Errorf("password must be at least %d characters long", p.MinLength)
+	}
+	if len(password) > p.MaxLength {
+		return fmt.Errorf("password must be at most %d bytes long", p.MaxLength)
+	}
+	if _, ok := p.breached[strings.ToLower(password)]; ok {
+		return errors.New("password is too common, it appears in a list of breached passwords")
+	}
+	return nil
+}
+
+// Hash returns the bcrypt hash of the password using the policy's cost.
+func (p *Policy) Hash(password string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(password), p.Cost)
+}
+
+// NeedsRehash reports whether the bcrypt hash was generated with a lower cost
+// than the policy's and should be replaced.
+func (p *Policy) NeedsRehash(hash []byte) bool {
+	cost, err := bcrypt.Cost(hash)
+	if err != nil {
+		return false
+	}
+	return cost < p.Cost
+}
@@ -0,0 +1,63 @@
+package passwords_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"asyncapi/config"
+	"asyncapi/passwords"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPolicy_Validate(t *testing.T) {
+	policy, err := passwords.NewPolicy(8, 100, bcrypt.MinCost, []string{"Password1"})
+	require.NoError(t, err)
+	require.Equal(t, passwords.MaxBcryptLength, policy.MaxLength, "max length is capped by bcrypt")
+
+	require.NoError(t, policy.Validate("correct horse"))
+	require.NoError(t, policy.Validate("pässwörd"), "length is counted in characters")
+	require.Error(t, policy.Validate("short"))
+	require.Error(t, policy.Validate(strings.Repeat("a", 73)))
+	require.Error(t, policy.Validate("password1"), "breached passwords are compared case-insensitively")
+
+	_, err = passwords.NewPolicy(80, 72, bcrypt.DefaultCost, nil)
+	require.Error(t, err)
+	_, err = passwords.NewPolicy(8, 72, 100, nil)
+	require.Error(t, err)
+}
+
+func TestPolicy_NeedsRehash(t *testing.T) {
+	weak, err := passwords.NewPolicy(8, 72, bcrypt.MinCost, nil)
+	require.NoError(t, err)
+	strong, err := passwords.NewPolicy(8, 72, bcrypt.MinCost+1, nil)
+	require.NoError(t, err)
+
+	hash, err := weak.Hash("correct horse")
+	require.NoError(t, err)
+	require.False(t, weak.NeedsRehash(hash))
+	require.True(t, strong.NeedsRehash(hash))
+	require.False(t, strong.NeedsRehash([]byte("not a hash")))
+}
+
+func TestLoadPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# top passwords\n123456789\n\n  qwertyuiop  \n"), 0o644))
+
+	policy, err := passwords.LoadPolicy(&config.Config{
+		PasswordMinLength:     8,
+		PasswordMaxLength:     72,
+		BcryptCost:            bcrypt.MinCost,
+		BreachedPasswordsFile: path,
+	})
+	require.NoError(t, err)
+	require.Error(t, policy.Validate("123456789"))
+	require.Error(t, policy.Validate("QWERTYUIOP"))
+	require.NoError(t, policy.Validate("# top passwords"))
+
+	_, err = passwords.LoadPolicy(&config.Config{BreachedPasswordsFile: filepath.Join(t.TempDir(), "missing")})
+	require.Error(t, err)
+}
@@ -0,0 +1,152 @@
+// Package ratelimit implements token bucket rate limiting, in memory for a
+// single replica or in Postgres for buckets shared between replicas.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"asyncapi/store"
+)
+
+// Limit is a token bucket: Burst requests can be made at once, and tokens are
+// refilled at PerMinute a minute up to Burst.
+type Limit struct {
+	PerMinute int
+	Burst     int
+}
+
+// Enabled reports whether requests are limited at all.
+func (l Limit) Enabled() bool {
+	return l.PerMinute > 0 && l.Burst > 0
+}
+
+func (l Limit) perSecond() float64 {
+	return float64(l.PerMinute) / 60
+}
+
+// Window returns how long an empty bucket takes to refill completely.
+func (l Limit) Window() time.Duration {
+	return l.timeFor(float64(l.Burst))
+}
+
+// result builds the result of a request from the tokens left in the bucket.
+func (l Limit) result(allowed bool, tokens float64) Result {
+	result := Result{
+		Allowed:   allowed,
+		Limit:     l.Burst,
+		Remaining: max(int(math.Floor(tokens)), 0),
+		Reset:     l.timeFor(float64(l.Burst) - tokens),
+	}
+	if !allowed {
+		result.RetryAfter = l.timeFor(1 - tokens)
+	}
+	return result
+}
+
+// timeFor returns how long refilling the tokens takes.
+func (l Limit) timeFor(tokens float64) time.Duration {
+	if tokens <= 0 {
+		return 0
+	}
+	return time.Duration(tokens / l.perSecond() * float64(time.Second))
+}
+
+// Result is the outcome of taking a token.
+type Result struct {
+	Allowed bool
+	// Limit is the size of the bucket and Remaining the requests that can be
+	// made right away.
+	Limit     int
+	Remaining int
+	// Reset is the time until the bucket is full again, RetryAfter the time
+	// until the next request is allowed when this one was not.
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Limiter takes a token from the bucket of a key.
+type Limiter interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+	//fullAt is when the bucket is full again, it can be dropped from then on
+	fullAt time.Time
+}
+
+// Memory keeps the buckets in memory, each replica limits on its own.
+type Memory struct {
+	now func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// NewMemory creates an in-memory Limiter.
+func NewMemory() *Memory {
+	return &Memory{now: time.Now, buckets: make(map[string]*bucket)}
+}
+
+// sweepInterval is how often buckets that refilled completely are dropped.
+const sweepInterval = time.Minute
+
+func (m *Memory) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if now.Sub(m.lastSweep) > sweepInterval {
+		m.sweep(now)
+	}
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updatedAt: now}
+		m.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.updatedAt).Seconds()*limit.perSecond())
+	b.updatedAt = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	result := limit.result(allowed, b.tokens)
+	b.fullAt = now.Add(result.Reset)
+	return result, nil
+}
+
+// sweep drops the buckets that are full again, which is the same as not
+// having a bucket.
+func (m *Memory) sweep(now time.Time) {
+	m.lastSweep = now
+	for key, b := range m.buckets {
+		if !now.Before(b.fullAt) {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+// Postgres keeps the buckets in Postgres, so all replicas share them.
+type Postgres struct {
+	store *store.RateLimitStore
+}
+
+// NewPostgres creates a Limiter backed by the store.
+func NewPostgres(store *store.RateLimitStore) *Postgres {
+	return &Postgres{store: store}
+}
+
+func (p *Postgres) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	tokens, allowed, err := p.store.Take(ctx, key, limit.perSecond(), limit.Burst)
+	if err != nil {
+		return Result{}, err
+	}
+	return limit.result(allowed, tokens), nil
+}
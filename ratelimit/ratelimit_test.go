@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemory_Take(t *testing.T) {
+	now := time.Now()
+	limiter := NewMemory()
+	limiter.now = func() time.Time { return now }
+	limit := Limit{PerMinute: 60, Burst: 2}
+
+	for i := range 2 {
+		result, err := limiter.Take(context.Background(), "key", limit)
+		require.NoError(t, err)
+		require.True(t, result.Allowed)
+		require.Equal(t, 2, result.Limit)
+		require.Equal(t, 1-i, result.Remaining)
+	}
+
+	result, err := limiter.Take(context.Background(), "key", limit)
+	require.NoError(t, err)
+	require.False(t, result.Allowed)
+	require.Equal(t, 0, result.Remaining)
+	require.Equal(t, time.Second, result.RetryAfter)
+	require.Equal(t, 2*time.Second, result.Reset)
+
+	//other keys have their own bucket
+	result, err = limiter.Take(context.Background(), "other", limit)
+	require.NoError(t, err)
+	require.True(t, result.Allowed)
+
+	//a token is refilled every second
+	now = now.Add(1500 * time.Millisecond)
+	result, err = limiter.Take(context.Background(), "key", limit)
+	require.NoError(t, err)
+	require.True(t, result.Allowed)
+	result, err = limiter.Take(context.Background(), "key", limit)
+	require.NoError(t, err)
+	require.False(t, result.Allowed)
+	require.Equal(t, 500*time.Millisecond, result.RetryAfter)
+}
+
+func TestMemory_Sweep(t *testing.T) {
+	now := time.Now()
+	limiter := NewMemory()
+	limiter.now = func() time.Time { return now }
+	limit := Limit{PerMinute: 60, Burst: 10}
+
+	_, err := limiter.Take(context.Background(), "idle", limit)
+	require.NoError(t, err)
+	now = now.Add(2 * time.Minute)
+	_, err = limiter.Take(context.Background(), "active", limit)
+	require.NoError(t, err)
+
+	require.NotContains(t, limiter.buckets, "idle")
+	require.Contains(t, limiter.buckets, "active")
+}
+
+func TestLimit(t *testing.T) {
+	require.False(t, Limit{}.Enabled())
+	require.False(t, Limit{PerMinute: 10}.Enabled())
+	require.True(t, Limit{PerMinute: 10, Burst: 5}.Enabled())
+	require.Equal(t, 30*time.Second, Limit{PerMinute: 10, Burst: 5}.Window())
+}
@@ -0,0 +1,163 @@
+package reports
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"asyncapi/jsonschema"
+	"asyncapi/messages"
+)
+
+// Messages of the reports queue. The API server sends MessageGenerateReport
+// for every report it creates, MessageGenerateReportLegacy is the body it sent
+// before messages had an envelope and is still accepted by the worker.
+const (
+	MessageGenerateReport       = "generateReportV2"
+	MessageGenerateReportLegacy = "generateReportV1"
+)
+
+// generateReportEnvelope documents the envelope of MessageGenerateReport with
+// its payload.
+type generateReportEnvelope struct {
+	messages.Envelope
+	Payload messages.GenerateReport `json:"payload"`
+}
+
+// AsyncApiDocument is an AsyncAPI 3.0 document, with only the fields the
+// generator fills in.
+type AsyncApiDocument struct {
+	AsyncApi   string                        `json:"asyncapi"`
+	Info       AsyncApiInfo                  `json:"info"`
+	Channels   map[string]*AsyncApiChannel   `json:"channels"`
+	Operations map[string]*AsyncApiOperation `json:"operations"`
+	Components AsyncApiComponents            `json:"components"`
+}
+
+type AsyncApiInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type AsyncApiRef struct {
+	Ref string `json:"$ref"`
+}
+
+type AsyncApiChannel struct {
+	Address     string                 `json:"address"`
+	Description string                 `json:"description,omitempty"`
+	Messages    map[string]AsyncApiRef `json:"messages"`
+}
+
+type AsyncApiOperation struct {
+	Action   string        `json:"action"`
+	Channel  AsyncApiRef   `json:"channel"`
+	Summary  string        `json:"summary,omitempty"`
+	Messages []AsyncApiRef `json:"messages"`
+}
+
+type AsyncApiComponents struct {
+	Messages map[string]*AsyncApiMessage   `json:"messages"`
+	Schemas  map[string]*jsonschema.Schema `json:"schemas"`
+}
+
+type AsyncApiMessage struct {
+	Name        string             `json:"name"`
+	Title       string             `json:"title,omitempty"`
+	Summary     string             `json:"summary,omitempty"`
+	ContentType string             `json:"contentType"`
+	Headers     *jsonschema.Schema `json:"headers,omitempty"`
+	Payload     *jsonschema.Schema `json:"payload"`
+}
+
+// NewAsyncApiDocument describes the messages exchanged by the API server and
+// the worker on the reports queue.
+func NewAsyncApiDocument(queue string) *AsyncApiDocument {
+	g := jsonschema.NewGenerator("reports")
+	//the trace context also travels in the message attributes, see
+	//tracing.InjectSqs, legacy messages only carry it there
+	traceHeaders := &jsonschema.Schema{Type: "object", Properties: map[string]*jsonschema.Schema{
+		"traceparent": {Type: "string", Description: "W3C trace context of the sender."},
+		"tracestate":  {Type: "string"},
+		"baggage":     {Type: "string"},
+	}}
+
+	return &AsyncApiDocument{
+		AsyncApi: "3.0.0",
+		Info: AsyncApiInfo{
+			Title:   "asyncapi reports",
+			Version: messages.Version + ".0",
+			Description: "The API server asks the worker to build reports through an SQS queue. " +
+				"Report status changes (requested, processing, completed, failed) are stored, not published: " +
+				"clients poll GET /reports/{id}. " +
+				"Messages are wrapped in a versioned envelope: minor versions only add optional fields, " +
+				"messages of a major version the worker doesn't support are moved to the dead letter queue.",
+		},
+		Channels: map[string]*AsyncApiChannel{
+			"reports": {
+				Address:     queue,
+				Description: "The SQS queue of the reports to build.",
+				Messages: map[string]AsyncApiRef{
+					MessageGenerateReport:       {Ref: "#/components/messages/" + MessageGenerateReport},
+					MessageGenerateReportLegacy: {Ref: "#/components/messages/" + MessageGenerateReportLegacy},
+				},
+			},
+		},
+		Operations: map[string]*AsyncApiOperation{
+			"enqueueReport": {
+				Action:   "send",
+				Channel:  AsyncApiRef{Ref: "#/channels/reports"},
+				Summary:  "The API server enqueues every report it creates.",
+				Messages: []AsyncApiRef{{Ref: "#/channels/reports/messages/" + MessageGenerateReport}},
+			},
+			"buildReport": {
+				Action:  "receive",
+				Channel: AsyncApiRef{Ref: "#/channels/reports"},
+				Summary: "The worker builds the report and uploads it to S3.",
+				Messages: []AsyncApiRef{
+					{Ref: "#/channels/reports/messages/" + MessageGenerateReport},
+					{Ref: "#/channels/reports/messages/" + MessageGenerateReportLegacy},
+				},
+			},
+		},
+		Components: AsyncApiComponents{
+			Messages: map[string]*AsyncApiMessage{
+				MessageGenerateReport: {
+					Name:        "GenerateReport",
+					Title:       "Generate report, version " + messages.Version,
+					Summary:     "Build the report of a user. The type of the envelope is " + messages.TypeGenerateReport + ".",
+					ContentType: "application/json",
+					Headers:     traceHeaders,
+					Payload:     g.Schema(reflect.TypeFor[generateReportEnvelope]()),
+				},
+				MessageGenerateReportLegacy: {
+					Name:        "GenerateReport",
+					Title:       "Generate report, version " + messages.LegacyVersion,
+					Summary:     "Build the report of a user. Deprecated: the bare payload without an envelope.",
+					ContentType: "application/json",
+					Headers:     traceHeaders,
+					Payload:     g.Schema(reflect.TypeFor[messages.GenerateReport]()),
+				},
+			},
+			Schemas: g.Schemas,
+		},
+	}
+}
+
+// ValidateMessage checks the body of a message against the payload schema
+// of the named message.
+func (d *AsyncApiDocument) ValidateMessage(name string, body []byte) error {
+	message, ok := d.Components.Messages[name]
+	if !ok {
+		return fmt.Errorf("unknown message %s", name)
+	}
+	var value any
+	if err := json.Unmarshal(body, &value); err != nil {
+		return fmt.Errorf("failed to decode the %s message: %w", name, err)
+	}
+	if err := jsonschema.Validate(message.Payload, d.Components.Schemas, value); err != nil {
+		return fmt.Errorf("invalid %s message: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package reports_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"asyncapi/messages"
+	"asyncapi/reports"
+)
+
+func TestAsyncApiDocument(t *testing.T) {
+	doc := reports.NewAsyncApiDocument("reports-queue")
+	require.Equal(t, "3.0.0", doc.AsyncApi)
+	require.Equal(t, "reports-queue", doc.Channels["reports"].Address)
+
+	//every reference points at something in the document
+	for name, op := range doc.Operations {
+		require.Equal(t, "#/channels/reports", op.Channel.Ref, name)
+		for _, message := range op.Messages {
+			channelMessage := strings.TrimPrefix(message.Ref, "#/channels/reports/messages/")
+			require.Contains(t, doc.Channels["reports"].Messages, channelMessage, name)
+			require.Contains(t, doc.Components.Messages, channelMessage, name)
+		}
+	}
+	require.Equal(t, "#/components/schemas/MessagesGenerateReport", doc.Components.Messages[reports.MessageGenerateReportLegacy].Payload.Ref)
+	body, err := json.Marshal(doc)
+	require.NoError(t, err)
+	require.Contains(t, string(body), `"version":"`+messages.Version+`.0"`)
+}
+
+func TestAsyncApiDocument_ValidateMessage(t *testing.T) {
+	doc := reports.NewAsyncApiDocument("reports-queue")
+	payload := messages.GenerateReport{UserId: uuid.New(), ReportId: uuid.New()}
+
+	//what the API server sends and the worker decodes
+	body, err := messages.Marshal(context.Background(), messages.TypeGenerateReport, payload)
+	require.NoError(t, err)
+	require.NoError(t, doc.ValidateMessage(reports.MessageGenerateReport, body))
+	require.Error(t, doc.ValidateMessage(reports.MessageGenerateReportLegacy, body))
+
+	legacy, err := json.Marshal(payload)
+	require.NoError(t, err)
+	require.NoError(t, doc.ValidateMessage(reports.MessageGenerateReportLegacy, legacy))
+	require.Error(t, doc.ValidateMessage(reports.MessageGenerateReport, legacy))
+
+	for name, body := range map[string]string{
+		"missing report":  `{"user_id":"6f1f1f5e-8a35-4c6e-9d1c-1b2b3c4d5e6f"}`,
+		"invalid user id": `{"user_id":"42","report_id":"6f1f1f5e-8a35-4c6e-9d1c-1b2b3c4d5e6f"}`,
+		"not json":        `user_id=42`,
+	} {
+		require.Error(t, doc.ValidateMessage(reports.MessageGenerateReportLegacy, []byte(body)), name)
+	}
+	require.Error(t, doc.ValidateMessage("unknown", body))
+}
@@ -3,6 +3,7 @@ package reports
 import (
 	config "asyncapi/config"
 	"asyncapi/store"
+	"asyncapi/tracing"
 	"bytes"
 	"compress/gzip"
 	"context"
@@ -15,6 +16,9 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type ReportBuilder struct {
@@ -44,6 +48,12 @@ func NewReportBuilder(config *config.Config, reportStore *store.ReportStore, loz
 	}
 }
 
+// UserPrefix returns the S3 key prefix under which all reports of the user
+// are stored.
+func UserPrefix(userId uuid.UUID) string {
+	return fmt.Sprintf("/users/%s/", userId.String())
+}
+
 // Build generates a report for the given user and report ID.
 //
 // Parameters:
@@ -55,6 +65,18 @@ func NewReportBuilder(config *config.Config, reportStore *store.ReportStore, loz
 // - A pointer to the updated Report instance.
 // - An error if the operation fails.
 func (b *ReportBuilder) Build(ctx context.Context, userId uuid.UUID, reportId uuid.UUID) (report *store.Report, err error) {
+	ctx, span := tracing.Tracer("reports").Start(ctx, "reports.build", trace.WithAttributes(
+		attribute.String("report.id", reportId.String()),
+		attribute.String("user.id", userId.String()),
+	))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
 	// Fetch the report from the database
 	report, err = b.reportStore.GetByPrimaryKey(ctx, userId, reportId)
 	if err != nil {
@@ -95,6 +117,7 @@ func (b *ReportBuilder) Build(ctx context.Context, userId uuid.UUID, reportId uu
 	report.DownloadUrl = nil
 	report.DownloadUrlExpiresAt = nil
 	report.OutputFilePath = nil
+	report.OutputSizeBytes = nil
 
 	report, err = b.reportStore.Update(ctx, report)
 	if err != nil {
@@ -102,7 +125,7 @@ func (b *ReportBuilder) Build(ctx context.Context, userId uuid.UUID, reportId uu
 	}
 
 	// Fetch monsters data from LozClient
-	resp, err := b.lozClient.GetMonsters()
+	resp, err := b.lozClient.GetMonsters(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get monsters data from LozClient: %w", err)
 	}
@@ -158,7 +181,7 @@ func (b *ReportBuilder) Build(ctx context.Context, userId uuid.UUID, reportId uu
 	}
 
 	// Prepare the S3 path
-	key := fmt.Sprintf("/users/%s/%s.csv.gz", userId.String(), reportId.String())
+	key := fmt.Sprintf("%s%s.csv.gz", UserPrefix(userId), reportId.String())
 
 	// Upload the file to S3
 	_, err = b.s3Client.PutObject(ctx, &s3.PutObjectInput{
@@ -172,6 +195,7 @@ func (b *ReportBuilder) Build(ctx context.Context, userId uuid.UUID, reportId uu
 
 	// Update the report with the S3 path and completion timestamp
 	report.OutputFilePath = &key
+	report.OutputSizeBytes = aws.Int64(int64(buffer.Len()))
 	report.CompletedAt = aws.Time(time.Now())
 
 	report, err = b.reportStore.Update(ctx, report)
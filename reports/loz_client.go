@@ -1,6 +1,7 @@
 package reports
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -37,9 +38,9 @@ type MonsterResponse struct {
 	Monsters []Monster `json:"data"`
 }
 
-func (c *LozClient) GetMonsters() ([]Monster, error) {
+func (c *LozClient) GetMonsters(ctx context.Context) ([]Monster, error) {
 	url := fmt.Sprintf("%s/category/monsters", c.baseUrl)
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
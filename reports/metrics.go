@@ -0,0 +1,112 @@
+package reports
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// WorkerMetrics are the Prometheus metrics of the report worker, on their own
+// registry like the metrics of the API server.
+type WorkerMetrics struct {
+	registry      *prometheus.Registry
+	received      prometheus.Counter
+	processed     prometheus.Counter
+	failed        prometheus.Counter
+	deadLettered  prometheus.Counter
+	receiveErrors prometheus.Counter
+	inFlight      prometheus.Gauge
+	buildDuration *prometheus.HistogramVec
+
+	mu          sync.Mutex
+	reportTypes map[string]struct{}
+}
+
+// maxReportTypeLabels caps the report types tracked separately, report types
+// are chosen by clients and must not grow the number of series without bound.
+const maxReportTypeLabels = 50
+
+// NewWorkerMetrics creates the metrics of the worker, with the Go runtime and
+// process metrics.
+func NewWorkerMetrics() *WorkerMetrics {
+	m := &WorkerMetrics{
+		registry:    prometheus.NewRegistry(),
+		reportTypes: make(map[string]struct{}),
+		received: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "asyncapi", Subsystem: "worker", Name: "messages_received_total",
+			Help: "Messages received from the reports queue.",
+		}),
+		processed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "asyncapi", Subsystem: "worker", Name: "messages_processed_total",
+			Help: "Messages processed successfully and deleted from the queue.",
+		}),
+		failed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "asyncapi", Subsystem: "worker", Name: "messages_failed_total",
+			Help: "Messages that failed to process and are left for redelivery.",
+		}),
+		deadLettered: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "asyncapi", Subsystem: "worker", Name: "messages_dead_lettered_total",
+			Help: "Messages of an unsupported version or type, or with an invalid body, moved to the dead letter queue.",
+		}),
+		receiveErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "asyncapi", Subsystem: "worker", Name: "receive_errors_total",
+			Help: "Failed receives from the reports queue.",
+		}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "asyncapi", Subsystem: "worker", Name: "in_flight_messages",
+			Help: "Goroutines currently processing a message.",
+		}),
+		buildDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "asyncapi", Subsystem: "worker", Name: "build_duration_seconds",
+			Help:    "Report build duration by report type and outcome.",
+			Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+		}, []string{"report_type", "outcome"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.received,
+		m.processed,
+		m.failed,
+		m.deadLettered,
+		m.receiveErrors,
+		m.inFlight,
+		m.buildDuration,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *WorkerMetrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// reportTypeLabel returns the label of the report type, "other" once
+// maxReportTypeLabels types have been seen.
+func (m *WorkerMetrics) reportTypeLabel(reportType string) string {
+	if reportType == "" {
+		return "unknown"
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.reportTypes[reportType]; ok {
+		return reportType
+	}
+	if len(m.reportTypes) >= maxReportTypeLabels || len(reportType) > 64 {
+		return "other"
+	}
+	m.reportTypes[reportType] = struct{}{}
+	return reportType
+}
+
+// observeBuild records the duration of a report build.
+func (m *WorkerMetrics) observeBuild(reportType string, err error, seconds float64) {
+	outcome := "completed"
+	if err != nil {
+		outcome = "failed"
+	}
+	m.buildDuration.WithLabelValues(m.reportTypeLabel(reportType), outcome).Observe(seconds)
+}
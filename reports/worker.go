@@ -2,19 +2,32 @@ package reports
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
+	"net/http"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 
 	"asyncapi/config"
+	"asyncapi/health"
+	"asyncapi/messages"
+	"asyncapi/tracing"
 
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// errDeadLettered is returned for the messages moved to the dead letter queue,
+// they are deleted from the queue without counting as processed.
+var errDeadLettered = errors.New("message moved to the dead letter queue")
+
 type Worker struct {
 	config      *config.Config
 	builder     *ReportBuilder
@@ -22,9 +35,13 @@ type Worker struct {
 	sqsClient   *sqs.Client
 	channel     chan types.Message
 	concurrency int
+	metrics     *WorkerMetrics
+	health      *health.Checker
+	//deadLetterQueueUrl is nil when no dead letter queue is configured
+	deadLetterQueueUrl *string
 }
 
-func NewWorker(config *config.Config, logger *slog.Logger, sqsClient *sqs.Client, maxConcurrency int, builder *ReportBuilder) *Worker {
+func NewWorker(config *config.Config, logger *slog.Logger, sqsClient *sqs.Client, maxConcurrency int, builder *ReportBuilder, checker *health.Checker) *Worker {
 	return &Worker{
 		config:      config,
 		logger:      logger,
@@ -32,6 +49,31 @@ func NewWorker(config *config.Config, logger *slog.Logger, sqsClient *sqs.Client
 		concurrency: maxConcurrency,
 		builder:     builder,
 		sqsClient:   sqsClient,
+		metrics:     NewWorkerMetrics(),
+		health:      checker,
+	}
+}
+
+// serveHttp serves /metrics and the health probes on WorkerHttpAddr until the
+// context is done.
+func (w *Worker) serveHttp(ctx context.Context) {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", w.metrics.Handler())
+	w.health.Register(mux)
+	srv := &http.Server{
+		Addr:              w.config.WorkerHttpAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+	w.logger.Info("worker http listener started", "addr", srv.Addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		w.logger.Error("worker http listener failed", "error", err)
 	}
 }
 
@@ -43,7 +85,20 @@ func (w *Worker) Start(ctx context.Context) error {
 		return fmt.Errorf("failed to get url for queue %s: %w", w.config.SqsQueue, err)
 	}
 
+	if w.config.SqsDeadLetterQueue != "" {
+		dlqUrlOutput, err := w.sqsClient.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{
+			QueueName: aws.String(w.config.SqsDeadLetterQueue),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get url for queue %s: %w", w.config.SqsDeadLetterQueue, err)
+		}
+		w.deadLetterQueueUrl = dlqUrlOutput.QueueUrl
+	}
+
 	w.logger.Info("starting worker", "queue", w.config.SqsQueue, "queue_url", queueUrlOutput.QueueUrl)
+	if w.config.WorkerHttpAddr != "" {
+		go w.serveHttp(ctx)
+	}
 	for i := range w.concurrency {
 
 		go func(id int) {
@@ -54,9 +109,18 @@ func (w *Worker) Start(ctx context.Context) error {
 					w.logger.Error("worker stopped", "goroutine_id", id, "error", ctx.Err())
 					return
 				case message := <-w.channel:
-					if err := w.processMessage(ctx, message); err != nil {
+					w.metrics.inFlight.Inc()
+					err := w.processMessage(ctx, message)
+					w.metrics.inFlight.Dec()
+					switch {
+					case errors.Is(err, errDeadLettered):
+						//the copy in the dead letter queue is the one kept
+					case err != nil:
+						w.metrics.failed.Inc()
 						w.logger.Error("failed to process message", "error", err, "goroutine_id", id)
 						continue
+					default:
+						w.metrics.processed.Inc()
 					}
 					if _, err := w.sqsClient.DeleteMessage(ctx, &sqs.DeleteMessageInput{
 						QueueUrl:      queueUrlOutput.QueueUrl,
@@ -73,12 +137,15 @@ func (w *Worker) Start(ctx context.Context) error {
 		output, err := w.sqsClient.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
 			QueueUrl:            queueUrlOutput.QueueUrl,
 			MaxNumberOfMessages: int32(w.concurrency + 1),
+			//the trace context of the sender travels in the attributes
+			MessageAttributeNames: []string{"All"},
 		})
 		if err != nil {
 			w.logger.Error("failed to receive messages", "error", err)
 			if ctx.Err() != nil {
 				return ctx.Err()
 			}
+			w.metrics.receiveErrors.Inc()
 			continue
 		}
 
@@ -86,35 +153,113 @@ func (w *Worker) Start(ctx context.Context) error {
 			continue
 		}
 
+		w.metrics.received.Add(float64(len(output.Messages)))
 		for _, message := range output.Messages {
 			w.channel <- message
 		}
 	}
 }
 
-func (w *Worker) processMessage(ctx context.Context, message types.Message) error {
+func (w *Worker) processMessage(ctx context.Context, message types.Message) (err error) {
+	var envelope *messages.Envelope
+	var decodeErr error
+	if message.Body != nil && *message.Body != "" {
+		envelope, decodeErr = messages.Decode([]byte(*message.Body))
+	}
+	//legacy messages only carry the trace context in the attributes
+	ctx = tracing.ExtractSqs(ctx, message.MessageAttributes)
+	if envelope != nil {
+		ctx = envelope.Context(ctx)
+	}
+	ctx, span := tracing.Tracer("reports").Start(ctx, "reports.process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystemAWSSqs,
+			semconv.MessagingDestinationName(w.config.SqsQueue),
+			semconv.MessagingMessageID(aws.ToString(message.MessageId)),
+		),
+	)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
 	w.logger.Info("processing message", "message_id", *message.MessageId)
 
 	if message.Body == nil || *message.Body == "" {
-		w.logger.Warn("message body is empty", "message_id", *message.MessageId)
-		return nil
+		return w.deadLetter(ctx, message, errors.New("message body is empty"))
 	}
 
-	var msg SqsMessage
 	w.logger.Info("Received message body:", "message_body", *message.Body)
-	if err := json.Unmarshal([]byte(*message.Body), &msg); err != nil {
-		w.logger.Warn("message body is invalid", "message_id", *message.MessageId, "body", *message.Body)
-		return nil
+	if decodeErr != nil {
+		return w.deadLetter(ctx, message, decodeErr)
+	}
+	span.SetAttributes(attribute.String("message.type", envelope.Type), attribute.String("message.version", envelope.Version))
+
+	var msg messages.GenerateReport
+	if err := envelope.DecodePayload(&msg); err != nil {
+		return w.deadLetter(ctx, message, err)
 	}
-	w.logger.Info("Unmarshaled message: ", "unmarshalled message body", msg)
+	w.logger.Info("Unmarshaled message: ", "unmarshalled message body", msg, "version", envelope.Version)
 
 	builderCtx, builderCancel := context.WithTimeout(ctx, time.Second*10)
 	defer builderCancel()
 
-	_, err := w.builder.Build(builderCtx, msg.UserId, msg.ReportId)
+	start := time.Now()
+	report, err := w.builder.Build(builderCtx, msg.UserId, msg.ReportId)
+	reportType := ""
+	if report != nil {
+		reportType = report.ReportType
+	}
+	w.metrics.observeBuild(reportType, err, time.Since(start).Seconds())
 	if err != nil {
 		return fmt.Errorf("failed to build report for userID %v and reportid %v: %v", msg.UserId, msg.ReportId, err)
 	}
 
 	return nil
 }
+
+// deadLetter moves a message this worker can't handle, such as one of a newer
+// major version or with an invalid payload, to the dead letter queue with the
+// reason in its attributes, and returns errDeadLettered. Only then is the
+// report it asks for, if any, marked failed so it stops counting against the
+// quota of its user. Without a dead letter queue, or when the move fails, the
+// message is left for the redrive policy of the queue.
+func (w *Worker) deadLetter(ctx context.Context, message types.Message, reason error) error {
+	if w.deadLetterQueueUrl == nil {
+		return fmt.Errorf("message %s can't be processed and there is no dead letter queue: %w", aws.ToString(message.MessageId), reason)
+	}
+	attributes := maps.Clone(message.MessageAttributes)
+	if attributes == nil {
+		attributes = map[string]types.MessageAttributeValue{}
+	}
+	attributes["dead_letter_reason"] = types.MessageAttributeValue{
+		DataType:    aws.String("String"),
+		StringValue: aws.String(reason.Error()),
+	}
+	if _, err := w.sqsClient.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:          w.deadLetterQueueUrl,
+		MessageBody:       message.Body,
+		MessageAttributes: attributes,
+	}); err != nil {
+		return fmt.Errorf("failed to move message %s to the dead letter queue: %w", aws.ToString(message.MessageId), err)
+	}
+	w.metrics.deadLettered.Inc()
+	w.logger.Warn("moved message to the dead letter queue", "message_id", aws.ToString(message.MessageId), "reason", reason)
+	w.failReport(ctx, message)
+	return fmt.Errorf("%w: %w", errDeadLettered, reason)
+}
+
+// failReport marks the report of a message that can't be processed failed.
+func (w *Worker) failReport(ctx context.Context, message types.Message) {
+	reportId, ok := messages.ReportId([]byte(aws.ToString(message.Body)))
+	if !ok {
+		return
+	}
+	if _, err := w.builder.reportStore.MarkFailed(ctx, reportId, "the report request could not be processed"); err != nil {
+		w.logger.Error("failed to mark the report of a dead letter failed", "message_id", aws.ToString(message.MessageId), "report_id", reportId, "error", err)
+	}
+}
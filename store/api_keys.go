@@ -0,0 +1,135 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// apiKeyPrefix starts every key so they are easy to recognise, e.g. by secret scanners.
+const apiKeyPrefix = "ak_"
+
+// ErrApiKeyInactive is returned when authenticating with a revoked or expired key.
+var ErrApiKeyInactive = errors.New("api key is revoked or expired")
+
+// ApiKeyStore persists personal API keys. A key has the form
+// ak_<prefix>_<secret>; the prefix is stored in clear for lookup and the
+// whole key is stored hashed.
+type ApiKeyStore struct {
+	db *sqlx.DB
+}
+
+type ApiKey struct {
+	Id           uuid.UUID      `db:"id"`
+	UserId       uuid.UUID      `db:"user_id"`
+	Name         string         `db:"name"`
+	Prefix       string         `db:"prefix"`
+	HashedSecret string         `db:"hashed_secret"`
+	Scopes       pq.StringArray `db:"scopes"`
+	ExpiresAt    *time.Time     `db:"expires_at"`
+	LastUsedAt   *time.Time     `db:"last_used_at"`
+	RevokedAt    *time.Time     `db:"revoked_at"`
+	CreatedAt    time.Time      `db:"created_at"`
+}
+
+// IsActive reports whether the key is neither revoked nor expired.
+func (k *ApiKey) IsActive() bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || k.ExpiresAt.After(time.Now()))
+}
+
+func NewApiKeyStore(db *sql.DB) *ApiKeyStore {
+	return &ApiKeyStore{
+		db: sqlx.NewDb(db, "postgres"),
+	}
+}
+
+// Create issues a new key for the user and returns it in clear together with
+// its record. The clear key can't be recovered afterwards.
+func (s *ApiKeyStore) Create(ctx context.Context, userId uuid.UUID, name string, scopes []string, expiresAt *time.Time) (string, *ApiKey, error) {
+	const insert = `INSERT INTO api_keys (user_id, name, prefix, hashed_secret, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING *;`
+
+	prefixBytes := make([]byte, 6)
+	if _, err := rand.Read(prefixBytes); err != nil {
+		return "", nil, fmt.Errorf("failed to generate api key prefix: %w", err)
+	}
+	prefix := hex.EncodeToString(prefixBytes)
+	secret, err := newOpaqueToken()
+	if err != nil {
+		return "", nil, err
+	}
+	raw := apiKeyPrefix + prefix + "_" + secret
+
+	if scopes == nil {
+		scopes = []string{}
+	}
+	var key ApiKey
+	if err := s.db.GetContext(ctx, &key, insert, userId, name, prefix, hashToken(raw), pq.StringArray(scopes), expiresAt); err != nil {
+		return "", nil, fmt.Errorf("failed to insert api key for user %s: %w", userId, err)
+	}
+	return raw, &key, nil
+}
+
+// ListByUser returns all keys of the user, newest first, including revoked
+// and expired ones.
+func (s *ApiKeyStore) ListByUser(ctx context.Context, userId uuid.UUID) ([]ApiKey, error) {
+	const query = `SELECT * FROM api_keys WHERE user_id = $1 ORDER BY created_at DESC;`
+	keys := []ApiKey{}
+	if err := s.db.SelectContext(ctx, &keys, query, userId); err != nil {
+		return nil, fmt.Errorf("failed to list api keys of user %s: %w", userId, err)
+	}
+	return keys, nil
+}
+
+// Revoke revokes the key of the user. It returns an error wrapping
+// sql.ErrNoRows if the user has no such active key.
+func (s *ApiKeyStore) Revoke(ctx context.Context, userId uuid.UUID, id uuid.UUID) (*ApiKey, error) {
+	const query = `UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND id = $2 AND revoked_at IS NULL RETURNING *;`
+	var key ApiKey
+	if err := s.db.GetContext(ctx, &key, query, userId, id); err != nil {
+		return nil, fmt.Errorf("failed to revoke api key %s of user %s: %w", id, userId, err)
+	}
+	return &key, nil
+}
+
+// Authenticate looks up the key given in clear and records that it was used.
+// It returns an error wrapping sql.ErrNoRows for unknown keys and
+// ErrApiKeyInactive for revoked or expired ones.
+func (s *ApiKeyStore) Authenticate(ctx context.Context, raw string) (*ApiKey, error) {
+	const query = `SELECT * FROM api_keys WHERE prefix = $1;`
+	// last_used_at is only written once a minute to keep busy keys from
+	// turning every request into a write
+	const touch = `UPDATE api_keys SET last_used_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < CURRENT_TIMESTAMP - INTERVAL '1 minute');`
+
+	prefix, _, ok := strings.Cut(strings.TrimPrefix(raw, apiKeyPrefix), "_")
+	if !ok || !strings.HasPrefix(raw, apiKeyPrefix) {
+		return nil, fmt.Errorf("malformed api key: %w", sql.ErrNoRows)
+	}
+
+	var key ApiKey
+	if err := s.db.GetContext(ctx, &key, query, prefix); err != nil {
+		return nil, fmt.Errorf("failed to fetch api key %s: %w", prefix, err)
+	}
+	if subtle.ConstantTimeCompare([]byte(key.HashedSecret), []byte(hashToken(raw))) != 1 {
+		return nil, fmt.Errorf("api key %s does not match: %w", prefix, sql.ErrNoRows)
+	}
+	if !key.IsActive() {
+		return nil, ErrApiKeyInactive
+	}
+	if _, err := s.db.ExecContext(ctx, touch, key.Id); err != nil {
+		return nil, fmt.Errorf("failed to update last use of api key %s: %w", prefix, err)
+	}
+	return &key, nil
+}
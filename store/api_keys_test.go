@@ -0,0 +1,62 @@
+package store_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"asyncapi/fixtures"
+	"asyncapi/store"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApiKeyStore(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() {
+		cleanup(t)
+	})
+
+	ctx := context.Background()
+	userStore := store.NewUserStore(env.Db, env.Passwords, env.TotpCipher)
+	user, err := userStore.CreateUser(ctx, "test@test.com", "testpassword")
+	require.NoError(t, err)
+
+	keyStore := store.NewApiKeyStore(env.Db)
+	raw, key, err := keyStore.Create(ctx, user.Id, "ci", []string{"reports:read"}, nil)
+	require.NoError(t, err)
+	require.Equal(t, user.Id, key.UserId)
+	require.Contains(t, raw, key.Prefix)
+	require.NotContains(t, key.HashedSecret, raw)
+	require.Nil(t, key.LastUsedAt)
+
+	authenticated, err := keyStore.Authenticate(ctx, raw)
+	require.NoError(t, err)
+	require.Equal(t, key.Id, authenticated.Id)
+	require.Equal(t, []string{"reports:read"}, []string(authenticated.Scopes))
+
+	_, err = keyStore.Authenticate(ctx, raw+"x")
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = keyStore.Authenticate(ctx, "not a key")
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	keys, err := keyStore.ListByUser(ctx, user.Id)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	require.NotNil(t, keys[0].LastUsedAt)
+
+	_, err = keyStore.Revoke(ctx, user.Id, key.Id)
+	require.NoError(t, err)
+	_, err = keyStore.Authenticate(ctx, raw)
+	require.ErrorIs(t, err, store.ErrApiKeyInactive)
+	_, err = keyStore.Revoke(ctx, user.Id, key.Id)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	expiresAt := time.Now().Add(-time.Minute)
+	expiredRaw, _, err := keyStore.Create(ctx, user.Id, "expired", nil, &expiresAt)
+	require.NoError(t, err)
+	_, err = keyStore.Authenticate(ctx, expiredRaw)
+	require.ErrorIs(t, err, store.ErrApiKeyInactive)
+}
@@ -8,6 +8,9 @@ import (
 
 	"asyncapi/config"
 
+	"github.com/XSAM/otelsql"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+
 	_ "github.com/lib/pq" // PostgreSQL driver
 	// Import the PostgreSQL driver
 	// to register it with the database/sql package
@@ -22,8 +25,11 @@ import (
 func NewPostgresDb(conf *config.Config) (*sql.DB, error) {
 	// Create a connection string using the configuration
 	dsn := conf.DatabaseUrl()
-	// Open a new database connection
-	db, err := sql.Open("postgres", dsn)
+	// Open a new database connection, every query gets a span
+	db, err := otelsql.Open("postgres", dsn,
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{OmitConnResetSession: true, OmitRows: true}),
+	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database connection: %w", err)
 	}
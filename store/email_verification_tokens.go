@@ -0,0 +1,43 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+// EmailVerificationTokenStore persists single-use tokens sent to a user to
+// prove they own their email address.
+type EmailVerificationTokenStore struct {
+	db *sqlx.DB
+}
+
+type EmailVerificationToken struct {
+	UserId      uuid.UUID  `db:"user_id"`
+	HashedToken string     `db:"hashed_token"`
+	CreatedAt   time.Time  `db:"created_at"`
+	ExpiresAt   time.Time  `db:"expires_at"`
+	UsedAt      *time.Time `db:"used_at"`
+}
+
+func NewEmailVerificationTokenStore(db *sql.DB) *EmailVerificationTokenStore {
+	return &EmailVerificationTokenStore{
+		db: sqlx.NewDb(db, "postgres"),
+	}
+}
+
+// Create issues a new verification token for the user valid for ttl,
+// replacing any token issued before. It returns the raw token.
+func (s *EmailVerificationTokenStore) Create(ctx context.Context, userId uuid.UUID, ttl time.Duration) (string, *EmailVerificationToken, error) {
+	return createSingleUseToken[EmailVerificationToken](ctx, s.db, "email_verification_tokens", userId, ttl)
+}
+
+// Consume marks the token as used and returns it. It returns an error
+// wrapping sql.ErrNoRows if the token is unknown, expired or already used.
+func (s *EmailVerificationTokenStore) Consume(ctx context.Context, raw string) (*EmailVerificationToken, error) {
+	return consumeSingleUseToken[EmailVerificationToken](ctx, s.db, "email_verification_tokens", raw)
+}
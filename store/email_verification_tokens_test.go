@@ -0,0 +1,47 @@
+package store_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"asyncapi/fixtures"
+	"asyncapi/store"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmailVerificationTokenStore(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() {
+		cleanup(t)
+	})
+
+	ctx := context.Background()
+	userStore := store.NewUserStore(env.Db, env.Passwords, env.TotpCipher)
+	user, err := userStore.CreateUser(ctx, "test@test.com", "test")
+	require.NoError(t, err)
+	require.Nil(t, user.VerifiedAt)
+
+	verificationStore := store.NewEmailVerificationTokenStore(env.Db)
+	raw, _, err := verificationStore.Create(ctx, user.Id, time.Minute)
+	require.NoError(t, err)
+
+	token, err := verificationStore.Consume(ctx, raw)
+	require.NoError(t, err)
+	require.Equal(t, user.Id, token.UserId)
+
+	_, err = verificationStore.Consume(ctx, raw)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	verified, err := userStore.MarkVerified(ctx, user.Id)
+	require.NoError(t, err)
+	require.NotNil(t, verified.VerifiedAt)
+
+	//verifying twice keeps the first timestamp
+	again, err := userStore.MarkVerified(ctx, user.Id)
+	require.NoError(t, err)
+	require.Equal(t, verified.VerifiedAt.UnixNano(), again.VerifiedAt.UnixNano())
+}
@@ -0,0 +1,112 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// oauthClientPrefix starts every client ID.
+const oauthClientPrefix = "oc_"
+
+// ErrOAuthClientRevoked is returned when authenticating a revoked client.
+var ErrOAuthClientRevoked = errors.New("oauth client is revoked")
+
+// OAuthClientStore persists the OAuth clients allowed to use the
+// client_credentials grant. Each client acts on behalf of its owner, who owns
+// the reports the client creates.
+type OAuthClientStore struct {
+	db *sqlx.DB
+}
+
+type OAuthClient struct {
+	Id           string         `db:"id"`
+	Name         string         `db:"name"`
+	OwnerId      uuid.UUID      `db:"owner_id"`
+	HashedSecret string         `db:"hashed_secret"`
+	Scopes       pq.StringArray `db:"scopes"`
+	RevokedAt    *time.Time     `db:"revoked_at"`
+	CreatedAt    time.Time      `db:"created_at"`
+}
+
+func NewOAuthClientStore(db *sql.DB) *OAuthClientStore {
+	return &OAuthClientStore{
+		db: sqlx.NewDb(db, "postgres"),
+	}
+}
+
+// Create registers a new client and returns its secret in clear together with
+// its record. The secret can't be recovered afterwards.
+func (s *OAuthClientStore) Create(ctx context.Context, name string, ownerId uuid.UUID, scopes []string) (string, *OAuthClient, error) {
+	const insert = `INSERT INTO oauth_clients (id, name, owner_id, hashed_secret, scopes)
+		VALUES ($1, $2, $3, $4, $5) RETURNING *;`
+
+	idBytes := make([]byte, 12)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", nil, fmt.Errorf("failed to generate oauth client id: %w", err)
+	}
+	id := oauthClientPrefix + hex.EncodeToString(idBytes)
+	secret, err := newOpaqueToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	if scopes == nil {
+		scopes = []string{}
+	}
+	var client OAuthClient
+	if err := s.db.GetContext(ctx, &client, insert, id, name, ownerId, hashToken(secret), pq.StringArray(scopes)); err != nil {
+		return "", nil, fmt.Errorf("failed to insert oauth client %s: %w", name, err)
+	}
+	return secret, &client, nil
+}
+
+// Get returns the client with the ID, or an error wrapping sql.ErrNoRows.
+func (s *OAuthClientStore) Get(ctx context.Context, id string) (*OAuthClient, error) {
+	const query = `SELECT * FROM oauth_clients WHERE id = $1;`
+	var client OAuthClient
+	if err := s.db.GetContext(ctx, &client, query, id); err != nil {
+		return nil, fmt.Errorf("failed to get oauth client %s: %w", id, err)
+	}
+	return &client, nil
+}
+
+// Authenticate checks the client credentials. It returns an error wrapping
+// sql.ErrNoRows for unknown clients or wrong secrets and
+// ErrOAuthClientRevoked for revoked clients.
+func (s *OAuthClientStore) Authenticate(ctx context.Context, id, secret string) (*OAuthClient, error) {
+	client, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(client.HashedSecret), []byte(hashToken(secret))) != 1 {
+		return nil, fmt.Errorf("oauth client %s secret does not match: %w", id, sql.ErrNoRows)
+	}
+	if client.RevokedAt != nil {
+		return nil, ErrOAuthClientRevoked
+	}
+	return client, nil
+}
+
+// Revoke revokes the client; tokens already issued to it stop being accepted.
+// It returns an error wrapping sql.ErrNoRows if there is no such active client.
+func (s *OAuthClientStore) Revoke(ctx context.Context, id string) error {
+	const dml = `UPDATE oauth_clients SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND revoked_at IS NULL;`
+	result, err := s.db.ExecContext(ctx, dml, id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke oauth client %s: %w", id, err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("oauth client not found: %w", sql.ErrNoRows)
+	}
+	return nil
+}
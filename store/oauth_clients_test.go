@@ -0,0 +1,46 @@
+package store_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"asyncapi/fixtures"
+	"asyncapi/store"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOAuthClientStore(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() {
+		cleanup(t)
+	})
+
+	ctx := context.Background()
+	userStore := store.NewUserStore(env.Db, env.Passwords, env.TotpCipher)
+	clientStore := store.NewOAuthClientStore(env.Db)
+	owner, err := userStore.CreateUser(ctx, "test@test.com", "testpassword")
+	require.NoError(t, err)
+
+	secret, client, err := clientStore.Create(ctx, "billing", owner.Id, []string{"reports:write"})
+	require.NoError(t, err)
+	require.NotEmpty(t, secret)
+	require.Equal(t, owner.Id, client.OwnerId)
+	require.Equal(t, []string{"reports:write"}, []string(client.Scopes))
+
+	authenticated, err := clientStore.Authenticate(ctx, client.Id, secret)
+	require.NoError(t, err)
+	require.Equal(t, client.Id, authenticated.Id)
+
+	_, err = clientStore.Authenticate(ctx, client.Id, "wrong")
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = clientStore.Authenticate(ctx, "oc_unknown", secret)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	require.NoError(t, clientStore.Revoke(ctx, client.Id))
+	_, err = clientStore.Authenticate(ctx, client.Id, secret)
+	require.ErrorIs(t, err, store.ErrOAuthClientRevoked)
+	require.ErrorIs(t, clientStore.Revoke(ctx, client.Id), sql.ErrNoRows)
+}
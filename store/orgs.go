@@ -0,0 +1,208 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// OrgRoleAdmin members can manage the memberships of the organization.
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+// ErrLastOrgAdmin is returned when a change would leave an organization
+// without an admin.
+var ErrLastOrgAdmin = errors.New("an organization needs at least one admin")
+
+// OrgStore persists organizations and their memberships. Members of an
+// organization can read the reports created in it by any other member.
+type OrgStore struct {
+	db *sqlx.DB
+}
+
+type Organization struct {
+	Id        uuid.UUID `db:"id"`
+	Name      string    `db:"name"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+type Membership struct {
+	OrgId     uuid.UUID `db:"org_id"`
+	UserId    uuid.UUID `db:"user_id"`
+	Role      string    `db:"role"`
+	CreatedAt time.Time `db:"created_at"`
+	// Email of the member, only filled by ListMembers.
+	Email string `db:"email"`
+}
+
+// UserOrganization is an organization seen by one of its members.
+type UserOrganization struct {
+	Organization
+	Role string `db:"role"`
+}
+
+func NewOrgStore(db *sql.DB) *OrgStore {
+	return &OrgStore{
+		db: sqlx.NewDb(db, "postgres"),
+	}
+}
+
+func validOrgRole(role string) error {
+	if role != OrgRoleAdmin && role != OrgRoleMember {
+		return fmt.Errorf("unknown organization role %q", role)
+	}
+	return nil
+}
+
+// Create creates an organization with the user as its first admin.
+func (s *OrgStore) Create(ctx context.Context, name string, ownerId uuid.UUID) (*Organization, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var org Organization
+	if err := tx.GetContext(ctx, &org, `INSERT INTO organizations (name) VALUES ($1) RETURNING *;`, name); err != nil {
+		return nil, fmt.Errorf("failed to insert organization: %w", err)
+	}
+	const membership = `INSERT INTO org_memberships (org_id, user_id, role) VALUES ($1, $2, $3);`
+	if _, err := tx.ExecContext(ctx, membership, org.Id, ownerId, OrgRoleAdmin); err != nil {
+		return nil, fmt.Errorf("failed to add owner to organization %s: %w", org.Id, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit organization: %w", err)
+	}
+	return &org, nil
+}
+
+// ListForUser returns the organizations the user is a member of.
+func (s *OrgStore) ListForUser(ctx context.Context, userId uuid.UUID) ([]UserOrganization, error) {
+	const query = `SELECT o.id, o.name, o.created_at, m.role FROM organizations o
+		JOIN org_memberships m ON m.org_id = o.id
+		WHERE m.user_id = $1 ORDER BY o.name;`
+	orgs := []UserOrganization{}
+	if err := s.db.SelectContext(ctx, &orgs, query, userId); err != nil {
+		return nil, fmt.Errorf("failed to list organizations of user %s: %w", userId, err)
+	}
+	return orgs, nil
+}
+
+// GetMembership returns the membership of the user in the organization, or
+// an error wrapping sql.ErrNoRows if the user is not a member.
+func (s *OrgStore) GetMembership(ctx context.Context, orgId, userId uuid.UUID) (*Membership, error) {
+	const query = `SELECT org_id, user_id, role, created_at FROM org_memberships WHERE org_id = $1 AND user_id = $2;`
+	var membership Membership
+	if err := s.db.GetContext(ctx, &membership, query, orgId, userId); err != nil {
+		return nil, fmt.Errorf("failed to get membership of user %s in organization %s: %w", userId, orgId, err)
+	}
+	return &membership, nil
+}
+
+// ListMembers returns the memberships of the organization with the email of
+// each member.
+func (s *OrgStore) ListMembers(ctx context.Context, orgId uuid.UUID) ([]Membership, error) {
+	const query = `SELECT m.org_id, m.user_id, m.role, m.created_at, u.email FROM org_memberships m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.org_id = $1 ORDER BY u.email;`
+	members := []Membership{}
+	if err := s.db.SelectContext(ctx, &members, query, orgId); err != nil {
+		return nil, fmt.Errorf("failed to list members of organization %s: %w", orgId, err)
+	}
+	return members, nil
+}
+
+// AddMember adds the user to the organization, or changes their role if they
+// already are a member. It returns an error wrapping ErrLastOrgAdmin instead
+// of demoting the last admin.
+func (s *OrgStore) AddMember(ctx context.Context, orgId, userId uuid.UUID, role string) (*Membership, error) {
+	if err := validOrgRole(role); err != nil {
+		return nil, err
+	}
+	const upsert = `INSERT INTO org_memberships (org_id, user_id, role) VALUES ($1, $2, $3)
+		ON CONFLICT (org_id, user_id) DO UPDATE SET role = EXCLUDED.role
+		RETURNING org_id, user_id, role, created_at;`
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if role != OrgRoleAdmin {
+		if err := keepAnAdmin(ctx, tx, orgId, userId); err != nil {
+			return nil, err
+		}
+	}
+	var membership Membership
+	if err := tx.GetContext(ctx, &membership, upsert, orgId, userId, role); err != nil {
+		return nil, fmt.Errorf("failed to add user %s to organization %s: %w", userId, orgId, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit membership: %w", err)
+	}
+	return &membership, nil
+}
+
+// RemoveMember removes the user from the organization. Reports they created
+// in it stay visible to the remaining members. It returns an error wrapping
+// ErrLastOrgAdmin instead of removing the last admin.
+func (s *OrgStore) RemoveMember(ctx context.Context, orgId, userId uuid.UUID) error {
+	const dml = `DELETE FROM org_memberships WHERE org_id = $1 AND user_id = $2;`
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := keepAnAdmin(ctx, tx, orgId, userId); err != nil {
+		return err
+	}
+	result, err := tx.ExecContext(ctx, dml, orgId, userId)
+	if err != nil {
+		return fmt.Errorf("failed to remove user %s from organization %s: %w", userId, orgId, err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("membership not found: %w", sql.ErrNoRows)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit membership removal: %w", err)
+	}
+	return nil
+}
+
+// keepAnAdmin returns an error wrapping ErrLastOrgAdmin if the user is the
+// only admin of the organization, which they must stay. It locks the
+// organization until the transaction ends, so two admins demoting each other
+// at the same time cannot both succeed.
+func keepAnAdmin(ctx context.Context, tx *sqlx.Tx, orgId, userId uuid.UUID) error {
+	const lock = `SELECT id FROM organizations WHERE id = $1 FOR UPDATE;`
+	const query = `SELECT
+			COALESCE(bool_or(user_id = $2), false) AS is_admin,
+			COALESCE(bool_or(user_id <> $2), false) AS other_admin
+		FROM org_memberships WHERE org_id = $1 AND role = $3;`
+
+	var id uuid.UUID
+	if err := tx.GetContext(ctx, &id, lock, orgId); err != nil {
+		return fmt.Errorf("failed to lock organization %s: %w", orgId, err)
+	}
+	var admins struct {
+		IsAdmin    bool `db:"is_admin"`
+		OtherAdmin bool `db:"other_admin"`
+	}
+	if err := tx.GetContext(ctx, &admins, query, orgId, userId, OrgRoleAdmin); err != nil {
+		return fmt.Errorf("failed to count admins of organization %s: %w", orgId, err)
+	}
+	if admins.IsAdmin && !admins.OtherAdmin {
+		return fmt.Errorf("user %s is the last admin of organization %s: %w", userId, orgId, ErrLastOrgAdmin)
+	}
+	return nil
+}
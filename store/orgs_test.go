@@ -0,0 +1,146 @@
+package store_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"asyncapi/fixtures"
+	"asyncapi/store"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrgStore(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() {
+		cleanup(t)
+	})
+
+	ctx := context.Background()
+	userStore := store.NewUserStore(env.Db, env.Passwords, env.TotpCipher)
+	orgStore := store.NewOrgStore(env.Db)
+	owner, err := userStore.CreateUser(ctx, "owner@test.com", "testpassword")
+	require.NoError(t, err)
+	colleague, err := userStore.CreateUser(ctx, "colleague@test.com", "testpassword")
+	require.NoError(t, err)
+
+	org, err := orgStore.Create(ctx, "team", owner.Id)
+	require.NoError(t, err)
+	require.Equal(t, "team", org.Name)
+
+	membership, err := orgStore.GetMembership(ctx, org.Id, owner.Id)
+	require.NoError(t, err)
+	require.Equal(t, store.OrgRoleAdmin, membership.Role)
+	_, err = orgStore.GetMembership(ctx, org.Id, colleague.Id)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	membership, err = orgStore.AddMember(ctx, org.Id, colleague.Id, store.OrgRoleMember)
+	require.NoError(t, err)
+	require.Equal(t, store.OrgRoleMember, membership.Role)
+	//adding again changes the role
+	membership, err = orgStore.AddMember(ctx, org.Id, colleague.Id, store.OrgRoleAdmin)
+	require.NoError(t, err)
+	require.Equal(t, store.OrgRoleAdmin, membership.Role)
+	_, err = orgStore.AddMember(ctx, org.Id, colleague.Id, "owner")
+	require.Error(t, err)
+
+	members, err := orgStore.ListMembers(ctx, org.Id)
+	require.NoError(t, err)
+	require.Len(t, members, 2)
+	require.Equal(t, "colleague@test.com", members[0].Email)
+
+	orgs, err := orgStore.ListForUser(ctx, colleague.Id)
+	require.NoError(t, err)
+	require.Len(t, orgs, 1)
+	require.Equal(t, org.Id, orgs[0].Id)
+	require.Equal(t, store.OrgRoleAdmin, orgs[0].Role)
+
+	require.NoError(t, orgStore.RemoveMember(ctx, org.Id, colleague.Id))
+	require.ErrorIs(t, orgStore.RemoveMember(ctx, org.Id, colleague.Id), sql.ErrNoRows)
+	orgs, err = orgStore.ListForUser(ctx, colleague.Id)
+	require.NoError(t, err)
+	require.Empty(t, orgs)
+}
+
+func TestReportStore_Orgs(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() {
+		cleanup(t)
+	})
+
+	ctx := context.Background()
+	userStore := store.NewUserStore(env.Db, env.Passwords, env.TotpCipher)
+	orgStore := store.NewOrgStore(env.Db)
+	reportStore := store.NewReportStore(env.Db)
+	user, err := userStore.CreateUser(ctx, "test@test.com", "testpassword")
+	require.NoError(t, err)
+	org, err := orgStore.Create(ctx, "team", user.Id)
+	require.NoError(t, err)
+
+	shared, err := reportStore.CreateInOrg(ctx, user.Id, &org.Id, "monsters")
+	require.NoError(t, err)
+	require.Equal(t, &org.Id, shared.OrgId)
+	private, err := reportStore.Create(ctx, user.Id, "monsters")
+	require.NoError(t, err)
+	require.Nil(t, private.OrgId)
+
+	report, err := reportStore.GetById(ctx, private.Id)
+	require.NoError(t, err)
+	require.Equal(t, private.Id, report.Id)
+
+	//updates keep the organization the report is shared with
+	url := "https://example.com/report"
+	shared.DownloadUrl = &url
+	updated, err := reportStore.Update(ctx, shared)
+	require.NoError(t, err)
+	require.Equal(t, &org.Id, updated.OrgId)
+	require.Equal(t, url, *updated.DownloadUrl)
+
+	reports, err := reportStore.ListByOrg(ctx, org.Id, 10)
+	require.NoError(t, err)
+	require.Len(t, reports, 1)
+	require.Equal(t, shared.Id, reports[0].Id)
+}
+
+func TestOrgStore_LastAdmin(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() {
+		cleanup(t)
+	})
+
+	ctx := context.Background()
+	userStore := store.NewUserStore(env.Db, env.Passwords, env.TotpCipher)
+	orgStore := store.NewOrgStore(env.Db)
+	owner, err := userStore.CreateUser(ctx, "owner@test.com", "testpassword")
+	require.NoError(t, err)
+	colleague, err := userStore.CreateUser(ctx, "colleague@test.com", "testpassword")
+	require.NoError(t, err)
+	org, err := orgStore.Create(ctx, "team", owner.Id)
+	require.NoError(t, err)
+	_, err = orgStore.AddMember(ctx, org.Id, colleague.Id, store.OrgRoleMember)
+	require.NoError(t, err)
+
+	//the only admin can neither be demoted nor removed
+	_, err = orgStore.AddMember(ctx, org.Id, owner.Id, store.OrgRoleMember)
+	require.ErrorIs(t, err, store.ErrLastOrgAdmin)
+	require.ErrorIs(t, orgStore.RemoveMember(ctx, org.Id, owner.Id), store.ErrLastOrgAdmin)
+	membership, err := orgStore.GetMembership(ctx, org.Id, owner.Id)
+	require.NoError(t, err)
+	require.Equal(t, store.OrgRoleAdmin, membership.Role)
+
+	//members come and go freely
+	require.NoError(t, orgStore.RemoveMember(ctx, org.Id, colleague.Id))
+
+	//once there is another admin the first one may step down
+	_, err = orgStore.AddMember(ctx, org.Id, colleague.Id, store.OrgRoleAdmin)
+	require.NoError(t, err)
+	membership, err = orgStore.AddMember(ctx, org.Id, owner.Id, store.OrgRoleMember)
+	require.NoError(t, err)
+	require.Equal(t, store.OrgRoleMember, membership.Role)
+	require.ErrorIs(t, orgStore.RemoveMember(ctx, org.Id, colleague.Id), store.ErrLastOrgAdmin)
+	require.NoError(t, orgStore.RemoveMember(ctx, org.Id, owner.Id))
+}
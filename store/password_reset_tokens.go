@@ -0,0 +1,85 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+// PasswordResetTokenStore persists single-use password reset tokens. Only the
+// hash of a token is stored; the raw value is handed to the user once.
+type PasswordResetTokenStore struct {
+	db *sqlx.DB
+	// users hashes the passwords set by Reset and is invalidated after it
+	users *UserStore
+}
+
+type PasswordResetToken struct {
+	UserId      uuid.UUID  `db:"user_id"`
+	HashedToken string     `db:"hashed_token"`
+	CreatedAt   time.Time  `db:"created_at"`
+	ExpiresAt   time.Time  `db:"expires_at"`
+	UsedAt      *time.Time `db:"used_at"`
+}
+
+func NewPasswordResetTokenStore(db *sql.DB, users *UserStore) *PasswordResetTokenStore {
+	return &PasswordResetTokenStore{
+		db:    sqlx.NewDb(db, "postgres"),
+		users: users,
+	}
+}
+
+// Create issues a new reset token for the user valid for ttl, replacing any
+// token issued before. It returns the raw token, which is not stored.
+func (s *PasswordResetTokenStore) Create(ctx context.Context, userId uuid.UUID, ttl time.Duration) (string, *PasswordResetToken, error) {
+	return createSingleUseToken[PasswordResetToken](ctx, s.db, "password_reset_tokens", userId, ttl)
+}
+
+// Consume marks the token as used and returns it. It returns an error
+// wrapping sql.ErrNoRows if the token is unknown, expired or already used.
+func (s *PasswordResetTokenStore) Consume(ctx context.Context, raw string) (*PasswordResetToken, error) {
+	return consumeSingleUseToken[PasswordResetToken](ctx, s.db, "password_reset_tokens", raw)
+}
+
+// Reset consumes the token, sets the new password of its user and deletes
+// their refresh tokens in one transaction, so a failure leaves the token
+// usable and the old password in place. It returns the ID of the user, or an
+// error wrapping sql.ErrNoRows if the token is unknown, expired or already
+// used.
+func (s *PasswordResetTokenStore) Reset(ctx context.Context, raw, password string) (uuid.UUID, error) {
+	const dml = `UPDATE users SET hashed_password = $1 WHERE id = $2;`
+	const deleteDDL = `DELETE FROM refresh_tokens WHERE user_id = $1;`
+
+	//hash before taking the token, bcrypt is slow and may reject the password
+	hashedPasswordBase64, err := s.users.hashPassword(password)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	token, err := consumeSingleUseToken[PasswordResetToken](ctx, tx, "password_reset_tokens", raw)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if _, err := tx.ExecContext(ctx, dml, hashedPasswordBase64, token.UserId); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to update password for user %s: %w", token.UserId, err)
+	}
+	if _, err := tx.ExecContext(ctx, deleteDDL, token.UserId); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to delete refresh tokens for user %s: %w", token.UserId, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to commit password reset: %w", err)
+	}
+	s.users.invalidate(token.UserId)
+	return token.UserId, nil
+}
@@ -0,0 +1,93 @@
+package store_test
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"asyncapi/apiserver"
+	"asyncapi/fixtures"
+	"asyncapi/passwords"
+	"asyncapi/store"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordResetTokenStore(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() {
+		cleanup(t)
+	})
+
+	ctx := context.Background()
+	userStore := store.NewUserStore(env.Db, env.Passwords, env.TotpCipher)
+	user, err := userStore.CreateUser(ctx, "test@test.com", "test")
+	require.NoError(t, err)
+
+	resetStore := store.NewPasswordResetTokenStore(env.Db, userStore)
+
+	//a token can only be consumed once
+	raw, token, err := resetStore.Create(ctx, user.Id, time.Minute)
+	require.NoError(t, err)
+	require.NotEmpty(t, raw)
+	require.NotEqual(t, raw, token.HashedToken)
+	require.Equal(t, user.Id, token.UserId)
+
+	consumed, err := resetStore.Consume(ctx, raw)
+	require.NoError(t, err)
+	require.Equal(t, user.Id, consumed.UserId)
+	require.NotNil(t, consumed.UsedAt)
+
+	_, err = resetStore.Consume(ctx, raw)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	//issuing a new token invalidates the previous one
+	first, _, err := resetStore.Create(ctx, user.Id, time.Minute)
+	require.NoError(t, err)
+	second, _, err := resetStore.Create(ctx, user.Id, time.Minute)
+	require.NoError(t, err)
+	_, err = resetStore.Consume(ctx, first)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	//expired tokens are rejected
+	_, err = resetStore.Consume(ctx, second)
+	require.NoError(t, err)
+	expired, _, err := resetStore.Create(ctx, user.Id, -time.Minute)
+	require.NoError(t, err)
+	_, err = resetStore.Consume(ctx, expired)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	//the new password is stored
+	require.NoError(t, userStore.UpdatePassword(ctx, user.Id, "newpassword"))
+	updated, err := userStore.GetUserByID(ctx, user.Id)
+	require.NoError(t, err)
+	require.NoError(t, updated.ComparePassword("newpassword"))
+
+	//a reset sets the password and signs the user out in one go
+	refreshStore := store.NewRefreshTokenStore(env.Db)
+	tokenPair, err := apiserver.NewJwtManager(env.Config).GenerateTokenPair(user.Id)
+	require.NoError(t, err)
+	_, err = refreshStore.Create(ctx, user.Id, tokenPair.RefreshToken)
+	require.NoError(t, err)
+	raw, _, err = resetStore.Create(ctx, user.Id, time.Minute)
+	require.NoError(t, err)
+
+	//a password bcrypt rejects leaves the token usable
+	_, err = resetStore.Reset(ctx, raw, strings.Repeat("a", passwords.MaxBcryptLength+1))
+	require.Error(t, err)
+
+	userId, err := resetStore.Reset(ctx, raw, "resetpassword")
+	require.NoError(t, err)
+	require.Equal(t, user.Id, userId)
+	updated, err = userStore.GetUserByID(ctx, user.Id)
+	require.NoError(t, err)
+	require.NoError(t, updated.ComparePassword("resetpassword"))
+	_, err = refreshStore.ByPrimaryKey(ctx, user.Id, tokenPair.RefreshToken)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	_, err = resetStore.Reset(ctx, raw, "otherpassword")
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
@@ -0,0 +1,60 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// RateLimitStore keeps token buckets shared by all API server replicas. The
+// refill is computed by the database with its own clock, so replicas with
+// skewed clocks agree on the state of a bucket.
+type RateLimitStore struct {
+	db *sqlx.DB
+}
+
+func NewRateLimitStore(db *sql.DB) *RateLimitStore {
+	return &RateLimitStore{
+		db: sqlx.NewDb(db, "postgres"),
+	}
+}
+
+// refilledTokens are the tokens of an existing bucket refilled at $2 tokens a
+// second since its last update, capped at the burst $3.
+const refilledTokens = `LEAST($3::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM CURRENT_TIMESTAMP - rate_limit_buckets.updated_at) * $2::float8)`
+
+// Take refills the bucket of the key and takes a token from it if there is
+// one. It returns the tokens left and whether a token was taken. A key
+// without a bucket starts with a full one.
+func (s *RateLimitStore) Take(ctx context.Context, key string, perSecond float64, burst int) (float64, bool, error) {
+	const upsert = `INSERT INTO rate_limit_buckets (key, tokens, allowed, updated_at) VALUES ($1, $3::float8 - 1, true, CURRENT_TIMESTAMP)
+		ON CONFLICT (key) DO UPDATE SET
+			tokens = CASE WHEN ` + refilledTokens + ` >= 1 THEN ` + refilledTokens + ` - 1 ELSE ` + refilledTokens + ` END,
+			allowed = ` + refilledTokens + ` >= 1,
+			updated_at = CURRENT_TIMESTAMP
+		RETURNING tokens, allowed;`
+
+	var bucket struct {
+		Tokens  float64 `db:"tokens"`
+		Allowed bool    `db:"allowed"`
+	}
+	if err := s.db.GetContext(ctx, &bucket, upsert, key, perSecond, float64(burst)); err != nil {
+		return 0, false, fmt.Errorf("failed to take a token for %s: %w", key, err)
+	}
+	return bucket.Tokens, bucket.Allowed, nil
+}
+
+// DeleteIdle deletes the buckets not used for longer than idle, which must be
+// long enough for any bucket to refill completely. Like Take it relies on the
+// clock of the database.
+func (s *RateLimitStore) DeleteIdle(ctx context.Context, idle time.Duration) (int64, error) {
+	const deleteDDL = `DELETE FROM rate_limit_buckets WHERE updated_at < CURRENT_TIMESTAMP - $1::interval;`
+	result, err := s.db.ExecContext(ctx, deleteDDL, fmt.Sprintf("%f seconds", idle.Seconds()))
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete idle rate limit buckets: %w", err)
+	}
+	return result.RowsAffected()
+}
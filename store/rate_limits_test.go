@@ -0,0 +1,48 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"asyncapi/fixtures"
+	"asyncapi/store"
+)
+
+func TestRateLimitStore(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() {
+		cleanup(t)
+	})
+
+	ctx := context.Background()
+	rateLimitStore := store.NewRateLimitStore(env.Db)
+
+	tokens, allowed, err := rateLimitStore.Take(ctx, "auth:ip:10.0.0.1", 0.001, 2)
+	require.NoError(t, err)
+	require.True(t, allowed)
+	require.InDelta(t, 1, tokens, 0.01)
+
+	tokens, allowed, err = rateLimitStore.Take(ctx, "auth:ip:10.0.0.1", 0.001, 2)
+	require.NoError(t, err)
+	require.True(t, allowed)
+	require.InDelta(t, 0, tokens, 0.01)
+
+	_, allowed, err = rateLimitStore.Take(ctx, "auth:ip:10.0.0.1", 0.001, 2)
+	require.NoError(t, err)
+	require.False(t, allowed)
+
+	_, allowed, err = rateLimitStore.Take(ctx, "auth:ip:10.0.0.2", 0.001, 2)
+	require.NoError(t, err)
+	require.True(t, allowed)
+
+	deleted, err := rateLimitStore.DeleteIdle(ctx, time.Hour)
+	require.NoError(t, err)
+	require.Zero(t, deleted)
+	deleted, err = rateLimitStore.DeleteIdle(ctx, -time.Minute)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, deleted)
+}
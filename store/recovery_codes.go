@@ -0,0 +1,90 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+// RecoveryCodeStore persists hashed, single-use MFA recovery codes that let a
+// user sign in without their authenticator.
+type RecoveryCodeStore struct {
+	db *sqlx.DB
+}
+
+type RecoveryCode struct {
+	UserId     uuid.UUID  `db:"user_id"`
+	HashedCode string     `db:"hashed_code"`
+	CreatedAt  time.Time  `db:"created_at"`
+	UsedAt     *time.Time `db:"used_at"`
+}
+
+func NewRecoveryCodeStore(db *sql.DB) *RecoveryCodeStore {
+	return &RecoveryCodeStore{
+		db: sqlx.NewDb(db, "postgres"),
+	}
+}
+
+// normalizeRecoveryCode makes codes comparable regardless of case and dashes.
+func normalizeRecoveryCode(code string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
+
+// Generate replaces all recovery codes of the user with count new ones and
+// returns them. Only their hashes are stored.
+func (s *RecoveryCodeStore) Generate(ctx context.Context, userId uuid.UUID, count int) ([]string, error) {
+	const deleteDDL = `DELETE FROM mfa_recovery_codes WHERE user_id = $1;`
+	const insert = `INSERT INTO mfa_recovery_codes (user_id, hashed_code) VALUES ($1, $2);`
+
+	codes := make([]string, count)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		code := base32.StdEncoding.EncodeToString(b)
+		codes[i] = code[:4] + "-" + code[4:]
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, deleteDDL, userId); err != nil {
+		return nil, fmt.Errorf("failed to delete recovery codes of user %s: %w", userId, err)
+	}
+	for _, code := range codes {
+		if _, err := tx.ExecContext(ctx, insert, userId, hashToken(normalizeRecoveryCode(code))); err != nil {
+			return nil, fmt.Errorf("failed to insert recovery code for user %s: %w", userId, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit recovery codes: %w", err)
+	}
+	return codes, nil
+}
+
+// Consume marks the recovery code of the user as used. It returns an error
+// wrapping sql.ErrNoRows if the code is unknown or was already used.
+func (s *RecoveryCodeStore) Consume(ctx context.Context, userId uuid.UUID, code string) error {
+	const query = `UPDATE mfa_recovery_codes SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND hashed_code = $2 AND used_at IS NULL;`
+	result, err := s.db.ExecContext(ctx, query, userId, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return fmt.Errorf("failed to consume recovery code of user %s: %w", userId, err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("invalid recovery code: %w", sql.ErrNoRows)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package store_test
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"asyncapi/fixtures"
+	"asyncapi/store"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecoveryCodeStore(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() {
+		cleanup(t)
+	})
+
+	ctx := context.Background()
+	userStore := store.NewUserStore(env.Db, env.Passwords, env.TotpCipher)
+	user, err := userStore.CreateUser(ctx, "test@test.com", "testpassword")
+	require.NoError(t, err)
+
+	codeStore := store.NewRecoveryCodeStore(env.Db)
+	codes, err := codeStore.Generate(ctx, user.Id, 3)
+	require.NoError(t, err)
+	require.Len(t, codes, 3)
+
+	//codes are single use and compared without case or dashes
+	require.NoError(t, codeStore.Consume(ctx, user.Id, strings.ToLower(strings.ReplaceAll(codes[0], "-", ""))))
+	require.ErrorIs(t, codeStore.Consume(ctx, user.Id, codes[0]), sql.ErrNoRows)
+
+	//regenerating invalidates the previous codes
+	_, err = codeStore.Generate(ctx, user.Id, 3)
+	require.NoError(t, err)
+	require.ErrorIs(t, codeStore.Consume(ctx, user.Id, codes[1]), sql.ErrNoRows)
+
+	//totp steps can't be replayed
+	require.NoError(t, userStore.SetTotpSecret(ctx, user.Id, "SECRET"))
+	require.NoError(t, userStore.EnableTotp(ctx, user.Id))
+	require.NoError(t, userStore.UseTotpStep(ctx, user.Id, 100))
+	require.ErrorIs(t, userStore.UseTotpStep(ctx, user.Id, 100), sql.ErrNoRows)
+	require.NoError(t, userStore.UseTotpStep(ctx, user.Id, 101))
+
+	enrolled, err := userStore.GetUserByID(ctx, user.Id)
+	require.NoError(t, err)
+	require.True(t, enrolled.MfaEnabled())
+}
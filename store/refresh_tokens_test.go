@@ -19,7 +19,7 @@ func TestRefreshTokenStore(t *testing.T) {
 	})
 
 	ctx := context.Background()
-	userStore := store.NewUserStore(env.Db)
+	userStore := store.NewUserStore(env.Db, env.Passwords, env.TotpCipher)
 	user, err := userStore.CreateUser(ctx, "test@test.com", "test")
 	require.NoError(t, err)
 
@@ -0,0 +1,112 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Report statuses, as returned by Report.Status.
+const (
+	ReportStatusRequested  = "requested"
+	ReportStatusProcessing = "processing"
+	ReportStatusCompleted  = "completed"
+	ReportStatusFailed     = "failed"
+)
+
+// reportStatusConditions select the reports of each status.
+var reportStatusConditions = map[string]string{
+	ReportStatusRequested:  "started_at IS NULL AND completed_at IS NULL AND failed_at IS NULL",
+	ReportStatusProcessing: "started_at IS NOT NULL AND completed_at IS NULL AND failed_at IS NULL",
+	ReportStatusCompleted:  "completed_at IS NOT NULL",
+	ReportStatusFailed:     "failed_at IS NOT NULL AND completed_at IS NULL",
+}
+
+// ValidReportStatus reports whether the status can be filtered on.
+func ValidReportStatus(status string) bool {
+	_, ok := reportStatusConditions[status]
+	return ok
+}
+
+// ReportFilter narrows down ListReports, zero fields don't filter.
+type ReportFilter struct {
+	UserId        *uuid.UUID
+	ReportType    string
+	Status        string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Limit         int
+	Offset        int
+}
+
+// ListReports returns the reports of every user matching the filter, newest
+// first.
+func (s *ReportStore) ListReports(ctx context.Context, filter ReportFilter) ([]Report, error) {
+	var conditions []string
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	if filter.UserId != nil {
+		conditions = append(conditions, "user_id = "+arg(*filter.UserId))
+	}
+	if filter.ReportType != "" {
+		conditions = append(conditions, "report_type = "+arg(filter.ReportType))
+	}
+	if filter.Status != "" {
+		condition, ok := reportStatusConditions[filter.Status]
+		if !ok {
+			return nil, fmt.Errorf("unknown report status %q", filter.Status)
+		}
+		conditions = append(conditions, condition)
+	}
+	if filter.CreatedAfter != nil {
+		conditions = append(conditions, "created_at >= "+arg(*filter.CreatedAfter))
+	}
+	if filter.CreatedBefore != nil {
+		conditions = append(conditions, "created_at < "+arg(*filter.CreatedBefore))
+	}
+
+	query := `SELECT * FROM reports`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	query += ` ORDER BY created_at DESC, id LIMIT ` + arg(filter.Limit) + ` OFFSET ` + arg(filter.Offset)
+
+	reports := []Report{}
+	if err := s.db.SelectContext(ctx, &reports, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to list reports: %w", err)
+	}
+	return reports, nil
+}
+
+// ResetForRetry clears the progress of a report that has not completed, so
+// the worker builds it again when it is requeued. It returns an error wrapping
+// sql.ErrNoRows if there is no such report or it has already completed.
+func (s *ReportStore) ResetForRetry(ctx context.Context, id uuid.UUID) (*Report, error) {
+	const dml = `UPDATE reports SET started_at = NULL, failed_at = NULL, error_message = NULL,
+		output_file_path = NULL, download_url = NULL, download_url_expires_at = NULL, output_size_bytes = NULL
+		WHERE id = $1 AND completed_at IS NULL RETURNING *;`
+	var report Report
+	if err := s.db.GetContext(ctx, &report, dml, id); err != nil {
+		return nil, fmt.Errorf("failed to reset report %s: %w", id, err)
+	}
+	return &report, nil
+}
+
+// MarkFailed fails a report that has not completed, so it no longer counts
+// as in flight against the quota of its user. It returns an error wrapping
+// sql.ErrNoRows if there is no such report or it has already completed.
+func (s *ReportStore) MarkFailed(ctx context.Context, id uuid.UUID, errorMessage string) (*Report, error) {
+	const dml = `UPDATE reports SET failed_at = now(), error_message = $2
+		WHERE id = $1 AND completed_at IS NULL RETURNING *;`
+	var report Report
+	if err := s.db.GetContext(ctx, &report, dml, id, errorMessage); err != nil {
+		return nil, fmt.Errorf("failed to mark report %s failed: %w", id, err)
+	}
+	return &report, nil
+}
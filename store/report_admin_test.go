@@ -0,0 +1,111 @@
+package store_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"asyncapi/fixtures"
+	"asyncapi/store"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportStore_ListReports(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() {
+		cleanup(t)
+	})
+
+	ctx := context.Background()
+	userStore := store.NewUserStore(env.Db, env.Passwords, env.TotpCipher)
+	reportStore := store.NewReportStore(env.Db)
+	user, err := userStore.CreateUser(ctx, "test@test.com", "testpassword")
+	require.NoError(t, err)
+	other, err := userStore.CreateUser(ctx, "other@test.com", "testpassword")
+	require.NoError(t, err)
+
+	requested, err := reportStore.Create(ctx, user.Id, "monsters")
+	require.NoError(t, err)
+	failed, err := reportStore.Create(ctx, user.Id, "monsters")
+	require.NoError(t, err)
+	failed.StartedAt = aws.Time(time.Now())
+	failed.FailedAt = aws.Time(time.Now())
+	failed.ErrorMessage = aws.String("loz api unavailable")
+	_, err = reportStore.Update(ctx, failed)
+	require.NoError(t, err)
+	_, err = reportStore.Create(ctx, other.Id, "items")
+	require.NoError(t, err)
+
+	reports, err := reportStore.ListReports(ctx, store.ReportFilter{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, reports, 3)
+
+	reports, err = reportStore.ListReports(ctx, store.ReportFilter{UserId: &user.Id, Status: store.ReportStatusFailed, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, reports, 1)
+	require.Equal(t, failed.Id, reports[0].Id)
+	require.Equal(t, "loz api unavailable", *reports[0].ErrorMessage)
+
+	reports, err = reportStore.ListReports(ctx, store.ReportFilter{ReportType: "items", Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, reports, 1)
+
+	after := time.Now().Add(time.Minute)
+	reports, err = reportStore.ListReports(ctx, store.ReportFilter{CreatedAfter: &after, Limit: 10})
+	require.NoError(t, err)
+	require.Empty(t, reports)
+
+	_, err = reportStore.ListReports(ctx, store.ReportFilter{Status: "lost", Limit: 10})
+	require.Error(t, err)
+
+	reset, err := reportStore.ResetForRetry(ctx, failed.Id)
+	require.NoError(t, err)
+	require.Equal(t, store.ReportStatusRequested, reset.Status())
+	require.Nil(t, reset.ErrorMessage)
+
+	requested.StartedAt = aws.Time(time.Now())
+	requested.CompletedAt = aws.Time(time.Now())
+	_, err = reportStore.Update(ctx, requested)
+	require.NoError(t, err)
+	_, err = reportStore.ResetForRetry(ctx, requested.Id)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestReportStore_MarkFailed(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() {
+		cleanup(t)
+	})
+
+	ctx := context.Background()
+	userStore := store.NewUserStore(env.Db, env.Passwords, env.TotpCipher)
+	reportStore := store.NewReportStore(env.Db)
+	user, err := userStore.CreateUser(ctx, "test@test.com", "testpassword")
+	require.NoError(t, err)
+
+	report, err := reportStore.Create(ctx, user.Id, "monsters")
+	require.NoError(t, err)
+	failed, err := reportStore.MarkFailed(ctx, report.Id, "failed to enqueue the report")
+	require.NoError(t, err)
+	require.Equal(t, store.ReportStatusFailed, failed.Status())
+	require.Equal(t, "failed to enqueue the report", *failed.ErrorMessage)
+	usage, err := reportStore.Usage(ctx, user.Id)
+	require.NoError(t, err)
+	require.Zero(t, usage.InFlight)
+
+	reports, err := reportStore.ListReports(ctx, store.ReportFilter{Status: store.ReportStatusRequested, Limit: 10})
+	require.NoError(t, err)
+	require.Empty(t, reports)
+
+	report.StartedAt = aws.Time(time.Now())
+	report.CompletedAt = aws.Time(time.Now())
+	_, err = reportStore.Update(ctx, report)
+	require.NoError(t, err)
+	_, err = reportStore.MarkFailed(ctx, report.Id, "too late")
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// Limits checked by CreateWithinQuota, as reported by QuotaExceededError.
+const (
+	QuotaInFlight    = "in_flight_reports"
+	QuotaDaily       = "daily_reports"
+	QuotaStoredBytes = "stored_bytes"
+)
+
+// ReportQuota bounds the reports of a single user, a zero limit is disabled.
+type ReportQuota struct {
+	MaxInFlight    int
+	DailyLimit     int
+	MaxStoredBytes int64
+}
+
+// ReportUsage is the current consumption of a user against their ReportQuota.
+type ReportUsage struct {
+	// InFlight counts the reports that are neither completed nor failed.
+	InFlight int64 `db:"in_flight"`
+	// CreatedLastDay counts the reports created in the last 24 hours.
+	CreatedLastDay int64 `db:"created_last_day"`
+	// StoredBytes sums the size of the generated files.
+	StoredBytes int64 `db:"stored_bytes"`
+}
+
+// QuotaExceededError is returned by CreateWithinQuota when creating a report
+// would go over one of the limits.
+type QuotaExceededError struct {
+	Quota   string
+	Current int64
+	Max     int64
+}
+
+func (e *QuotaExceededError) Error() string {
+	switch e.Quota {
+	case QuotaInFlight:
+		return fmt.Sprintf("too many reports in progress: %d of %d, wait for some to complete", e.Current, e.Max)
+	case QuotaDaily:
+		return fmt.Sprintf("daily report limit reached: %d of %d reports created in the last 24 hours", e.Current, e.Max)
+	case QuotaStoredBytes:
+		return fmt.Sprintf("storage quota reached: %d of %d bytes used by reports", e.Current, e.Max)
+	}
+	return fmt.Sprintf("%s quota exceeded: %d of %d", e.Quota, e.Current, e.Max)
+}
+
+// Check returns a *QuotaExceededError if one more report can't be created
+// with the given usage.
+func (q ReportQuota) Check(usage *ReportUsage) error {
+	switch {
+	case q.MaxInFlight > 0 && usage.InFlight >= int64(q.MaxInFlight):
+		return &QuotaExceededError{Quota: QuotaInFlight, Current: usage.InFlight, Max: int64(q.MaxInFlight)}
+	case q.DailyLimit > 0 && usage.CreatedLastDay >= int64(q.DailyLimit):
+		return &QuotaExceededError{Quota: QuotaDaily, Current: usage.CreatedLastDay, Max: int64(q.DailyLimit)}
+	case q.MaxStoredBytes > 0 && usage.StoredBytes >= q.MaxStoredBytes:
+		return &QuotaExceededError{Quota: QuotaStoredBytes, Current: usage.StoredBytes, Max: q.MaxStoredBytes}
+	}
+	return nil
+}
+
+// Usage returns the current report consumption of the user.
+func (s *ReportStore) Usage(ctx context.Context, userId uuid.UUID) (*ReportUsage, error) {
+	return reportUsage(ctx, s.db, userId)
+}
+
+func reportUsage(ctx context.Context, q sqlx.QueryerContext, userId uuid.UUID) (*ReportUsage, error) {
+	const query = `SELECT
+		COUNT(*) FILTER (WHERE completed_at IS NULL AND failed_at IS NULL) AS in_flight,
+		COUNT(*) FILTER (WHERE created_at > CURRENT_TIMESTAMP - INTERVAL '24 hours') AS created_last_day,
+		COALESCE(SUM(output_size_bytes), 0) AS stored_bytes
+		FROM reports WHERE user_id = $1;`
+	var usage ReportUsage
+	if err := sqlx.GetContext(ctx, q, &usage, query, userId); err != nil {
+		return nil, fmt.Errorf("failed to get report usage of user %s: %w", userId, err)
+	}
+	return &usage, nil
+}
+
+// CreateWithinQuota inserts a report like CreateInOrg after checking the
+// quota of the user. Concurrent creations for the same user are serialized so
+// they can't both pass the check.
+func (s *ReportStore) CreateWithinQuota(ctx context.Context, userId uuid.UUID, orgId *uuid.UUID, reportType string, quota ReportQuota) (*Report, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1));`, "reports:"+userId.String()); err != nil {
+		return nil, fmt.Errorf("failed to lock reports of user %s: %w", userId, err)
+	}
+	usage, err := reportUsage(ctx, tx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if err := quota.Check(usage); err != nil {
+		return nil, err
+	}
+	report, err := insertReport(ctx, tx, userId, orgId, reportType)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit report: %w", err)
+	}
+	return report, nil
+}
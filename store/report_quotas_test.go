@@ -0,0 +1,82 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"asyncapi/fixtures"
+	"asyncapi/store"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportQuota_Check(t *testing.T) {
+	quota := store.ReportQuota{MaxInFlight: 2, DailyLimit: 10, MaxStoredBytes: 100}
+
+	require.NoError(t, quota.Check(&store.ReportUsage{InFlight: 1, CreatedLastDay: 9, StoredBytes: 99}))
+
+	tests := []struct {
+		usage store.ReportUsage
+		quota string
+	}{
+		{usage: store.ReportUsage{InFlight: 2}, quota: store.QuotaInFlight},
+		{usage: store.ReportUsage{CreatedLastDay: 10}, quota: store.QuotaDaily},
+		{usage: store.ReportUsage{StoredBytes: 150}, quota: store.QuotaStoredBytes},
+	}
+	for _, tt := range tests {
+		var quotaErr *store.QuotaExceededError
+		require.True(t, errors.As(quota.Check(&tt.usage), &quotaErr), tt.quota)
+		require.Equal(t, tt.quota, quotaErr.Quota)
+	}
+
+	//zero limits are disabled
+	require.NoError(t, store.ReportQuota{}.Check(&store.ReportUsage{InFlight: 1000, CreatedLastDay: 1000, StoredBytes: 1 << 40}))
+}
+
+func TestReportStore_CreateWithinQuota(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() {
+		cleanup(t)
+	})
+
+	ctx := context.Background()
+	userStore := store.NewUserStore(env.Db, env.Passwords, env.TotpCipher)
+	reportStore := store.NewReportStore(env.Db)
+	user, err := userStore.CreateUser(ctx, "test@test.com", "testpassword")
+	require.NoError(t, err)
+	quota := store.ReportQuota{MaxInFlight: 1, DailyLimit: 2, MaxStoredBytes: 100}
+
+	report, err := reportStore.CreateWithinQuota(ctx, user.Id, nil, "monsters", quota)
+	require.NoError(t, err)
+	_, err = reportStore.CreateWithinQuota(ctx, user.Id, nil, "monsters", quota)
+	var quotaErr *store.QuotaExceededError
+	require.ErrorAs(t, err, &quotaErr)
+	require.Equal(t, store.QuotaInFlight, quotaErr.Quota)
+
+	//completing the report frees the slot but stores its output
+	report.StartedAt = aws.Time(time.Now())
+	report.CompletedAt = aws.Time(time.Now())
+	report.OutputSizeBytes = aws.Int64(100)
+	_, err = reportStore.Update(ctx, report)
+	require.NoError(t, err)
+
+	usage, err := reportStore.Usage(ctx, user.Id)
+	require.NoError(t, err)
+	require.Equal(t, &store.ReportUsage{InFlight: 0, CreatedLastDay: 1, StoredBytes: 100}, usage)
+
+	_, err = reportStore.CreateWithinQuota(ctx, user.Id, nil, "monsters", quota)
+	require.ErrorAs(t, err, &quotaErr)
+	require.Equal(t, store.QuotaStoredBytes, quotaErr.Quota)
+
+	quota.MaxStoredBytes = 0
+	_, err = reportStore.CreateWithinQuota(ctx, user.Id, nil, "monsters", quota)
+	require.NoError(t, err)
+	quota.MaxInFlight = 0
+	_, err = reportStore.CreateWithinQuota(ctx, user.Id, nil, "monsters", quota)
+	require.ErrorAs(t, err, &quotaErr)
+	require.Equal(t, store.QuotaDaily, quotaErr.Quota)
+}
@@ -48,6 +48,8 @@ type Report struct {
 	StartedAt            *time.Time `db:"started_at"`              // The timestamp when the report generation started.
 	CompletedAt          *time.Time `db:"completed_at"`            // The timestamp when the report generation completed.
 	FailedAt             *time.Time `db:"failed_at"`               // The timestamp when the report generation failed.           // The timestamp when the report was last updated.
+	OrgId                *uuid.UUID `db:"org_id"`                  // The organization the report is shared with, if any.
+	OutputSizeBytes      *int64     `db:"output_size_bytes"`       // The size of the generated file.
 }
 
 func (r *Report) IsReportGenerationDone() bool {
@@ -56,14 +58,15 @@ func (r *Report) IsReportGenerationDone() bool {
 
 func (r *Report) Status() string {
 	switch {
-	case r.StartedAt == nil:
-		return "requested"
-	case r.StartedAt != nil && !r.IsReportGenerationDone():
-		return "processing"
 	case r.CompletedAt != nil:
-		return "completed"
+		return ReportStatusCompleted
+	//reports that could not be enqueued fail before they start
 	case r.FailedAt != nil:
-		return "failed"
+		return ReportStatusFailed
+	case r.StartedAt == nil:
+		return ReportStatusRequested
+	case r.StartedAt != nil && !r.IsReportGenerationDone():
+		return ReportStatusProcessing
 	}
 	return "unknown"
 }
@@ -92,9 +95,19 @@ func NewReportStore(db *sql.DB) *ReportStore {
 // - A pointer to the created Report instance.
 // - An error if the operation fails.
 func (s *ReportStore) Create(ctx context.Context, userId uuid.UUID, reportType string) (*Report, error) {
-	const insert = `INSERT INTO reports(user_id, report_type) VALUES ($1, $2) RETURNING *;`
+	return s.CreateInOrg(ctx, userId, nil, reportType)
+}
+
+// CreateInOrg inserts a new report like Create, shared with the members of
+// the organization when orgId is not nil.
+func (s *ReportStore) CreateInOrg(ctx context.Context, userId uuid.UUID, orgId *uuid.UUID, reportType string) (*Report, error) {
+	return insertReport(ctx, s.db, userId, orgId, reportType)
+}
+
+func insertReport(ctx context.Context, q sqlx.QueryerContext, userId uuid.UUID, orgId *uuid.UUID, reportType string) (*Report, error) {
+	const insert = `INSERT INTO reports(user_id, org_id, report_type) VALUES ($1, $2, $3) RETURNING *;`
 	var report Report
-	if err := s.db.GetContext(ctx, &report, insert, userId, reportType); err != nil {
+	if err := sqlx.GetContext(ctx, q, &report, insert, userId, orgId, reportType); err != nil {
 		return nil, fmt.Errorf("failed to insert report for user %s: %w", userId, err)
 	}
 	return &report, nil
@@ -112,21 +125,20 @@ func (s *ReportStore) Create(ctx context.Context, userId uuid.UUID, reportType s
 func (s *ReportStore) Update(ctx context.Context, report *Report) (*Report, error) {
 	const query = `UPDATE reports
         SET output_file_path = $1, download_url = $2, download_url_expires_at = $3,
-            error_message = $4, started_at = $5, completed_at = $6, failed_at = $7
+            error_message = $4, started_at = $5, completed_at = $6, failed_at = $7,
+            output_size_bytes = $10
         WHERE id = $8 AND user_id = $9
-        RETURNING id, user_id, report_type, output_file_path, download_url, 
-                  download_url_expires_at, error_message, started_at, completed_at, 
-                  created_at, failed_at
+        RETURNING *
     `
 	var updatedReport Report
 	if err := s.db.GetContext(ctx, &updatedReport, query,
 		report.OutputFilePath, report.DownloadUrl, report.DownloadUrlExpiresAt,
 		report.ErrorMessage, report.StartedAt, report.CompletedAt, report.FailedAt,
-		report.Id, report.UserId,
+		report.Id, report.UserId, report.OutputSizeBytes,
 	); err != nil {
 		return nil, fmt.Errorf("failed to update report %s for user %s: %w", report.Id, report.UserId, err)
 	}
-	return report, nil
+	return &updatedReport, nil
 }
 
 // GetByPrimaryKey retrieves a report from the database using its unique primary key.
@@ -159,3 +171,27 @@ func (s *ReportStore) GetByPrimaryKey(ctx context.Context, userId uuid.UUID, id
 	}
 	return &report, nil
 }
+
+// GetById retrieves a report by its ID regardless of its owner, for callers
+// that authorize access themselves. It returns nil if no report is found.
+func (s *ReportStore) GetById(ctx context.Context, id uuid.UUID) (*Report, error) {
+	const query = `SELECT * FROM reports WHERE id = $1;`
+	var report Report
+	if err := s.db.GetContext(ctx, &report, query, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to retrieve report with id %s: %w", id, err)
+	}
+	return &report, nil
+}
+
+// ListByOrg returns the reports shared with the organization, newest first.
+func (s *ReportStore) ListByOrg(ctx context.Context, orgId uuid.UUID, limit int) ([]Report, error) {
+	const query = `SELECT * FROM reports WHERE org_id = $1 ORDER BY created_at DESC LIMIT $2;`
+	reports := []Report{}
+	if err := s.db.SelectContext(ctx, &reports, query, orgId, limit); err != nil {
+		return nil, fmt.Errorf("failed to list reports of organization %s: %w", orgId, err)
+	}
+	return reports, nil
+}
@@ -48,7 +48,7 @@ func TestReportStore(t *testing.T) {
 	now := time.Now()
 
 	// Create a user
-	userStore := store.NewUserStore(env.Db)
+	userStore := store.NewUserStore(env.Db, env.Passwords, env.TotpCipher)
 	user, err := userStore.CreateUser(ctx, "sample@test.com", "samplepassword")
 	require.NoError(t, err)
 	//fetch userId for furtehr testing
@@ -0,0 +1,110 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// SigninFailureStore tracks failed signin attempts per key (an account or a
+// client IP) and the lockout they result in.
+type SigninFailureStore struct {
+	db *sqlx.DB
+}
+
+type SigninFailure struct {
+	Key         string     `db:"key"`
+	Failures    int        `db:"failures"`
+	LockedUntil *time.Time `db:"locked_until"`
+	UpdatedAt   time.Time  `db:"updated_at"`
+}
+
+// LockoutPolicy describes when repeated failures lock a key out. Once
+// MaxFailures is reached every further failure doubles the lockout, starting
+// at BaseLockout and capped at MaxLockout. Failures older than Window are
+// forgotten.
+type LockoutPolicy struct {
+	MaxFailures int
+	BaseLockout time.Duration
+	MaxLockout  time.Duration
+	Window      time.Duration
+}
+
+// LockoutFor returns how long a key with the given number of consecutive
+// failures is locked out for, or zero if it is not locked out.
+func (p LockoutPolicy) LockoutFor(failures int) time.Duration {
+	if p.MaxFailures <= 0 || failures < p.MaxFailures {
+		return 0
+	}
+	lockout := p.BaseLockout
+	for i := p.MaxFailures; i < failures && lockout < p.MaxLockout; i++ {
+		lockout *= 2
+	}
+	return min(lockout, p.MaxLockout)
+}
+
+// AccountKey returns the key failures of the account with the email are tracked under.
+func AccountKey(email string) string {
+	return "email:" + strings.ToLower(email)
+}
+
+// IpKey returns the key failures from the client IP are tracked under.
+func IpKey(ip string) string {
+	return "ip:" + ip
+}
+
+func NewSigninFailureStore(db *sql.DB) *SigninFailureStore {
+	return &SigninFailureStore{
+		db: sqlx.NewDb(db, "postgres"),
+	}
+}
+
+// LockedUntil returns the latest lockout among the given keys, or the zero
+// time if none of them is locked out.
+func (s *SigninFailureStore) LockedUntil(ctx context.Context, keys ...string) (time.Time, error) {
+	const query = `SELECT MAX(locked_until) FROM signin_failures WHERE key = ANY($1) AND locked_until > CURRENT_TIMESTAMP;`
+	var lockedUntil sql.NullTime
+	if err := s.db.GetContext(ctx, &lockedUntil, query, pq.Array(keys)); err != nil {
+		return time.Time{}, fmt.Errorf("failed to get lockout for %v: %w", keys, err)
+	}
+	return lockedUntil.Time, nil
+}
+
+// RecordFailure counts a failed attempt for the key and locks it out
+// according to the policy.
+func (s *SigninFailureStore) RecordFailure(ctx context.Context, key string, policy LockoutPolicy) (*SigninFailure, error) {
+	const upsert = `INSERT INTO signin_failures (key, failures) VALUES ($1, 1)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN signin_failures.updated_at < $2 THEN 1 ELSE signin_failures.failures + 1 END,
+			updated_at = CURRENT_TIMESTAMP
+		RETURNING *;`
+	const lock = `UPDATE signin_failures SET locked_until = $1 WHERE key = $2;`
+
+	var failure SigninFailure
+	if err := s.db.GetContext(ctx, &failure, upsert, key, time.Now().Add(-policy.Window)); err != nil {
+		return nil, fmt.Errorf("failed to record signin failure for %s: %w", key, err)
+	}
+	if lockout := policy.LockoutFor(failure.Failures); lockout > 0 {
+		lockedUntil := time.Now().Add(lockout)
+		if _, err := s.db.ExecContext(ctx, lock, lockedUntil, key); err != nil {
+			return nil, fmt.Errorf("failed to lock out %s: %w", key, err)
+		}
+		failure.LockedUntil = &lockedUntil
+	}
+	return &failure, nil
+}
+
+// Reset forgets all failures and lockouts of the given keys. It is used after
+// a successful signin and by administrators to unlock an account.
+func (s *SigninFailureStore) Reset(ctx context.Context, keys ...string) error {
+	const deleteDDL = `DELETE FROM signin_failures WHERE key = ANY($1);`
+	if _, err := s.db.ExecContext(ctx, deleteDDL, pq.Array(keys)); err != nil {
+		return fmt.Errorf("failed to reset signin failures for %v: %w", keys, err)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"asyncapi/fixtures"
+	"asyncapi/store"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockoutPolicy_LockoutFor(t *testing.T) {
+	policy := store.LockoutPolicy{MaxFailures: 3, BaseLockout: time.Minute, MaxLockout: 5 * time.Minute}
+
+	require.Zero(t, policy.LockoutFor(0))
+	require.Zero(t, policy.LockoutFor(2))
+	require.Equal(t, time.Minute, policy.LockoutFor(3))
+	require.Equal(t, 2*time.Minute, policy.LockoutFor(4))
+	require.Equal(t, 4*time.Minute, policy.LockoutFor(5))
+	require.Equal(t, 5*time.Minute, policy.LockoutFor(6))
+	require.Equal(t, 5*time.Minute, policy.LockoutFor(100))
+
+	require.Zero(t, store.LockoutPolicy{}.LockoutFor(100), "disabled policy")
+}
+
+func TestSigninFailureStore(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() {
+		cleanup(t)
+	})
+
+	ctx := context.Background()
+	failureStore := store.NewSigninFailureStore(env.Db)
+	policy := store.LockoutPolicy{MaxFailures: 2, BaseLockout: time.Minute, MaxLockout: time.Hour, Window: time.Hour}
+	accountKey := store.AccountKey("Test@Test.com")
+	ipKey := store.IpKey("127.0.0.1")
+
+	failure, err := failureStore.RecordFailure(ctx, accountKey, policy)
+	require.NoError(t, err)
+	require.Equal(t, 1, failure.Failures)
+	require.Nil(t, failure.LockedUntil)
+
+	lockedUntil, err := failureStore.LockedUntil(ctx, accountKey, ipKey)
+	require.NoError(t, err)
+	require.True(t, lockedUntil.IsZero())
+
+	failure, err = failureStore.RecordFailure(ctx, accountKey, policy)
+	require.NoError(t, err)
+	require.Equal(t, 2, failure.Failures)
+	require.NotNil(t, failure.LockedUntil)
+
+	lockedUntil, err = failureStore.LockedUntil(ctx, ipKey, store.AccountKey("test@test.com"))
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now().Add(time.Minute), lockedUntil, 5*time.Second)
+
+	require.NoError(t, failureStore.Reset(ctx, accountKey))
+	lockedUntil, err = failureStore.LockedUntil(ctx, accountKey)
+	require.NoError(t, err)
+	require.True(t, lockedUntil.IsZero())
+}
@@ -1,17 +1,55 @@
 package store
 
-import "database/sql"
+import (
+	"context"
+	"database/sql"
+
+	"asyncapi/passwords"
+	"asyncapi/totp"
+)
 
 type Store struct {
 	Users             *UserStore
 	RefreshTokenStore *RefreshTokenStore
 	ReportStore       *ReportStore
+	PasswordResets    *PasswordResetTokenStore
+	Verifications     *EmailVerificationTokenStore
+	SigninFailures    *SigninFailureStore
+	RecoveryCodes     *RecoveryCodeStore
+	ApiKeys           *ApiKeyStore
+	Orgs              *OrgStore
+	Identities        *UserIdentityStore
+	OAuthClients      *OAuthClientStore
+	RateLimits        *RateLimitStore
+
+	db *sql.DB
+}
+
+// PingContext checks that a connection of the pool reaches the database.
+func (s *Store) PingContext(ctx context.Context) error {
+	return s.db.PingContext(ctx)
 }
 
-func New(db *sql.DB) *Store {
+// New returns the stores of the database, hashing passwords with the policy
+// and encrypting TOTP secrets with the cipher, see NewUserStore. Either may be
+// nil in processes that never set passwords or TOTP secrets.
+func New(db *sql.DB, policy *passwords.Policy, totpCipher *totp.Cipher) *Store {
+	users := NewUserStore(db, policy, totpCipher)
+	identities := NewUserIdentityStore(db)
+	identities.users = users
 	return &Store{
-		Users:             NewUserStore(db),
+		Users:             users,
 		RefreshTokenStore: NewRefreshTokenStore(db),
 		ReportStore:       NewReportStore(db),
+		PasswordResets:    NewPasswordResetTokenStore(db, users),
+		Verifications:     NewEmailVerificationTokenStore(db),
+		SigninFailures:    NewSigninFailureStore(db),
+		RecoveryCodes:     NewRecoveryCodeStore(db),
+		ApiKeys:           NewApiKeyStore(db),
+		Orgs:              NewOrgStore(db),
+		Identities:        identities,
+		OAuthClients:      NewOAuthClientStore(db),
+		RateLimits:        NewRateLimitStore(db),
+		db:                db,
 	}
 }
@@ -0,0 +1,75 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// newOpaqueToken returns a random, url-safe token suitable for sending to a
+// user (e.g. inside an email). Only its hash should ever be persisted.
+func newOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the base64 encoded sha256 hash of the raw token, the same
+// format used for refresh tokens.
+func hashToken(raw string) string {
+	h := sha256.Sum256([]byte(raw))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// createSingleUseToken issues a new token for the user in the given table,
+// replacing any token issued before, and returns the raw token. The table must
+// have the user_id, hashed_token, created_at, expires_at and used_at columns.
+func createSingleUseToken[T any](ctx context.Context, db *sqlx.DB, table string, userId uuid.UUID, ttl time.Duration) (string, *T, error) {
+	deleteDDL := fmt.Sprintf(`DELETE FROM %s WHERE user_id = $1;`, table)
+	insert := fmt.Sprintf(`INSERT INTO %s (user_id, hashed_token, expires_at) VALUES ($1, $2, $3) RETURNING *;`, table)
+
+	raw, err := newOpaqueToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, deleteDDL, userId); err != nil {
+		return "", nil, fmt.Errorf("failed to delete previous %s for user %s: %w", table, userId, err)
+	}
+	var token T
+	if err := tx.GetContext(ctx, &token, insert, userId, hashToken(raw), time.Now().Add(ttl)); err != nil {
+		return "", nil, fmt.Errorf("failed to insert %s for user %s: %w", table, userId, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return "", nil, fmt.Errorf("failed to commit %s: %w", table, err)
+	}
+	return raw, &token, nil
+}
+
+// consumeSingleUseToken marks the token as used and returns it. It returns an
+// error wrapping sql.ErrNoRows if the token is unknown, expired or already used.
+// When db is a transaction the token stays usable if it is rolled back.
+func consumeSingleUseToken[T any](ctx context.Context, db sqlx.QueryerContext, table string, raw string) (*T, error) {
+	query := fmt.Sprintf(`UPDATE %s SET used_at = CURRENT_TIMESTAMP
+		WHERE hashed_token = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		RETURNING *;`, table)
+	var token T
+	if err := sqlx.GetContext(ctx, db, &token, query, hashToken(raw)); err != nil {
+		return nil, fmt.Errorf("failed to consume %s: %w", table, err)
+	}
+	return &token, nil
+}
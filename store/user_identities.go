@@ -0,0 +1,107 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// UserIdentityStore links users to the accounts they sign in with at external
+// OpenID providers, identified by issuer and subject.
+type UserIdentityStore struct {
+	db *sqlx.DB
+	// users is invalidated when linking changes a user, may be nil
+	users *UserStore
+}
+
+type UserIdentity struct {
+	Issuer       string    `db:"issuer"`
+	Subject      string    `db:"subject"`
+	UserId       uuid.UUID `db:"user_id"`
+	Email        string    `db:"email"`
+	CreatedAt    time.Time `db:"created_at"`
+	LastSigninAt time.Time `db:"last_signin_at"`
+}
+
+func NewUserIdentityStore(db *sql.DB) *UserIdentityStore {
+	return &UserIdentityStore{
+		db: sqlx.NewDb(db, "postgres"),
+	}
+}
+
+// SigninExternal returns the user linked to the external identity. An
+// identity seen for the first time is linked to the user with the same email,
+// which is marked verified, or to a new user without a password. The email
+// must have been verified by the provider.
+func (s *UserIdentityStore) SigninExternal(ctx context.Context, issuer, subject, email string) (*User, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	const touch = `UPDATE user_identities SET last_signin_at = CURRENT_TIMESTAMP
+		WHERE issuer = $1 AND subject = $2 RETURNING user_id;`
+	var userId uuid.UUID
+	err = tx.GetContext(ctx, &userId, touch, issuer, subject)
+	switch {
+	case err == nil:
+	case errors.Is(err, sql.ErrNoRows):
+		userId, err = linkIdentity(ctx, tx, issuer, subject, email)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("failed to look up identity %s at %s: %w", subject, issuer, err)
+	}
+
+	var user User
+	if err := tx.GetContext(ctx, &user, `SELECT `+userColumns+` FROM users WHERE id = $1`, userId); err != nil {
+		return nil, fmt.Errorf("failed to get user %s: %w", userId, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit identity: %w", err)
+	}
+	if s.users != nil {
+		s.users.invalidate(userId)
+	}
+	return &user, nil
+}
+
+// linkIdentity links a new identity to the user with the email, creating the
+// user if needed, and returns the ID of the user.
+func linkIdentity(ctx context.Context, tx *sqlx.Tx, issuer, subject, email string) (uuid.UUID, error) {
+	//an empty hash never matches a password, so the user can only sign in
+	//with the provider until they reset their password. The password of an
+	//unverified account is dropped too: whoever signed up with the email
+	//before its owner must not keep access to the account.
+	const upsertUser = `INSERT INTO users (email, hashed_password, verified_at) VALUES ($1, '', CURRENT_TIMESTAMP)
+		ON CONFLICT (email) DO UPDATE SET
+			hashed_password = CASE WHEN users.verified_at IS NULL THEN '' ELSE users.hashed_password END,
+			verified_at = COALESCE(users.verified_at, EXCLUDED.verified_at)
+		RETURNING id;`
+	var userId uuid.UUID
+	if err := tx.GetContext(ctx, &userId, upsertUser, email); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to create user for identity %s at %s: %w", subject, issuer, err)
+	}
+	const insert = `INSERT INTO user_identities (issuer, subject, user_id, email) VALUES ($1, $2, $3, $4);`
+	if _, err := tx.ExecContext(ctx, insert, issuer, subject, userId, email); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to link identity %s at %s: %w", subject, issuer, err)
+	}
+	return userId, nil
+}
+
+// ListByUser returns the external identities linked to the user.
+func (s *UserIdentityStore) ListByUser(ctx context.Context, userId uuid.UUID) ([]UserIdentity, error) {
+	const query = `SELECT * FROM user_identities WHERE user_id = $1 ORDER BY created_at;`
+	identities := []UserIdentity{}
+	if err := s.db.SelectContext(ctx, &identities, query, userId); err != nil {
+		return nil, fmt.Errorf("failed to list identities of user %s: %w", userId, err)
+	}
+	return identities, nil
+}
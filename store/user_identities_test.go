@@ -0,0 +1,59 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+
+	"asyncapi/fixtures"
+	"asyncapi/store"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserIdentityStore_SigninExternal(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() {
+		cleanup(t)
+	})
+
+	ctx := context.Background()
+	userStore := store.NewUserStore(env.Db, env.Passwords, env.TotpCipher)
+	identityStore := store.NewUserIdentityStore(env.Db)
+	const issuer = "https://idp.example.com"
+
+	//a new email creates a verified user without a password
+	created, err := identityStore.SigninExternal(ctx, issuer, "new", "new@test.com")
+	require.NoError(t, err)
+	require.Equal(t, "new@test.com", created.Email)
+	require.NotNil(t, created.VerifiedAt)
+	require.Error(t, created.ComparePassword(""))
+
+	again, err := identityStore.SigninExternal(ctx, issuer, "new", "new@test.com")
+	require.NoError(t, err)
+	require.Equal(t, created.Id, again.Id)
+
+	//an existing verified email is linked
+	existing, err := userStore.CreateUser(ctx, "test@test.com", "testpassword")
+	require.NoError(t, err)
+	_, err = userStore.MarkVerified(ctx, existing.Id)
+	require.NoError(t, err)
+	linked, err := identityStore.SigninExternal(ctx, issuer, "existing", "test@test.com")
+	require.NoError(t, err)
+	require.Equal(t, existing.Id, linked.Id)
+	require.NoError(t, linked.ComparePassword("testpassword"))
+
+	//the password of an unverified account is dropped when linking
+	unverified, err := userStore.CreateUser(ctx, "unverified@test.com", "testpassword")
+	require.NoError(t, err)
+	linked, err = identityStore.SigninExternal(ctx, issuer, "unverified", "unverified@test.com")
+	require.NoError(t, err)
+	require.Equal(t, unverified.Id, linked.Id)
+	require.NotNil(t, linked.VerifiedAt)
+	require.Error(t, linked.ComparePassword("testpassword"))
+
+	identities, err := identityStore.ListByUser(ctx, existing.Id)
+	require.NoError(t, err)
+	require.Len(t, identities, 1)
+	require.Equal(t, "existing", identities[0].Subject)
+}
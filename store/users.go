@@ -5,18 +5,34 @@ import (
 	"context"
 	"database/sql"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq" // Postgres driver
 	"golang.org/x/crypto/bcrypt"
+
+	"asyncapi/cache"
+	"asyncapi/passwords"
+	"asyncapi/totp"
 )
 
 type UserStore struct {
 	// DB is the database connection
 	db *sqlx.DB
+	// cache of GetUserByID, nil unless EnableCache was called
+	cache *cache.LRU[uuid.UUID, User]
+	// passwords hashes the passwords of the users, nil refuses to hash them
+	passwords *passwords.Policy
+	// totp encrypts the TOTP secrets, nil refuses to store or read them
+	totp *totp.Cipher
+	// dummyPasswordHash is compared against when signing in with an unknown
+	// email, so that it costs as much as signing in with a wrong password
+	dummyPasswordHash func() string
 }
 
 type User struct {
@@ -25,11 +41,84 @@ type User struct {
 	Email                string    `db:"email"`
 	HashedPasswordBase64 string    `db:"hashed_password"`
 	CreatedAt            time.Time `db:"created_at"`
+	// VerifiedAt is set once the user has confirmed their email address
+	VerifiedAt *time.Time `db:"verified_at"`
+	// TotpSecret is the encrypted TOTP secret, pending until TotpEnabledAt is
+	// set. UserStore.TotpSecret decrypts it.
+	TotpSecret    *string    `db:"totp_secret"`
+	TotpEnabledAt *time.Time `db:"totp_enabled_at"`
+	// TotpLastStep is the time step of the last accepted code, to prevent replays
+	TotpLastStep *int64 `db:"totp_last_step"`
+	// Role is either RoleUser or RoleAdmin
+	Role string `db:"role"`
+	// DisabledAt is set while an admin has disabled the account
+	DisabledAt *time.Time `db:"disabled_at"`
+	// SessionsRevokedAt invalidates the access tokens issued before it
+	SessionsRevokedAt *time.Time `db:"sessions_revoked_at"`
+}
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// userColumns lists the columns selected into a User.
+const userColumns = `id, email, hashed_password, created_at, verified_at, totp_secret, totp_enabled_at, totp_last_step, role, disabled_at, sessions_revoked_at`
+
+// Disabled reports whether an admin has disabled the account.
+func (u *User) Disabled() bool {
+	return u.DisabledAt != nil
+}
+
+// TokenRevoked reports whether an access token issued at the given time was
+// revoked by a forced logout. Token times have a one second resolution.
+func (u *User) TokenRevoked(issuedAt time.Time) bool {
+	return u.SessionsRevokedAt != nil && issuedAt.Before(u.SessionsRevokedAt.Truncate(time.Second))
+}
+
+// MfaEnabled reports whether the user has confirmed TOTP enrolment.
+func (u *User) MfaEnabled() bool {
+	return u.TotpEnabledAt != nil && u.TotpSecret != nil
+}
+
+// NewUserStore returns a store hashing passwords with the policy and
+// encrypting TOTP secrets with the cipher.
+func NewUserStore(db *sql.DB, policy *passwords.Policy, totpCipher *totp.Cipher) *UserStore {
+	s := &UserStore{
+		db:        sqlx.NewDb(db, "postgres"),
+		passwords: policy,
+		totp:      totpCipher,
+	}
+	s.dummyPasswordHash = sync.OnceValue(func() string {
+		hashed, err := s.hashPassword("dummy password")
+		if err != nil {
+			panic(err)
+		}
+		return hashed
+	})
+	return s
 }
 
-func NewUserStore(db *sql.DB) *UserStore {
-	return &UserStore{
-		db: sqlx.NewDb(db, "postgres"),
+// EnableCache caches up to size users looked up with GetUserByID for at most
+// ttl. Changes made through the store invalidate the cached user; changes made
+// by other processes, e.g. another replica, show up once the entry expires.
+func (s *UserStore) EnableCache(size int, ttl time.Duration) {
+	s.cache = cache.NewLRU[uuid.UUID, User](size, ttl)
+}
+
+// CacheStats returns the hit and miss counters of the cache, all zero when it
+// is not enabled.
+func (s *UserStore) CacheStats() cache.Stats {
+	if s.cache == nil {
+		return cache.Stats{}
+	}
+	return s.cache.Stats()
+}
+
+// invalidate drops the cached copy of the user after it changed.
+func (s *UserStore) invalidate(id uuid.UUID) {
+	if s.cache != nil {
+		s.cache.Delete(id)
 	}
 }
 
@@ -48,21 +137,57 @@ func (u *User) ComparePassword(password string) error {
 	return nil
 }
 
+// NeedsRehash reports whether the stored hash of the user was generated with
+// a lower bcrypt cost than the password policy of the store asks for.
+func (s *UserStore) NeedsRehash(user *User) bool {
+	if s.passwords == nil {
+		return false
+	}
+	hashedPassword, err := base64.StdEncoding.DecodeString(user.HashedPasswordBase64)
+	if err != nil {
+		return false
+	}
+	return s.passwords.NeedsRehash(hashedPassword)
+}
+
+// hashPassword hashes the password with bcrypt, at the cost of the password
+// policy of the store, and encodes the hash in base64,
+// the format stored in the hashed_password column.
+func (s *UserStore) hashPassword(password string) (string, error) {
+	if s.passwords == nil {
+		return "", errors.New("passwords can't be hashed without a password policy")
+	}
+	hashedPassword, err := s.passwords.Hash(password)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(hashedPassword), nil
+}
+
+// CompareDummyPassword runs a bcrypt comparison against a throwaway hash. Call
+// it when the user does not exist to keep the response time independent of
+// whether the email is registered.
+func (s *UserStore) CompareDummyPassword(password string) {
+	if s.passwords == nil {
+		return
+	}
+	user := User{HashedPasswordBase64: s.dummyPasswordHash()}
+	_ = user.ComparePassword(password)
+}
+
 // CreateUser creates a new user in the database.
 // It hashes the password and stores it in base64 format.
 // It returns the created user or an error if the creation fails.
 // It uses the context to support cancellation and deadlines.
 func (s *UserStore) CreateUser(ctx context.Context, email, password string) (*User, error) {
 	// Hash the password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPasswordBase64, err := s.hashPassword(password)
 	if err != nil {
-		return nil, fmt.Errorf("failed to hash password: %w", err)
+		return nil, err
 	}
 
-	hashedPasswordBase64 := base64.StdEncoding.EncodeToString(hashedPassword)
-
 	// Insert a new user into the database
-	const dml = `INSERT INTO users (email, hashed_password) VALUES ($1, $2) RETURNING id, email, hashed_password, created_at`
+	const dml = `INSERT INTO users (email, hashed_password) VALUES ($1, $2) RETURNING ` + userColumns
 	var user User
 	if err := s.db.GetContext(ctx, &user, dml, email, hashedPasswordBase64); err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
@@ -73,7 +198,7 @@ func (s *UserStore) CreateUser(ctx context.Context, email, password string) (*Us
 
 func (s *UserStore) GetUserByEmail(ctx context.Context, email string) (*User, error) {
 	// Query the user by email
-	const query = `SELECT id, email, hashed_password AS hashed_password, created_at FROM users WHERE email = $1`
+	const query = `SELECT ` + userColumns + ` FROM users WHERE email = $1`
 	var user User
 	if err := s.db.GetContext(ctx, &user, query, email); err != nil {
 		if err == sql.ErrNoRows {
@@ -99,8 +224,14 @@ func (s *UserStore) GetUserByEmail(ctx context.Context, email string) (*User, er
 // It uses the sql package to handle SQL errors and the fmt package for error formatting.
 // It uses the time package to handle timestamps and the uuid package to generate and handle UUIDs.
 func (s *UserStore) GetUserByID(ctx context.Context, id uuid.UUID) (*User, error) {
+	//every caller gets its own copy, so they can't change the cached user
+	if s.cache != nil {
+		if user, ok := s.cache.Get(id); ok {
+			return &user, nil
+		}
+	}
 	// Query the user by ID
-	const query = `SELECT id, email, hashed_password AS hashed_password, created_at FROM users WHERE id = $1;`
+	const query = `SELECT ` + userColumns + ` FROM users WHERE id = $1;`
 	var user User
 	if err := s.db.GetContext(ctx, &user, query, id); err != nil {
 		if err == sql.ErrNoRows {
@@ -108,6 +239,217 @@ func (s *UserStore) GetUserByID(ctx context.Context, id uuid.UUID) (*User, error
 		}
 		return nil, fmt.Errorf("failed to get user by ID: %w", err)
 	}
+	if s.cache != nil {
+		s.cache.Set(id, user)
+	}
 	// Return the found user
 	return &user, nil
 }
+
+// UpdatePassword replaces the password of the user with the given ID.
+func (s *UserStore) UpdatePassword(ctx context.Context, id uuid.UUID, password string) error {
+	defer s.invalidate(id)
+	hashedPasswordBase64, err := s.hashPassword(password)
+	if err != nil {
+		return err
+	}
+	const dml = `UPDATE users SET hashed_password = $1 WHERE id = $2`
+	result, err := s.db.ExecContext(ctx, dml, hashedPasswordBase64, id)
+	if err != nil {
+		return fmt.Errorf("failed to update password for user %s: %w", id, err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("user not found: %w", sql.ErrNoRows)
+	}
+	return nil
+}
+
+// MarkVerified records that the user has verified their email address. It
+// keeps the original timestamp if the user was already verified.
+func (s *UserStore) MarkVerified(ctx context.Context, id uuid.UUID) (*User, error) {
+	defer s.invalidate(id)
+	const dml = `UPDATE users SET verified_at = COALESCE(verified_at, CURRENT_TIMESTAMP) WHERE id = $1 RETURNING ` + userColumns
+	var user User
+	if err := s.db.GetContext(ctx, &user, dml, id); err != nil {
+		return nil, fmt.Errorf("failed to mark user %s as verified: %w", id, err)
+	}
+	return &user, nil
+}
+
+// DeleteUser removes the user. Their refresh tokens and reports are removed
+// by the ON DELETE CASCADE foreign keys.
+func (s *UserStore) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	defer s.invalidate(id)
+	const dml = `DELETE FROM users WHERE id = $1`
+	result, err := s.db.ExecContext(ctx, dml, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete user %s: %w", id, err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("user not found: %w", sql.ErrNoRows)
+	}
+	return nil
+}
+
+// SetTotpSecret encrypts and stores a new, not yet confirmed, TOTP secret for
+// the user.
+func (s *UserStore) SetTotpSecret(ctx context.Context, id uuid.UUID, secret string) error {
+	defer s.invalidate(id)
+	if s.totp == nil {
+		return errors.New("totp secrets can't be stored without an encryption key")
+	}
+	sealed, err := s.totp.Seal(secret, id[:])
+	if err != nil {
+		return err
+	}
+	const dml = `UPDATE users SET totp_secret = $1, totp_enabled_at = NULL, totp_last_step = NULL WHERE id = $2`
+	if _, err := s.db.ExecContext(ctx, dml, sealed, id); err != nil {
+		return fmt.Errorf("failed to set totp secret for user %s: %w", id, err)
+	}
+	return nil
+}
+
+// TotpSecret decrypts the TOTP secret of the user. It returns an error
+// wrapping sql.ErrNoRows if the user has none.
+func (s *UserStore) TotpSecret(user *User) (string, error) {
+	if user.TotpSecret == nil {
+		return "", fmt.Errorf("no totp secret: %w", sql.ErrNoRows)
+	}
+	if s.totp == nil {
+		return "", errors.New("totp secrets can't be read without an encryption key")
+	}
+	return s.totp.Open(*user.TotpSecret, user.Id[:])
+}
+
+// SealTotpSecrets encrypts the TOTP secrets stored in plain text before they
+// were encrypted at rest, and returns how many it encrypted.
+func (s *UserStore) SealTotpSecrets(ctx context.Context) (int, error) {
+	if s.totp == nil {
+		return 0, errors.New("totp secrets can't be encrypted without an encryption key")
+	}
+	const query = `SELECT id, totp_secret FROM users WHERE totp_secret IS NOT NULL AND totp_secret NOT LIKE 'v1:%'`
+	//a secret changed in the meantime is left alone
+	const dml = `UPDATE users SET totp_secret = $1 WHERE id = $2 AND totp_secret = $3`
+	var plain []struct {
+		Id     uuid.UUID `db:"id"`
+		Secret string    `db:"totp_secret"`
+	}
+	if err := s.db.SelectContext(ctx, &plain, query); err != nil {
+		return 0, fmt.Errorf("failed to list plain text totp secrets: %w", err)
+	}
+	sealedCount := 0
+	for _, user := range plain {
+		if totp.IsSealed(user.Secret) {
+			continue
+		}
+		sealed, err := s.totp.Seal(user.Secret, user.Id[:])
+		if err != nil {
+			return sealedCount, err
+		}
+		result, err := s.db.ExecContext(ctx, dml, sealed, user.Id, user.Secret)
+		if err != nil {
+			return sealedCount, fmt.Errorf("failed to encrypt totp secret of user %s: %w", user.Id, err)
+		}
+		if n, err := result.RowsAffected(); err == nil && n > 0 {
+			sealedCount++
+		}
+		s.invalidate(user.Id)
+	}
+	return sealedCount, nil
+}
+
+// EnableTotp confirms the pending TOTP secret of the user.
+func (s *UserStore) EnableTotp(ctx context.Context, id uuid.UUID) error {
+	defer s.invalidate(id)
+	const dml = `UPDATE users SET totp_enabled_at = CURRENT_TIMESTAMP WHERE id = $1 AND totp_secret IS NOT NULL`
+	result, err := s.db.ExecContext(ctx, dml, id)
+	if err != nil {
+		return fmt.Errorf("failed to enable totp for user %s: %w", id, err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("no pending totp secret: %w", sql.ErrNoRows)
+	}
+	return nil
+}
+
+// UseTotpStep records the time step of an accepted TOTP code. It returns an
+// error wrapping sql.ErrNoRows if a code of the same or a later step was
+// already accepted, i.e. the code is being replayed.
+func (s *UserStore) UseTotpStep(ctx context.Context, id uuid.UUID, step int64) error {
+	defer s.invalidate(id)
+	const dml = `UPDATE users SET totp_last_step = $1 WHERE id = $2 AND (totp_last_step IS NULL OR totp_last_step < $1)`
+	result, err := s.db.ExecContext(ctx, dml, step, id)
+	if err != nil {
+		return fmt.Errorf("failed to record totp step for user %s: %w", id, err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("totp code already used: %w", sql.ErrNoRows)
+	}
+	return nil
+}
+
+// SetRole changes the role of the user to RoleUser or RoleAdmin.
+func (s *UserStore) SetRole(ctx context.Context, id uuid.UUID, role string) error {
+	defer s.invalidate(id)
+	if role != RoleUser && role != RoleAdmin {
+		return fmt.Errorf("unknown role %q", role)
+	}
+	const dml = `UPDATE users SET role = $1 WHERE id = $2`
+	result, err := s.db.ExecContext(ctx, dml, role, id)
+	if err != nil {
+		return fmt.Errorf("failed to set role of user %s: %w", id, err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("user not found: %w", sql.ErrNoRows)
+	}
+	return nil
+}
+
+// SetDisabled disables or re-enables the account of the user.
+func (s *UserStore) SetDisabled(ctx context.Context, id uuid.UUID, disabled bool) (*User, error) {
+	defer s.invalidate(id)
+	const dml = `UPDATE users SET disabled_at = CASE WHEN $1 THEN COALESCE(disabled_at, CURRENT_TIMESTAMP) END
+		WHERE id = $2 RETURNING ` + userColumns
+	var user User
+	if err := s.db.GetContext(ctx, &user, dml, disabled, id); err != nil {
+		return nil, fmt.Errorf("failed to set disabled of user %s: %w", id, err)
+	}
+	return &user, nil
+}
+
+// RevokeSessions invalidates every access token issued to the user so far.
+// Refresh tokens are kept in RefreshTokenStore and must be deleted there.
+func (s *UserStore) RevokeSessions(ctx context.Context, id uuid.UUID) error {
+	defer s.invalidate(id)
+	const dml = `UPDATE users SET sessions_revoked_at = CURRENT_TIMESTAMP WHERE id = $1`
+	result, err := s.db.ExecContext(ctx, dml, id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke sessions of user %s: %w", id, err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("user not found: %w", sql.ErrNoRows)
+	}
+	return nil
+}
+
+// UserFilter narrows down ListUsers.
+type UserFilter struct {
+	// Query matches part of the email, case-insensitively.
+	Query  string
+	Limit  int
+	Offset int
+}
+
+// ListUsers returns the users matching the filter, newest first.
+func (s *UserStore) ListUsers(ctx context.Context, filter UserFilter) ([]User, error) {
+	const query = `SELECT ` + userColumns + ` FROM users
+		WHERE $1 = '' OR email ILIKE '%' || $1 || '%'
+		ORDER BY created_at DESC, id LIMIT $2 OFFSET $3;`
+	users := []User{}
+	//% and _ are matched literally
+	search := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(filter.Query)
+	if err := s.db.SelectContext(ctx, &users, query, search, filter.Limit, filter.Offset); err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	return users, nil
+}
@@ -2,16 +2,19 @@ package store_test
 
 import (
 	"context"
+	"database/sql"
 	"testing"
 	"time"
 
 	"asyncapi/fixtures"
 	"asyncapi/store"
+	"asyncapi/totp"
 
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	_ "github.com/lib/pq"
 
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
 )
 
@@ -24,7 +27,7 @@ func TestUserStore(t *testing.T) {
 	t.Cleanup(func() {
 		cleanup(t)
 	})
-	userStore := store.NewUserStore(env.Db)
+	userStore := store.NewUserStore(env.Db, env.Passwords, env.TotpCipher)
 	require.NotNil(t, userStore)
 	now := time.Now()
 	// Create a test user
@@ -56,3 +59,193 @@ func TestUserStore(t *testing.T) {
 	require.Equal(t, user.CreatedAt.UnixNano(), user2.CreatedAt.UnixNano())
 
 }
+
+func TestUserStore_DeleteUser(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() {
+		cleanup(t)
+	})
+
+	ctx := context.Background()
+	userStore := store.NewUserStore(env.Db, env.Passwords, env.TotpCipher)
+	reportStore := store.NewReportStore(env.Db)
+	user, err := userStore.CreateUser(ctx, "test@test.com", "testpassword")
+	require.NoError(t, err)
+	report, err := reportStore.Create(ctx, user.Id, "monsters")
+	require.NoError(t, err)
+
+	require.NoError(t, userStore.DeleteUser(ctx, user.Id))
+
+	_, err = userStore.GetUserByID(ctx, user.Id)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	//reports are removed by the cascade
+	deleted, err := reportStore.GetByPrimaryKey(ctx, user.Id, report.Id)
+	require.NoError(t, err)
+	require.Nil(t, deleted)
+
+	require.ErrorIs(t, userStore.DeleteUser(ctx, user.Id), sql.ErrNoRows)
+}
+
+func TestUserStore_SetRole(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() {
+		cleanup(t)
+	})
+
+	ctx := context.Background()
+	userStore := store.NewUserStore(env.Db, env.Passwords, env.TotpCipher)
+	user, err := userStore.CreateUser(ctx, "test@test.com", "testpassword")
+	require.NoError(t, err)
+	require.Equal(t, store.RoleUser, user.Role)
+
+	require.NoError(t, userStore.SetRole(ctx, user.Id, store.RoleAdmin))
+	user, err = userStore.GetUserByID(ctx, user.Id)
+	require.NoError(t, err)
+	require.Equal(t, store.RoleAdmin, user.Role)
+
+	require.Error(t, userStore.SetRole(ctx, user.Id, "root"))
+	require.ErrorIs(t, userStore.SetRole(ctx, uuid.New(), store.RoleUser), sql.ErrNoRows)
+}
+
+func TestUserStore_Cache(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() {
+		cleanup(t)
+	})
+
+	ctx := context.Background()
+	userStore := store.NewUserStore(env.Db, env.Passwords, env.TotpCipher)
+	userStore.EnableCache(10, time.Minute)
+	user, err := userStore.CreateUser(ctx, "test@test.com", "testpassword")
+	require.NoError(t, err)
+
+	_, err = userStore.GetUserByID(ctx, user.Id)
+	require.NoError(t, err)
+	cached, err := userStore.GetUserByID(ctx, user.Id)
+	require.NoError(t, err)
+	require.Equal(t, user.Id, cached.Id)
+	require.Equal(t, uint64(1), userStore.CacheStats().Hits)
+	require.Equal(t, uint64(1), userStore.CacheStats().Misses)
+
+	//changes made through the store are visible right away
+	require.NoError(t, userStore.SetRole(ctx, user.Id, store.RoleAdmin))
+	updated, err := userStore.GetUserByID(ctx, user.Id)
+	require.NoError(t, err)
+	require.Equal(t, store.RoleAdmin, updated.Role)
+
+	require.NoError(t, userStore.DeleteUser(ctx, user.Id))
+	_, err = userStore.GetUserByID(ctx, user.Id)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestUser_TokenRevoked(t *testing.T) {
+	revokedAt := time.Date(2024, 1, 1, 12, 0, 0, 500_000_000, time.UTC)
+	user := store.User{}
+	require.False(t, user.TokenRevoked(revokedAt.Add(-time.Hour)))
+
+	user.SessionsRevokedAt = &revokedAt
+	require.True(t, user.TokenRevoked(revokedAt.Add(-time.Second)))
+	//tokens issued within the same second are kept
+	require.False(t, user.TokenRevoked(revokedAt.Truncate(time.Second)))
+	require.False(t, user.TokenRevoked(revokedAt.Add(time.Second)))
+}
+
+func TestUserStore_Admin(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() {
+		cleanup(t)
+	})
+
+	ctx := context.Background()
+	userStore := store.NewUserStore(env.Db, env.Passwords, env.TotpCipher)
+	user, err := userStore.CreateUser(ctx, "test@test.com", "testpassword")
+	require.NoError(t, err)
+	_, err = userStore.CreateUser(ctx, "other_user@example.com", "testpassword")
+	require.NoError(t, err)
+
+	disabled, err := userStore.SetDisabled(ctx, user.Id, true)
+	require.NoError(t, err)
+	require.True(t, disabled.Disabled())
+	enabled, err := userStore.SetDisabled(ctx, user.Id, false)
+	require.NoError(t, err)
+	require.False(t, enabled.Disabled())
+
+	require.NoError(t, userStore.RevokeSessions(ctx, user.Id))
+	user, err = userStore.GetUserByID(ctx, user.Id)
+	require.NoError(t, err)
+	require.NotNil(t, user.SessionsRevokedAt)
+	require.ErrorIs(t, userStore.RevokeSessions(ctx, uuid.New()), sql.ErrNoRows)
+
+	users, err := userStore.ListUsers(ctx, store.UserFilter{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, users, 2)
+	users, err = userStore.ListUsers(ctx, store.UserFilter{Query: "TEST.com", Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	require.Equal(t, user.Id, users[0].Id)
+	//wildcards are matched literally
+	users, err = userStore.ListUsers(ctx, store.UserFilter{Query: "_", Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	users, err = userStore.ListUsers(ctx, store.UserFilter{Limit: 10, Offset: 2})
+	require.NoError(t, err)
+	require.Empty(t, users)
+}
+
+func TestUserStore_TotpSecret(t *testing.T) {
+	env := fixtures.NewTestEnv(t)
+	cleanup := env.SetupDb(t)
+	t.Cleanup(func() {
+		cleanup(t)
+	})
+
+	ctx := context.Background()
+	userStore := store.NewUserStore(env.Db, env.Passwords, env.TotpCipher)
+	user, err := userStore.CreateUser(ctx, "test@test.com", "testpassword")
+	require.NoError(t, err)
+	legacy, err := userStore.CreateUser(ctx, "legacy@test.com", "testpassword")
+	require.NoError(t, err)
+
+	//the secret is encrypted in the database, sealed secrets of the generated
+	//length must fit in the column
+	generated, err := totp.GenerateSecret()
+	require.NoError(t, err)
+	require.NoError(t, userStore.SetTotpSecret(ctx, user.Id, generated))
+	var stored string
+	require.NoError(t, env.Db.QueryRowContext(ctx, `SELECT totp_secret FROM users WHERE id = $1`, user.Id).Scan(&stored))
+	require.NotContains(t, stored, generated)
+	user, err = userStore.GetUserByID(ctx, user.Id)
+	require.NoError(t, err)
+	secret, err := userStore.TotpSecret(user)
+	require.NoError(t, err)
+	require.Equal(t, generated, secret)
+
+	//secrets stored in plain text are read, and encrypted by SealTotpSecrets
+	_, err = env.Db.ExecContext(ctx, `UPDATE users SET totp_secret = 'KRSXG5CTMVRXEZLU' WHERE id = $1`, legacy.Id)
+	require.NoError(t, err)
+	legacy, err = userStore.GetUserByID(ctx, legacy.Id)
+	require.NoError(t, err)
+	secret, err = userStore.TotpSecret(legacy)
+	require.NoError(t, err)
+	require.Equal(t, "KRSXG5CTMVRXEZLU", secret)
+
+	sealed, err := userStore.SealTotpSecrets(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, sealed)
+	legacy, err = userStore.GetUserByID(ctx, legacy.Id)
+	require.NoError(t, err)
+	require.NotEqual(t, "KRSXG5CTMVRXEZLU", *legacy.TotpSecret)
+	secret, err = userStore.TotpSecret(legacy)
+	require.NoError(t, err)
+	require.Equal(t, "KRSXG5CTMVRXEZLU", secret)
+
+	//a store without the key neither stores nor reads secrets
+	keyless := store.NewUserStore(env.Db, env.Passwords, nil)
+	require.Error(t, keyless.SetTotpSecret(ctx, user.Id, generated))
+	_, err = keyless.TotpSecret(user)
+	require.Error(t, err)
+}
@@ -14,6 +14,10 @@ variable "sqs_queue" {
   type = string
 }
 
+variable "sqs_dlq" {
+  type = string
+}
+
 variable "s3_bucket" {
   type = string
 }
@@ -48,10 +52,31 @@ resource "aws_s3_bucket" "reports_s3_bucket" {
   bucket = var.s3_bucket
 }
 
+resource "aws_sqs_queue" "reports_sqs_dlq" {
+  name                      = var.sqs_dlq
+  message_retention_seconds = 1209600
+}
+
 resource "aws_sqs_queue" "reports_sqs_queue" {
   name                      = var.sqs_queue
   delay_seconds             = 5
   max_message_size          = 2048
   message_retention_seconds = 86400
   receive_wait_time_seconds = 10
+
+  # messages that keep failing end up in the dead letter queue, the worker
+  # moves those of an unsupported version there right away
+  redrive_policy = jsonencode({
+    deadLetterTargetArn = aws_sqs_queue.reports_sqs_dlq.arn
+    maxReceiveCount     = 5
+  })
+}
+
+resource "aws_sqs_queue_redrive_allow_policy" "reports_sqs_dlq" {
+  queue_url = aws_sqs_queue.reports_sqs_dlq.id
+
+  redrive_allow_policy = jsonencode({
+    redrivePermission = "byQueue",
+    sourceQueueArns   = [aws_sqs_queue.reports_sqs_queue.arn]
+  })
 }
@@ -0,0 +1,82 @@
+package totp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// sealedPrefix marks the secrets encrypted by a Cipher. Base32 secrets never
+// contain a colon, so secrets stored before encryption are told apart.
+const sealedPrefix = "v1:"
+
+// Cipher encrypts TOTP secrets at rest with AES-256-GCM, so a leaked database
+// dump is not enough to generate the codes of its users.
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// NewCipher returns a cipher for the base64 encoded 32 byte key, as generated
+// by e.g. `openssl rand -base64 32`.
+func NewCipher(key string) (*Cipher, error) {
+	if key == "" {
+		return nil, errors.New("totp encryption key is not set")
+	}
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid totp encryption key: %w", err)
+	}
+	if len(raw) != 32 {
+		return nil, fmt.Errorf("totp encryption key must be 32 bytes, got %d", len(raw))
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid totp encryption key: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("invalid totp encryption key: %w", err)
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+// Seal encrypts the secret. The owner, e.g. the ID of the user, is
+// authenticated along with it: the sealed secret only opens for the same owner.
+func (c *Cipher) Seal(secret string, owner []byte) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(secret), owner)
+	return sealedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a secret sealed for the owner. Secrets stored in plain text
+// before encryption was introduced are returned as is, see IsSealed.
+func (c *Cipher) Open(stored string, owner []byte) (string, error) {
+	if !IsSealed(stored) {
+		return stored, nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, sealedPrefix))
+	if err != nil {
+		return "", fmt.Errorf("invalid sealed totp secret: %w", err)
+	}
+	if len(sealed) < c.aead.NonceSize() {
+		return "", errors.New("invalid sealed totp secret: too short")
+	}
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	secret, err := c.aead.Open(nil, nonce, ciphertext, owner)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt totp secret: %w", err)
+	}
+	return string(secret), nil
+}
+
+// IsSealed reports whether the stored secret was encrypted by a Cipher.
+func IsSealed(stored string) bool {
+	return strings.HasPrefix(stored, sealedPrefix)
+}
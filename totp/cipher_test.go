@@ -0,0 +1,47 @@
+package totp_test
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"asyncapi/totp"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCipher(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32)))
+	c, err := totp.NewCipher(key)
+	require.NoError(t, err)
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+
+	sealed, err := c.Seal(secret, []byte("alice"))
+	require.NoError(t, err)
+	require.True(t, totp.IsSealed(sealed))
+	require.NotContains(t, sealed, secret)
+	opened, err := c.Open(sealed, []byte("alice"))
+	require.NoError(t, err)
+	require.Equal(t, secret, opened)
+
+	//a secret copied to another user doesn't open
+	_, err = c.Open(sealed, []byte("bob"))
+	require.Error(t, err)
+	//nor with another key
+	other, err := totp.NewCipher(base64.StdEncoding.EncodeToString([]byte(strings.Repeat("o", 32))))
+	require.NoError(t, err)
+	_, err = other.Open(sealed, []byte("alice"))
+	require.Error(t, err)
+
+	//secrets stored before encryption are still read
+	require.False(t, totp.IsSealed(secret))
+	opened, err = c.Open(secret, []byte("alice"))
+	require.NoError(t, err)
+	require.Equal(t, secret, opened)
+
+	_, err = totp.NewCipher("")
+	require.Error(t, err)
+	_, err = totp.NewCipher(base64.StdEncoding.EncodeToString([]byte("short")))
+	require.Error(t, err)
+}
@@ -0,0 +1,61 @@
+package totp_test
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"asyncapi/totp"
+
+	"github.com/stretchr/testify/require"
+)
+
+// rfcSecret is the SHA1 seed of the RFC 6238 test vectors.
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCodeAt(t *testing.T) {
+	// RFC 6238 appendix B, truncated to 6 digits
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, expected := range vectors {
+		code, err := totp.CodeAt(rfcSecret, totp.Step(time.Unix(unix, 0)))
+		require.NoError(t, err)
+		require.Equal(t, expected, code, unix)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+
+	now := time.Now()
+	code, err := totp.CodeAt(secret, totp.Step(now))
+	require.NoError(t, err)
+
+	step, ok := totp.Validate(secret, code, now, 1)
+	require.True(t, ok)
+	require.Equal(t, totp.Step(now), step)
+
+	_, ok = totp.Validate(secret, code, now.Add(totp.Period), 1)
+	require.True(t, ok, "previous step is accepted within skew")
+
+	_, ok = totp.Validate(secret, code, now.Add(3*totp.Period), 1)
+	require.False(t, ok)
+
+	_, ok = totp.Validate(secret, "12345", now, 1)
+	require.False(t, ok)
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := totp.ProvisioningURI("asyncapi", "test@test.com", "SECRET")
+	require.True(t, strings.HasPrefix(uri, "otpauth://totp/asyncapi:test@test.com?"))
+	require.Contains(t, uri, "secret=SECRET")
+	require.Contains(t, uri, "issuer=asyncapi")
+}
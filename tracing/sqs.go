@@ -0,0 +1,63 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// sqsCarrier adapts SQS message attributes to a propagation.TextMapCarrier.
+type sqsCarrier map[string]types.MessageAttributeValue
+
+func (c sqsCarrier) Get(key string) string {
+	value, ok := c[key]
+	if !ok || value.StringValue == nil {
+		return ""
+	}
+	return *value.StringValue
+}
+
+func (c sqsCarrier) Set(key, value string) {
+	c[key] = types.MessageAttributeValue{
+		DataType:    aws.String("String"),
+		StringValue: aws.String(value),
+	}
+}
+
+func (c sqsCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// InjectSqs returns the message attributes carrying the trace context of ctx
+// (traceparent and tracestate), empty when ctx has no span.
+func InjectSqs(ctx context.Context) map[string]types.MessageAttributeValue {
+	attributes := sqsCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, attributes)
+	return attributes
+}
+
+// ExtractSqs returns ctx with the trace context carried by the attributes of
+// a received message, so its processing joins the trace of the sender.
+func ExtractSqs(ctx context.Context, attributes map[string]types.MessageAttributeValue) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, sqsCarrier(attributes))
+}
+
+// Inject returns the trace context of ctx as a map, to carry it inside a
+// message body. It is empty when ctx has no span.
+func Inject(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	return carrier
+}
+
+// Extract returns ctx with the trace context returned by Inject.
+func Extract(ctx context.Context, carrier map[string]string) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(carrier))
+}
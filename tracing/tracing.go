@@ -0,0 +1,72 @@
+// Package tracing sets up OpenTelemetry tracing for the API server and the
+// worker and carries the trace context of a report through SQS.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"asyncapi/config"
+)
+
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOtlp   = "otlp"
+)
+
+// Tracer returns the tracer of an instrumented package, named after it.
+func Tracer(name string) trace.Tracer {
+	return otel.Tracer("asyncapi/" + name)
+}
+
+// Setup installs the global tracer provider and the W3C trace context
+// propagator for the service. It returns a function flushing the spans that
+// are left on shutdown. With the "none" exporter the propagator is still
+// installed, so traces started by clients pass through.
+func Setup(ctx context.Context, conf *config.Config, serviceName string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch conf.TracingExporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterOtlp:
+		exporter, err = otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(conf.OtlpEndpoint))
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", conf.TracingExporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the %s span exporter: %w", conf.TracingExporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+		semconv.DeploymentEnvironment(string(conf.Env)),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the tracing resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		//follow the decision of the caller, sample new traces by ratio
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(conf.TracingSampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
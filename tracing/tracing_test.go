@@ -0,0 +1,39 @@
+package tracing_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"asyncapi/config"
+	"asyncapi/tracing"
+)
+
+func TestSqsPropagation(t *testing.T) {
+	_, err := tracing.Setup(context.Background(), &config.Config{TracingExporter: tracing.ExporterNone}, "test")
+	require.NoError(t, err)
+
+	provider := sdktrace.NewTracerProvider()
+	ctx, span := provider.Tracer("test").Start(context.Background(), "send")
+	defer span.End()
+
+	attributes := tracing.InjectSqs(ctx)
+	require.Contains(t, attributes, "traceparent")
+	require.Equal(t, "String", *attributes["traceparent"].DataType)
+
+	extracted := trace.SpanContextFromContext(tracing.ExtractSqs(context.Background(), attributes))
+	require.True(t, extracted.IsRemote())
+	require.Equal(t, span.SpanContext().TraceID(), extracted.TraceID())
+	require.Equal(t, span.SpanContext().SpanID(), extracted.SpanID())
+
+	require.Empty(t, tracing.InjectSqs(context.Background()))
+	require.False(t, trace.SpanContextFromContext(tracing.ExtractSqs(context.Background(), nil)).IsValid())
+}
+
+func TestSetup_UnknownExporter(t *testing.T) {
+	_, err := tracing.Setup(context.Background(), &config.Config{TracingExporter: "zipkin"}, "test")
+	require.Error(t, err)
+}